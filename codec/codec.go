@@ -0,0 +1,67 @@
+// Package codec 在 RingBuffer 之上实现常见的帧编解码。
+//
+// 解码器通过 explore 游标(ExploreBegin/ExploreRead/ExploreCommit/ExploreBreak)
+// 试探性地读取数据：只有完整的帧才会被消费，不完整的帧原样留在缓存中。
+package codec
+
+import (
+	"errors"
+
+	"github.com/zput/ringbuffer"
+)
+
+// 缓存中的数据还不足以组成一个完整的帧；没有消费任何数据，等待更多数据后重试即可。
+var ErrNeedMoreData = errors.New("need more data; codec")
+
+var ErrFrameTooLong = errors.New("frame is too long; codec")
+
+// 解码器需要直接丢弃数据，但是 explore 游标不在读指针处；没有消费任何数据，先提交或者放弃之前的 explore 再重试。
+var ErrExploreNotAtRead = errors.New("explore cursor is not at the read pointer; codec")
+var ErrCorruptedFrame = errors.New("frame is corrupted; codec")
+var ErrLengthOutOfRange = errors.New("length can not be represented by the length field; codec")
+
+var ErrInitCodecParameter = errors.New("parameter is not right; when initializing codec")
+
+// ExplorePeek 返回 explore 游标处连续的 n 个字节，不移动游标。
+// 数据跨越缓存尾部时会拷贝成一个新的切片；不足 n 个字节时返回 ErrNeedMoreData。
+func ExplorePeek(rb *ringbuffer.RingBuffer, n int) ([]byte, error) {
+	if rb.ExploreSize() < n {
+		return nil, ErrNeedMoreData
+	}
+	first, end := rb.Peek(n, true)
+	if len(end) == 0 {
+		return first, nil
+	}
+	buf := make([]byte, n)
+	copy(buf, first)
+	copy(buf[len(first):], end)
+	return buf, nil
+}
+
+// ExploreNext 从 explore 游标处读出 n 个字节到一个新的切片中，并移动游标。
+// 不足 n 个字节时返回 ErrNeedMoreData，游标不动。
+func ExploreNext(rb *ringbuffer.RingBuffer, n int) ([]byte, error) {
+	if rb.ExploreSize() < n {
+		return nil, ErrNeedMoreData
+	}
+	buf := make([]byte, n)
+	if n == 0 {
+		return buf, nil
+	}
+	if _, err := rb.ExploreRead(buf); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
+// decode 在一次 explore 中调用 fn：成功则提交，失败则回滚，保证失败时不消费任何数据。
+func decode(rb *ringbuffer.RingBuffer, fn func(rb *ringbuffer.RingBuffer) ([]byte, error)) ([]byte, error) {
+	rb.ExploreBegin()
+	frame, err := fn(rb)
+	if err != nil {
+		rb.ExploreBreak()
+		return nil, err
+	}
+	rb.ExploreCommit()
+	return frame, nil
+}
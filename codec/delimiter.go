@@ -0,0 +1,213 @@
+package codec
+
+import (
+	"github.com/zput/ringbuffer"
+)
+
+// LineDelimiter 返回 "\r\n" 与 "\n" 两个分隔符。
+func LineDelimiter() [][]byte {
+	return [][]byte{[]byte("\r\n"), []byte("\n")}
+}
+
+// NulDelimiter 返回 "\0" 分隔符。
+func NulDelimiter() [][]byte {
+	return [][]byte{{0}}
+}
+
+/*
+DelimiterDecoder 按照分隔符切分帧，参考 netty 的 DelimiterBasedFrameDecoder。
+
+  - 有多个分隔符时，选择使帧最短的那个；同一个位置上匹配多个分隔符时，选择最长的那个。
+  - 帧(不包括分隔符)超过 MaxFrameLength 时返回 ErrFrameTooLong，
+    并且丢弃数据直到下一个分隔符为止，之后继续正常解码。
+  - 记录已经扫描过的位置，缓存中的数据增长后再次解码不会从头扫描；
+    换了缓存，或者 explore 游标的偏移(WriteOffset() - ExploreSize())变了时从头扫描。
+
+DelimiterDecoder 保存了扫描状态，一个 DelimiterDecoder 只能用于一个数据流。
+*/
+type DelimiterDecoder struct {
+	MaxFrameLength int
+	StripDelimiter bool
+
+	delimiters [][]byte
+
+	scanned    int                    // explore 游标之后已经扫描过、可以确定不是分隔符开头的字节数
+	scannedRB  *ringbuffer.RingBuffer // scanned 所属的缓存
+	scannedAt  uint64                 // 扫描时 explore 游标的偏移
+	discarding bool
+}
+
+// NewDelimiterDecoder 返回一个 DelimiterDecoder；stripDelimiter 决定返回的帧是否去掉分隔符。
+func NewDelimiterDecoder(maxFrameLength int, stripDelimiter bool, delimiters ...[]byte) (*DelimiterDecoder, error) {
+	if maxFrameLength <= 0 || len(delimiters) == 0 {
+		return nil, ErrInitCodecParameter
+	}
+	d := &DelimiterDecoder{
+		MaxFrameLength: maxFrameLength,
+		StripDelimiter: stripDelimiter,
+	}
+	for _, delimiter := range delimiters {
+		if len(delimiter) == 0 {
+			return nil, ErrInitCodecParameter
+		}
+		d.delimiters = append(d.delimiters, append([]byte(nil), delimiter...))
+	}
+	return d, nil
+}
+
+// NewLineDecoder 返回一个以 "\r\n" 或 "\n" 结尾的 DelimiterDecoder。
+func NewLineDecoder(maxFrameLength int, stripDelimiter bool) (*DelimiterDecoder, error) {
+	return NewDelimiterDecoder(maxFrameLength, stripDelimiter, LineDelimiter()...)
+}
+
+// Decode 实现 Decoder：从 explore 游标处取出一个以分隔符结尾的帧，只移动 explore 游标。
+// 帧不完整时返回 ErrNeedMoreData；通过 Decode(rb, d) 调用时不会消费任何数据。
+// 返回 ErrFrameTooLong 时，过长的数据已经被丢弃：丢弃时会直接消费数据，不受 ExploreBreak 影响，
+// 所以 explore 游标需要位于读指针处，否则返回 ErrExploreNotAtRead，不消费任何数据。
+// no thread safety guarantees
+func (d *DelimiterDecoder) Decode(rb *ringbuffer.RingBuffer) ([]byte, error) {
+	for {
+		avail := rb.ExploreSize()
+		at := rb.WriteOffset() - uint64(avail)
+		if rb != d.scannedRB {
+			// 换了一个缓存(比如 Chain 中每一帧都是新的缓存)，之前的状态都不属于它
+			d.scanned = 0
+			d.discarding = false
+		} else if at != d.scannedAt || d.scanned > avail {
+			// 数据被其他地方消费或者改动了，之前的扫描结果已经无效
+			d.scanned = 0
+		}
+
+		first, end := rb.PeekAll(true)
+		idx, delimiterLength := d.index(first, end)
+		d.scannedRB, d.scannedAt = rb, at
+
+		if d.discarding {
+			if delimiterLength == 0 {
+				if err := d.discard(rb, d.scanned); err != nil {
+					return nil, err
+				}
+				return nil, ErrNeedMoreData
+			}
+			if err := d.discard(rb, idx+delimiterLength); err != nil {
+				return nil, err
+			}
+			d.discarding = false
+			continue
+		}
+
+		if delimiterLength == 0 {
+			if d.scanned > d.MaxFrameLength {
+				if err := d.discard(rb, d.scanned); err != nil {
+					return nil, err
+				}
+				d.discarding = true
+				return nil, ErrFrameTooLong
+			}
+			return nil, ErrNeedMoreData
+		}
+
+		if idx > d.MaxFrameLength {
+			if err := d.discard(rb, idx+delimiterLength); err != nil {
+				return nil, err
+			}
+			return nil, ErrFrameTooLong
+		}
+
+		frame, err := ExploreNext(rb, idx+delimiterLength)
+		if err != nil {
+			return nil, err
+		}
+		d.scanned = 0
+		if d.StripDelimiter {
+			frame = frame[:idx]
+		}
+		return frame, nil
+	}
+}
+
+// Reset 实现 Resetter：丢弃扫描进度和丢弃状态，下一次解码从头开始。
+func (d *DelimiterDecoder) Reset() {
+	d.scanned = 0
+	d.scannedRB = nil
+	d.discarding = false
+}
+
+// index 从 d.scanned 开始查找分隔符，返回帧的长度和匹配到的分隔符长度；
+// 没有找到时 delimiterLength 为 0，并且更新 d.scanned。
+func (d *DelimiterDecoder) index(first, end []byte) (idx int, delimiterLength int) {
+	total := len(first) + len(end)
+	at := func(i int) byte {
+		if i < len(first) {
+			return first[i]
+		}
+		return end[i-len(first)]
+	}
+
+	for i := d.scanned; i < total; i++ {
+		undecided := false
+		for _, delimiter := range d.delimiters {
+			if at(i) != delimiter[0] {
+				continue
+			}
+			j := 1
+			for ; j < len(delimiter) && i+j < total; j++ {
+				if at(i+j) != delimiter[j] {
+					break
+				}
+			}
+			if j == len(delimiter) {
+				if len(delimiter) > delimiterLength {
+					delimiterLength = len(delimiter)
+				}
+			} else if i+j == total {
+				// 剩下的数据是分隔符的前缀，需要更多数据才能确定
+				undecided = true
+			}
+		}
+		if undecided {
+			d.scanned = i
+			return 0, 0
+		}
+		if delimiterLength > 0 {
+			return i, delimiterLength
+		}
+	}
+	d.scanned = total
+	return 0, 0
+}
+
+// discard 直接消费 explore 游标之后的 n 个字节，并重新开始 explore；
+// Discard 从读指针开始消费，explore 游标不在读指针处时返回 ErrExploreNotAtRead，不消费也不改变扫描状态。
+func (d *DelimiterDecoder) discard(rb *ringbuffer.RingBuffer, n int) error {
+	if n <= 0 {
+		return nil
+	}
+	if rb.ExploreSize() != rb.Size() {
+		return ErrExploreNotAtRead
+	}
+	d.scanned -= n
+	if d.scanned < 0 {
+		d.scanned = 0
+	}
+	d.scannedAt += uint64(n)
+	_, _ = rb.Discard(n)
+	rb.ExploreBegin()
+	return nil
+}
+
+// DelimiterEncoder 在帧后面加上分隔符。
+type DelimiterEncoder struct {
+	Delimiter []byte
+}
+
+// Encode 把 frame 和分隔符依次写入 out。
+func (e *DelimiterEncoder) Encode(out *ringbuffer.RingBuffer, frame []byte) error {
+	if _, err := out.Write(frame); err != nil {
+		return err
+	}
+	if _, err := out.Write(e.Delimiter); err != nil {
+		return err
+	}
+	return nil
+}
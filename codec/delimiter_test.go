@@ -0,0 +1,223 @@
+package codec
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/zput/ringbuffer"
+)
+
+func TestDelimiterDecoder_Lines(t *testing.T) {
+	for _, strip := range []bool{true, false} {
+		d, err := NewLineDecoder(64, strip)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rb := ringbuffer.New(8)
+		_, _ = rb.WriteString("first\r\nsecond\nthird\r")
+
+		expects := []string{"first\r\n", "second\n"}
+		for _, expect := range expects {
+			frame, err := Decode(rb, d)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if strip {
+				expect = string(bytes.TrimRight([]byte(expect), "\r\n"))
+			}
+			if string(frame) != expect {
+				t.Fatalf("expect %q but got %q", expect, frame)
+			}
+		}
+
+		// "\r" 可能是 "\r\n" 的开头，需要等待更多数据
+		if _, err := Decode(rb, d); err != ErrNeedMoreData {
+			t.Fatalf("expect ErrNeedMoreData but got %v", err)
+		}
+		if rb.Size() != len("third\r") {
+			t.Fatalf("partial frame should be untouched; got size %d", rb.Size())
+		}
+
+		_ = rb.WriteOneByte('\n')
+		frame, err := Decode(rb, d)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expect := "third\r\n"
+		if strip {
+			expect = "third"
+		}
+		if string(frame) != expect {
+			t.Fatalf("expect %q but got %q", expect, frame)
+		}
+		if !rb.IsEmpty() {
+			t.Fatalf("expect empty but got size %d", rb.Size())
+		}
+	}
+}
+
+func TestDelimiterDecoder_ShortestFrame(t *testing.T) {
+	d, err := NewDelimiterDecoder(64, true, []byte("\n"), []byte{0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rb := ringbuffer.New(16)
+	_, _ = rb.Write([]byte("ab\x00cd\nef\n"))
+	for _, expect := range []string{"ab", "cd", "ef"} {
+		frame, err := Decode(rb, d)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(frame) != expect {
+			t.Fatalf("expect %q but got %q", expect, frame)
+		}
+	}
+}
+
+func TestDelimiterDecoder_ScanProgress(t *testing.T) {
+	d, _ := NewLineDecoder(1024, true)
+	rb := ringbuffer.New(4)
+
+	line := []byte("resume scanning from the last position\r\n")
+	for i, c := range line[:len(line)-1] {
+		_ = rb.WriteOneByte(c)
+		if _, err := Decode(rb, d); err != ErrNeedMoreData {
+			t.Fatalf("expect ErrNeedMoreData but got %v", err)
+		}
+		// 最后一个字节是 '\r' 时还不能确定，其他情况下全部数据都已经扫描过
+		expect := i + 1
+		if c == '\r' {
+			expect = i
+		}
+		if d.scanned != expect {
+			t.Fatalf("expect scanned %d but got %d", expect, d.scanned)
+		}
+	}
+	_ = rb.WriteOneByte('\n')
+	frame, err := Decode(rb, d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(frame, line[:len(line)-2]) {
+		t.Fatalf("expect %q but got %q", line[:len(line)-2], frame)
+	}
+	if d.scanned != 0 {
+		t.Fatalf("expect scanned 0 but got %d", d.scanned)
+	}
+}
+
+func TestDelimiterDecoder_ScanReset(t *testing.T) {
+	d, _ := NewLineDecoder(1024, true)
+
+	// 换了一个缓存
+	rb := ringbuffer.New(8)
+	_, _ = rb.WriteString("abc")
+	if _, err := Decode(rb, d); err != ErrNeedMoreData || d.scanned != 3 {
+		t.Fatalf("expect ErrNeedMoreData with scanned 3 but got %v %d", err, d.scanned)
+	}
+	other := ringbuffer.New(8)
+	_, _ = other.WriteString("a\ncde")
+	if frame, err := Decode(other, d); err != nil || string(frame) != "a" {
+		t.Fatalf("expect a but got %q %v", frame, err)
+	}
+
+	// 同一个缓存中的数据被其他地方消费以后又写满
+	rb = ringbuffer.New(8)
+	_, _ = rb.WriteString("abc")
+	_, _ = Decode(rb, d)
+	_, _ = rb.Discard(3)
+	_, _ = rb.WriteString("x\nyz")
+	if frame, err := Decode(rb, d); err != nil || string(frame) != "x" {
+		t.Fatalf("expect x but got %q %v", frame, err)
+	}
+}
+
+func TestDelimiterDecoder_TooLong(t *testing.T) {
+	d, _ := NewLineDecoder(4, true)
+	rb := ringbuffer.New(8)
+
+	// 找到分隔符时帧太长：丢弃这一帧，后面的帧不受影响
+	_, _ = rb.WriteString("toolong\nok\n")
+	if _, err := Decode(rb, d); err != ErrFrameTooLong {
+		t.Fatalf("expect ErrFrameTooLong but got %v", err)
+	}
+	frame, err := Decode(rb, d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(frame) != "ok" {
+		t.Fatalf("expect ok but got %q", frame)
+	}
+
+	// 没有找到分隔符但是已经太长：进入丢弃模式直到下一个分隔符
+	_, _ = rb.WriteString("0123456")
+	if _, err := Decode(rb, d); err != ErrFrameTooLong {
+		t.Fatalf("expect ErrFrameTooLong but got %v", err)
+	}
+	if !rb.IsEmpty() {
+		t.Fatalf("too long data should be discarded; got size %d", rb.Size())
+	}
+	_, _ = rb.WriteString("789")
+	if _, err := Decode(rb, d); err != ErrNeedMoreData {
+		t.Fatalf("expect ErrNeedMoreData but got %v", err)
+	}
+	if !rb.IsEmpty() {
+		t.Fatalf("data should be discarded until delimiter; got size %d", rb.Size())
+	}
+	_, _ = rb.WriteString("abc\r\nnext\r\n")
+	frame, err = Decode(rb, d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(frame) != "next" {
+		t.Fatalf("expect next but got %q", frame)
+	}
+	if !rb.IsEmpty() {
+		t.Fatalf("expect empty but got size %d", rb.Size())
+	}
+}
+
+func TestDelimiterEncoder(t *testing.T) {
+	e := &DelimiterEncoder{Delimiter: []byte("\r\n")}
+	d, _ := NewLineDecoder(64, false)
+	rb := ringbuffer.New(4)
+	for _, s := range []string{"a", "", "hello"} {
+		if err := e.Encode(rb, []byte(s)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, s := range []string{"a", "", "hello"} {
+		frame, err := Decode(rb, d)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(frame) != s+"\r\n" {
+			t.Fatalf("expect %q but got %q", s+"\r\n", frame)
+		}
+	}
+}
+
+// TestDelimiterDecoder_DiscardExploreAhead explore 游标不在读指针处时不能直接丢弃数据。
+func TestDelimiterDecoder_DiscardExploreAhead(t *testing.T) {
+	d, _ := NewLineDecoder(4, true)
+	rb := ringbuffer.New(16)
+	_, _ = rb.WriteString("hdrtoolong\nok\n")
+
+	rb.ExploreBegin()
+	_, _ = rb.ExploreDiscard(3)
+	if _, err := d.Decode(rb); err != ErrExploreNotAtRead {
+		t.Fatalf("expect ErrExploreNotAtRead but got %v", err)
+	}
+	if rb.Size() != 14 || rb.ExploreSize() != 11 {
+		t.Fatalf("nothing should be consumed; got size %d/%d", rb.Size(), rb.ExploreSize())
+	}
+
+	// 提交之前的 explore 以后可以正常丢弃
+	rb.ExploreCommit()
+	if _, err := Decode(rb, d); err != ErrFrameTooLong {
+		t.Fatalf("expect ErrFrameTooLong but got %v", err)
+	}
+	if frame, err := Decode(rb, d); err != nil || string(frame) != "ok" {
+		t.Fatalf("expect ok but got %q %v", frame, err)
+	}
+}
@@ -0,0 +1,232 @@
+package codec
+
+import (
+	"encoding/binary"
+	"math"
+
+	"github.com/zput/ringbuffer"
+)
+
+// LengthFieldVarint 表示长度字段是 unsigned varint(protobuf 风格)，宽度不固定。
+const LengthFieldVarint = -1
+
+/*
+LengthFieldDecoder 按照帧中的长度字段切分帧，参考 netty 的 LengthFieldBasedFrameDecoder。
+
+	lengthFieldOffset   = 0
+	lengthFieldLength   = 2
+	lengthAdjustment    = 0
+	initialBytesToStrip = 2
+	BEFORE DECODE (14 bytes)         AFTER DECODE (12 bytes)
+	+--------+----------------+      +----------------+
+	| Length | Actual Content |----->| Actual Content |
+	| 0x000C | "HELLO, WORLD" |      | "HELLO, WORLD" |
+	+--------+----------------+      +----------------+
+
+	帧的总长度 = 长度字段的值 + lengthAdjustment + lengthFieldOffset + 长度字段的宽度
+*/
+type LengthFieldDecoder struct {
+	// 长度字段的字节序，默认 binary.BigEndian；varint 时不使用
+	ByteOrder           binary.ByteOrder
+	MaxFrameLength      int
+	LengthFieldOffset   int
+	LengthFieldLength   int // 1/2/4/8 或 LengthFieldVarint
+	LengthAdjustment    int
+	InitialBytesToStrip int
+}
+
+// NewLengthFieldDecoder 返回一个大端序的 LengthFieldDecoder，参数的含义与 netty 相同。
+func NewLengthFieldDecoder(maxFrameLength, lengthFieldOffset, lengthFieldLength, lengthAdjustment, initialBytesToStrip int) (*LengthFieldDecoder, error) {
+	if maxFrameLength <= 0 || lengthFieldOffset < 0 || initialBytesToStrip < 0 {
+		return nil, ErrInitCodecParameter
+	}
+	if !validLengthFieldLength(lengthFieldLength) {
+		return nil, ErrInitCodecParameter
+	}
+	if lengthFieldLength != LengthFieldVarint && lengthFieldOffset > maxFrameLength-lengthFieldLength {
+		return nil, ErrInitCodecParameter
+	}
+	return &LengthFieldDecoder{
+		ByteOrder:           binary.BigEndian,
+		MaxFrameLength:      maxFrameLength,
+		LengthFieldOffset:   lengthFieldOffset,
+		LengthFieldLength:   lengthFieldLength,
+		LengthAdjustment:    lengthAdjustment,
+		InitialBytesToStrip: initialBytesToStrip,
+	}, nil
+}
+
+func validLengthFieldLength(n int) bool {
+	switch n {
+	case 1, 2, 4, 8, LengthFieldVarint:
+		return true
+	}
+	return false
+}
+
+// Decode 实现 Decoder：从 explore 游标处取出一个完整的帧(已去掉前 InitialBytesToStrip 个字节)，只移动 explore 游标。
+// 帧不完整时返回 ErrNeedMoreData；通过 Decode(rb, d) 调用时，出错不会消费任何数据。
+// no thread safety guarantees
+func (d *LengthFieldDecoder) Decode(rb *ringbuffer.RingBuffer) ([]byte, error) {
+	length, endOffset, err := d.peekLength(rb)
+	if err != nil {
+		return nil, err
+	}
+
+	// 用 int64 计算，避免长度字段的值过大时溢出
+	if length > math.MaxInt64/2 {
+		return nil, ErrFrameTooLong
+	}
+	frameLength := int64(length) + int64(d.LengthAdjustment) + int64(endOffset)
+	if frameLength < int64(endOffset) {
+		return nil, ErrCorruptedFrame
+	}
+	if frameLength > int64(d.MaxFrameLength) {
+		return nil, ErrFrameTooLong
+	}
+	if int64(d.InitialBytesToStrip) > frameLength {
+		return nil, ErrCorruptedFrame
+	}
+
+	frame, err := ExploreNext(rb, int(frameLength))
+	if err != nil {
+		return nil, err
+	}
+	return frame[d.InitialBytesToStrip:], nil
+}
+
+// peekLength 读出长度字段的值以及长度字段结束的位置，不移动 explore 游标。
+func (d *LengthFieldDecoder) peekLength(rb *ringbuffer.RingBuffer) (length uint64, endOffset int, err error) {
+	if d.LengthFieldLength == LengthFieldVarint {
+		n := rb.ExploreSize()
+		if n > d.LengthFieldOffset+binary.MaxVarintLen64 {
+			n = d.LengthFieldOffset + binary.MaxVarintLen64
+		}
+		if n <= d.LengthFieldOffset {
+			return 0, 0, ErrNeedMoreData
+		}
+		header, err := ExplorePeek(rb, n)
+		if err != nil {
+			return 0, 0, err
+		}
+		length, w := binary.Uvarint(header[d.LengthFieldOffset:])
+		if w == 0 {
+			if n < d.LengthFieldOffset+binary.MaxVarintLen64 {
+				return 0, 0, ErrNeedMoreData
+			}
+			return 0, 0, ErrCorruptedFrame
+		}
+		if w < 0 {
+			return 0, 0, ErrCorruptedFrame
+		}
+		if d.LengthFieldOffset+w > d.MaxFrameLength {
+			return 0, 0, ErrFrameTooLong
+		}
+		return length, d.LengthFieldOffset + w, nil
+	}
+
+	endOffset = d.LengthFieldOffset + d.LengthFieldLength
+	header, err := ExplorePeek(rb, endOffset)
+	if err != nil {
+		return 0, 0, err
+	}
+	order := d.ByteOrder
+	if order == nil {
+		order = binary.BigEndian
+	}
+	field := header[d.LengthFieldOffset:]
+	switch d.LengthFieldLength {
+	case 1:
+		length = uint64(field[0])
+	case 2:
+		length = uint64(order.Uint16(field))
+	case 4:
+		length = uint64(order.Uint32(field))
+	case 8:
+		length = order.Uint64(field)
+	default:
+		return 0, 0, ErrInitCodecParameter
+	}
+	return length, endOffset, nil
+}
+
+/*
+LengthFieldEncoder 在帧前面加上长度字段，参考 netty 的 LengthFieldPrepender；
+与 LengthFieldDecoder(maxFrameLength, 0, lengthFieldLength, 0, lengthFieldLength) 配套使用。
+*/
+type LengthFieldEncoder struct {
+	ByteOrder         binary.ByteOrder
+	LengthFieldLength int // 1/2/4/8 或 LengthFieldVarint
+	LengthAdjustment  int
+	// 长度字段的值是否包含长度字段自身的宽度；varint 不支持
+	LengthIncludesLengthFieldLength bool
+}
+
+// NewLengthFieldEncoder 返回一个大端序的 LengthFieldEncoder。
+func NewLengthFieldEncoder(lengthFieldLength int) (*LengthFieldEncoder, error) {
+	if !validLengthFieldLength(lengthFieldLength) {
+		return nil, ErrInitCodecParameter
+	}
+	return &LengthFieldEncoder{
+		ByteOrder:         binary.BigEndian,
+		LengthFieldLength: lengthFieldLength,
+	}, nil
+}
+
+// Encode 把长度字段和 frame 依次写入 out。
+func (e *LengthFieldEncoder) Encode(out *ringbuffer.RingBuffer, frame []byte) error {
+	length := int64(len(frame)) + int64(e.LengthAdjustment)
+	if e.LengthIncludesLengthFieldLength {
+		if e.LengthFieldLength == LengthFieldVarint {
+			return ErrInitCodecParameter
+		}
+		length += int64(e.LengthFieldLength)
+	}
+	if length < 0 {
+		return ErrLengthOutOfRange
+	}
+
+	var (
+		header [binary.MaxVarintLen64]byte
+		n      int
+	)
+	order := e.ByteOrder
+	if order == nil {
+		order = binary.BigEndian
+	}
+	switch e.LengthFieldLength {
+	case 1:
+		if length > math.MaxUint8 {
+			return ErrLengthOutOfRange
+		}
+		header[0] = byte(length)
+		n = 1
+	case 2:
+		if length > math.MaxUint16 {
+			return ErrLengthOutOfRange
+		}
+		order.PutUint16(header[:], uint16(length))
+		n = 2
+	case 4:
+		if length > math.MaxUint32 {
+			return ErrLengthOutOfRange
+		}
+		order.PutUint32(header[:], uint32(length))
+		n = 4
+	case 8:
+		order.PutUint64(header[:], uint64(length))
+		n = 8
+	case LengthFieldVarint:
+		n = binary.PutUvarint(header[:], uint64(length))
+	default:
+		return ErrInitCodecParameter
+	}
+
+	if _, err := out.Write(header[:n]); err != nil {
+		return err
+	}
+	if _, err := out.Write(frame); err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,175 @@
+package codec
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/zput/ringbuffer"
+)
+
+func TestLengthFieldDecoder_Netty(t *testing.T) {
+	cases := []struct {
+		name                              string
+		offset, length, adjustment, strip int
+		input, expect                     []byte
+	}{
+		{"no strip", 0, 2, 0, 0, []byte("\x00\x0cHELLO, WORLD"), []byte("\x00\x0cHELLO, WORLD")},
+		{"strip header", 0, 2, 0, 2, []byte("\x00\x0cHELLO, WORLD"), []byte("HELLO, WORLD")},
+		{"length includes header", 0, 2, -2, 0, []byte("\x00\x0eHELLO, WORLD"), []byte("\x00\x0eHELLO, WORLD")},
+		{"header before length", 2, 4, 0, 0, []byte("\xca\xfe\x00\x00\x00\x0cHELLO, WORLD"), []byte("\xca\xfe\x00\x00\x00\x0cHELLO, WORLD")},
+		{"header after length", 0, 1, 2, 0, []byte("\x0c\xca\xfeHELLO, WORLD"), []byte("\x0c\xca\xfeHELLO, WORLD")},
+		{"strip to content", 1, 2, 1, 3, []byte("\xca\x00\x0c\xfeHELLO, WORLD"), []byte("\xfeHELLO, WORLD")},
+	}
+	for _, c := range cases {
+		d, err := NewLengthFieldDecoder(1024, c.offset, c.length, c.adjustment, c.strip)
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		rb := ringbuffer.New(8)
+		_, _ = rb.Write(c.input)
+		_, _ = rb.Write([]byte("next"))
+
+		frame, err := Decode(rb, d)
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		if !bytes.Equal(frame, c.expect) {
+			t.Fatalf("%s: expect %q but got %q", c.name, c.expect, frame)
+		}
+		if rb.Size() != 4 {
+			t.Fatalf("%s: expect 4 bytes left but got %d", c.name, rb.Size())
+		}
+	}
+}
+
+func TestLengthFieldDecoder_Partial(t *testing.T) {
+	d, err := NewLengthFieldDecoder(1024, 0, 4, 0, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rb := ringbuffer.New(16)
+
+	// 先让读写指针移动到中间，使帧跨越缓存尾部
+	_, _ = rb.Write(make([]byte, 10))
+	rb.Retrieve(10)
+
+	msg := []byte("hello ring buffer")
+	header := make([]byte, 4)
+	binary.BigEndian.PutUint32(header, uint32(len(msg)))
+	stream := append(header, msg...)
+
+	for i := 0; i < len(stream)-1; i++ {
+		_ = rb.WriteOneByte(stream[i])
+		_, err = Decode(rb, d)
+		if err != ErrNeedMoreData {
+			t.Fatalf("expect ErrNeedMoreData but got %v", err)
+		}
+		if rb.Size() != i+1 {
+			t.Fatalf("partial frame should be untouched; expect size %d but got %d", i+1, rb.Size())
+		}
+	}
+	_ = rb.WriteOneByte(stream[len(stream)-1])
+
+	frame, err := Decode(rb, d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(frame, msg) {
+		t.Fatalf("expect %q but got %q", msg, frame)
+	}
+	if !rb.IsEmpty() {
+		t.Fatalf("expect empty but got size %d", rb.Size())
+	}
+}
+
+func TestLengthFieldDecoder_Errors(t *testing.T) {
+	d, _ := NewLengthFieldDecoder(8, 0, 2, 0, 0)
+	rb := ringbuffer.New(16)
+	_, _ = rb.Write([]byte{0x00, 0x07, 1, 2, 3, 4, 5, 6, 7})
+	if _, err := Decode(rb, d); err != ErrFrameTooLong {
+		t.Fatalf("expect ErrFrameTooLong but got %v", err)
+	}
+	if rb.Size() != 9 {
+		t.Fatalf("nothing should be consumed but got size %d", rb.Size())
+	}
+
+	d, _ = NewLengthFieldDecoder(8, 0, 2, -4, 0)
+	rb = ringbuffer.New(16)
+	_, _ = rb.Write([]byte{0x00, 0x01, 1})
+	if _, err := Decode(rb, d); err != ErrCorruptedFrame {
+		t.Fatalf("expect ErrCorruptedFrame but got %v", err)
+	}
+
+	if _, err := NewLengthFieldDecoder(8, 0, 3, 0, 0); err != ErrInitCodecParameter {
+		t.Fatalf("expect ErrInitCodecParameter but got %v", err)
+	}
+	if _, err := NewLengthFieldDecoder(8, 7, 2, 0, 0); err != ErrInitCodecParameter {
+		t.Fatalf("expect ErrInitCodecParameter but got %v", err)
+	}
+}
+
+func TestLengthFieldCodec_RoundTrip(t *testing.T) {
+	for _, width := range []int{1, 2, 4, 8, LengthFieldVarint} {
+		for _, order := range []binary.ByteOrder{binary.BigEndian, binary.LittleEndian} {
+			e, err := NewLengthFieldEncoder(width)
+			if err != nil {
+				t.Fatal(err)
+			}
+			e.ByteOrder = order
+			strip := width
+			if width == LengthFieldVarint {
+				strip = 0
+			}
+			d, err := NewLengthFieldDecoder(1024, 0, width, 0, strip)
+			if err != nil {
+				t.Fatal(err)
+			}
+			d.ByteOrder = order
+
+			rb := ringbuffer.New(3)
+			frames := [][]byte{[]byte("a"), {}, bytes.Repeat([]byte("xyz"), 70)}
+			for _, f := range frames {
+				if err := e.Encode(rb, f); err != nil {
+					t.Fatal(err)
+				}
+			}
+			for _, f := range frames {
+				got, err := Decode(rb, d)
+				if err != nil {
+					t.Fatalf("width %d: %v", width, err)
+				}
+				if width == LengthFieldVarint {
+					// varint 的宽度不固定，去掉实际的长度字段
+					_, w := binary.Uvarint(got)
+					got = got[w:]
+				}
+				if !bytes.Equal(got, f) {
+					t.Fatalf("width %d: expect %q but got %q", width, f, got)
+				}
+			}
+			if _, err := Decode(rb, d); err != ErrNeedMoreData {
+				t.Fatalf("expect ErrNeedMoreData but got %v", err)
+			}
+		}
+	}
+}
+
+func TestLengthFieldEncoder_OutOfRange(t *testing.T) {
+	e, _ := NewLengthFieldEncoder(1)
+	rb := ringbuffer.New(8)
+	if err := e.Encode(rb, make([]byte, 256)); err != ErrLengthOutOfRange {
+		t.Fatalf("expect ErrLengthOutOfRange but got %v", err)
+	}
+	if rb.Size() != 0 {
+		t.Fatalf("nothing should be written but got size %d", rb.Size())
+	}
+
+	e.LengthIncludesLengthFieldLength = true
+	if err := e.Encode(rb, make([]byte, 3)); err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := rb.ReadOneByte(); b != 4 {
+		t.Fatalf("expect length 4 but got %d", b)
+	}
+}
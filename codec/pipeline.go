@@ -0,0 +1,171 @@
+package codec
+
+import (
+	"github.com/zput/ringbuffer"
+)
+
+/*
+Decoder 从 rb 中解出一帧：
+
+- 只能通过 explore 游标读取数据(ExploreRead/ExploreSize/Peek(n, true)/ExplorePeek/ExploreNext)；
+- 不要调用 ExploreBegin/ExploreCommit/ExploreBreak，由 Chain/Pipeline 负责提交或者回滚；
+- 数据不足时返回 ErrNeedMoreData。
+
+单独使用一个 Decoder 时通过 Decode(rb, d) 调用，由它负责提交或者回滚。
+LengthFieldDecoder、DelimiterDecoder、VarintFramer 与 Chain 都实现了 Decoder。
+*/
+type Decoder interface {
+	Decode(rb *ringbuffer.RingBuffer) ([]byte, error)
+}
+
+// DecoderFunc 把一个函数转换成 Decoder。
+type DecoderFunc func(rb *ringbuffer.RingBuffer) ([]byte, error)
+
+func (f DecoderFunc) Decode(rb *ringbuffer.RingBuffer) ([]byte, error) {
+	return f(rb)
+}
+
+// Resetter 由保存了跨调用状态的 Decoder 实现(比如 DelimiterDecoder 的扫描进度)；
+// Chain 在把每一帧交给后面的 Decoder 之前调用 Reset，丢弃上一帧留下的状态。
+type Resetter interface {
+	Reset()
+}
+
+// Encoder 把一帧写入输出缓存 out。
+type Encoder interface {
+	Encode(out *ringbuffer.RingBuffer, frame []byte) error
+}
+
+// EncoderFunc 把一个函数转换成 Encoder。
+type EncoderFunc func(out *ringbuffer.RingBuffer, frame []byte) error
+
+func (f EncoderFunc) Encode(out *ringbuffer.RingBuffer, frame []byte) error {
+	return f(out, frame)
+}
+
+// Decode 在一次 explore 中执行 d：成功则 ExploreCommit，失败则 ExploreBreak，
+// 所以 d 中途失败时不会消费任何数据。
+// no thread safety guarantees
+func Decode(rb *ringbuffer.RingBuffer, d Decoder) ([]byte, error) {
+	return decode(rb, d.Decode)
+}
+
+/*
+Chain 按顺序执行多个 Decoder：
+
+	rb --decoders[0]--> frame --decoders[1]--> frame ... --decoders[n-1]--> frame
+
+第一个 Decoder 从 rb 中解出一帧，后面的 Decoder 再从上一个 Decoder 的帧中解出一帧；
+帧中没有被后面的 Decoder 读取的数据会被丢弃。
+任意一个 Decoder 失败时整个 Chain 失败，rb 中的数据不会被消费。
+后面的 Decoder 每次都从一个新的缓存中解码，实现了 Resetter 的会先被 Reset；
+没有实现 Resetter 的 Decoder 不能在帧之间保存状态。
+*/
+type Chain struct {
+	decoders []Decoder
+}
+
+// NewChain 返回按顺序执行 decoders 的 Chain。
+func NewChain(decoders ...Decoder) (*Chain, error) {
+	if len(decoders) == 0 {
+		return nil, ErrInitCodecParameter
+	}
+	return &Chain{decoders: decoders}, nil
+}
+
+// Decode 实现 Decoder：从 rb 中解出一帧，只移动 explore 游标；数据不足时返回 ErrNeedMoreData。
+// no thread safety guarantees
+func (c *Chain) Decode(rb *ringbuffer.RingBuffer) ([]byte, error) {
+	frame, err := c.decoders[0].Decode(rb)
+	if err != nil {
+		return nil, err
+	}
+	for _, d := range c.decoders[1:] {
+		if r, ok := d.(Resetter); ok {
+			r.Reset()
+		}
+		inner := ringbuffer.NewWithData(frame)
+		inner.ExploreBegin()
+		frame, err = d.Decode(inner)
+		if err == ErrNeedMoreData {
+			// 上一个 Decoder 给出的已经是完整的一帧，不会再有更多数据了
+			return nil, ErrCorruptedFrame
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return frame, nil
+}
+
+// Reset 实现 Resetter：Reset 所有实现了 Resetter 的 Decoder，Chain 可以嵌套在另一个 Chain 中。
+func (c *Chain) Reset() {
+	for _, d := range c.decoders {
+		if r, ok := d.(Resetter); ok {
+			r.Reset()
+		}
+	}
+}
+
+// Handler 处理一个解码后的帧；返回的 reply 不为 nil 时，由 Pipeline 编码后写入输出缓存。
+type Handler interface {
+	Handle(frame []byte) (reply []byte, err error)
+}
+
+// HandlerFunc 把一个函数转换成 Handler。
+type HandlerFunc func(frame []byte) (reply []byte, err error)
+
+func (f HandlerFunc) Handle(frame []byte) ([]byte, error) {
+	return f(frame)
+}
+
+/*
+Pipeline 把一个连接的输入缓存和输出缓存串起来：
+
+	in --Decoder--> frame --Handler--> reply --Encoder--> out
+*/
+type Pipeline struct {
+	Decoder Decoder
+	Handler Handler
+	Encoder Encoder // 为 nil 时丢弃 reply
+}
+
+// NewPipeline 返回一个 Pipeline；decoder 和 handler 不能为 nil。
+func NewPipeline(decoder Decoder, handler Handler, encoder Encoder) (*Pipeline, error) {
+	if decoder == nil || handler == nil {
+		return nil, ErrInitCodecParameter
+	}
+	return &Pipeline{
+		Decoder: decoder,
+		Handler: handler,
+		Encoder: encoder,
+	}, nil
+}
+
+// Run 从 in 中解出所有完整的帧并交给 Handler 处理，返回处理的帧数。
+// 剩下的不完整的帧留在 in 中，等待下一次 Run；
+// Decoder、Handler 或者 Encoder 出错时立即返回这个错误。
+// no thread safety guarantees
+func (p *Pipeline) Run(in, out *ringbuffer.RingBuffer) (n int, err error) {
+	for {
+		frame, err := Decode(in, p.Decoder)
+		if err == ErrNeedMoreData {
+			return n, nil
+		}
+		if err != nil {
+			return n, err
+		}
+		n++
+
+		reply, err := p.Handler.Handle(frame)
+		if err != nil {
+			return n, err
+		}
+		if reply == nil || p.Encoder == nil {
+			continue
+		}
+		if err = p.Encoder.Encode(out, reply); err != nil {
+			return n, err
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package codec
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/zput/ringbuffer"
+)
+
+func TestChain_Rollback(t *testing.T) {
+	length, _ := NewLengthFieldDecoder(1024, 0, 2, 0, 2)
+	line, _ := NewLineDecoder(1024, true)
+	chain, err := NewChain(length, line)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rb := ringbuffer.New(8)
+	_, _ = rb.Write([]byte("\x00\x06hello\n\x00\x03bad"))
+
+	frame, err := Decode(rb, chain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(frame) != "hello" {
+		t.Fatalf("expect hello but got %q", frame)
+	}
+
+	// 第二帧中没有换行符，第二个 Decoder 失败，整个帧不会被消费
+	size := rb.Size()
+	if _, err = Decode(rb, chain); err != ErrCorruptedFrame {
+		t.Fatalf("expect ErrCorruptedFrame but got %v", err)
+	}
+	if rb.Size() != size {
+		t.Fatalf("failed chain should not consume; expect size %d but got %d", size, rb.Size())
+	}
+}
+
+func TestChain_StatefulDecoder(t *testing.T) {
+	length, _ := NewLengthFieldDecoder(1024, 0, 2, 0, 2)
+	line, _ := NewLineDecoder(1024, true)
+	chain, _ := NewChain(length, line)
+
+	rb := ringbuffer.New(8)
+	_, _ = rb.Write([]byte("\x00\x03abc\x00\x05a\ncde"))
+	if _, err := Decode(rb, chain); err != ErrCorruptedFrame {
+		t.Fatalf("expect ErrCorruptedFrame but got %v", err)
+	}
+	// 跳过损坏的帧，上一帧的扫描状态不能影响下一帧
+	_, _ = rb.Discard(5)
+	if frame, err := Decode(rb, chain); err != nil || string(frame) != "a" {
+		t.Fatalf("expect a but got %q %v", frame, err)
+	}
+
+	// 实现了 Resetter 的 Decoder 在每一帧之前被 Reset
+	counter := &resetCounter{}
+	chain, _ = NewChain(length, counter)
+	_, _ = rb.Write([]byte("\x00\x01x\x00\x01y"))
+	for i := 1; i <= 2; i++ {
+		if _, err := Decode(rb, chain); err != nil || counter.resets != i {
+			t.Fatalf("expect %d resets but got %d %v", i, counter.resets, err)
+		}
+	}
+}
+
+type resetCounter struct {
+	resets int
+}
+
+func (r *resetCounter) Decode(rb *ringbuffer.RingBuffer) ([]byte, error) {
+	return ExploreNext(rb, rb.ExploreSize())
+}
+
+func (r *resetCounter) Reset() {
+	r.resets++
+}
+
+func TestDecode_PartialFailure(t *testing.T) {
+	// 读了一部分数据以后失败的 Decoder
+	var errBad = errors.New("bad")
+	d := DecoderFunc(func(rb *ringbuffer.RingBuffer) ([]byte, error) {
+		header, err := ExploreNext(rb, 2)
+		if err != nil {
+			return nil, err
+		}
+		if header[0] != 'O' {
+			return nil, errBad
+		}
+		return header, nil
+	})
+
+	rb := ringbuffer.New(8)
+	_, _ = rb.Write([]byte("NOOK"))
+	if _, err := Decode(rb, d); err != errBad {
+		t.Fatalf("expect errBad but got %v", err)
+	}
+	if !bytes.Equal(rb.ReadAll2NewByteSlice(), []byte("NOOK")) {
+		t.Fatalf("expect NOOK but got %q", rb.ReadAll2NewByteSlice())
+	}
+	rb.Retrieve(2)
+	frame, err := Decode(rb, d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(frame) != "OK" {
+		t.Fatalf("expect OK but got %q", frame)
+	}
+}
+
+func TestPipeline_Run(t *testing.T) {
+	decoder, _ := NewLengthFieldDecoder(1024, 0, 2, 0, 2)
+	encoder, _ := NewLengthFieldEncoder(2)
+	echo := HandlerFunc(func(frame []byte) ([]byte, error) {
+		if len(frame) == 0 {
+			// 空帧不回复
+			return nil, nil
+		}
+		return bytes.ToUpper(frame), nil
+	})
+	p, err := NewPipeline(decoder, echo, encoder)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	in, out := ringbuffer.New(4), ringbuffer.New(4)
+	for _, s := range []string{"ping", "", "ring"} {
+		_ = encoder.Encode(in, []byte(s))
+	}
+	_, _ = in.Write([]byte{0x00, 0x05, 'h'})
+
+	n, err := p.Run(in, out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 3 {
+		t.Fatalf("expect 3 frames but got %d", n)
+	}
+	if in.Size() != 3 {
+		t.Fatalf("partial frame should stay in buffer; got size %d", in.Size())
+	}
+	for _, s := range []string{"PING", "RING"} {
+		frame, err := Decode(out, decoder)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(frame) != s {
+			t.Fatalf("expect %s but got %q", s, frame)
+		}
+	}
+	if !out.IsEmpty() {
+		t.Fatalf("expect empty out buffer but got size %d", out.Size())
+	}
+}
@@ -0,0 +1,121 @@
+package codec
+
+import (
+	"encoding/binary"
+
+	"github.com/zput/ringbuffer"
+)
+
+/*
+VarintFramer 读写 protobuf 的 writeDelimitedTo/parseDelimitedFrom 格式：
+
+	+----------------+-----------------+
+	| uvarint length | message (bytes) |
+	+----------------+-----------------+
+
+与 LengthFieldDecoder 的 LengthFieldVarint 相比，Peek/Next 可以不拷贝地返回消息；
+声明的长度超过 MaxMessageLength 时立即返回 ErrFrameTooLong，不会等待消息到达，也不会分配内存。
+出错时不消费任何数据，此时流已经无法继续解析，通常应该关闭连接。
+*/
+type VarintFramer struct {
+	MaxMessageLength int // 消息(不包括长度前缀)的最大长度
+}
+
+// NewVarintFramer 返回一个 VarintFramer。
+func NewVarintFramer(maxMessageLength int) (*VarintFramer, error) {
+	if maxMessageLength <= 0 {
+		return nil, ErrInitCodecParameter
+	}
+	return &VarintFramer{MaxMessageLength: maxMessageLength}, nil
+}
+
+/*
+Peek 返回 rb 开头的一个完整消息，不消费任何数据；n 是包括长度前缀的总长度，之后用 rb.Discard(n) 消费。
+消息跨越缓存尾部时分成两段，first 在前、end 在后；直接引用 rb 的内存，只在下一次写入 rb 之前有效。
+no thread safety guarantees
+*/
+func (f *VarintFramer) Peek(rb *ringbuffer.RingBuffer) (first, end []byte, n int, err error) {
+	length, w, err := f.header(rb, false)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	n = w + length
+	if rb.Size() < n {
+		return nil, nil, 0, ErrNeedMoreData
+	}
+	first, end = rb.Peek(n, false)
+	if len(first) > w {
+		first = first[w:]
+	} else {
+		// 长度前缀在 first 中结束，或者本身跨越了缓存的尾部
+		first, end = end[w-len(first):], nil
+	}
+	return first, end, n, nil
+}
+
+// Next 与 Peek 相同，但是消费这个消息；返回的切片同样只在下一次写入 rb 之前有效。
+func (f *VarintFramer) Next(rb *ringbuffer.RingBuffer) (first, end []byte, err error) {
+	first, end, n, err := f.Peek(rb)
+	if err != nil {
+		return nil, nil, err
+	}
+	_, _ = rb.Discard(n)
+	return first, end, nil
+}
+
+// Decode 实现 Decoder：从 explore 游标处取出一个消息，拷贝到一段连续的新内存中，可以直接交给 proto.Unmarshal。
+// 消息不完整时返回 ErrNeedMoreData；通过 Decode(rb, f) 调用时，出错不会消费任何数据。
+// no thread safety guarantees
+func (f *VarintFramer) Decode(rb *ringbuffer.RingBuffer) ([]byte, error) {
+	length, w, err := f.header(rb, true)
+	if err != nil {
+		return nil, err
+	}
+	if rb.ExploreSize() < w+length {
+		return nil, ErrNeedMoreData
+	}
+	frame, err := ExploreNext(rb, w+length)
+	if err != nil {
+		return nil, err
+	}
+	return frame[w:], nil
+}
+
+// Encode 把长度前缀和 msg 依次写入 out。
+func (f *VarintFramer) Encode(out *ringbuffer.RingBuffer, msg []byte) error {
+	if len(msg) > f.MaxMessageLength {
+		return ErrFrameTooLong
+	}
+	var header [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(header[:], uint64(len(msg)))
+	if _, err := out.Write(header[:n]); err != nil {
+		return err
+	}
+	if _, err := out.Write(msg); err != nil {
+		return err
+	}
+	return nil
+}
+
+// header 读出长度前缀，返回消息的长度以及前缀的宽度，不移动读指针和 explore 游标。
+func (f *VarintFramer) header(rb *ringbuffer.RingBuffer, isUsingExplore bool) (length, w int, err error) {
+	var buf [binary.MaxVarintLen64]byte
+	first, end := rb.Peek(len(buf), isUsingExplore)
+	n := copy(buf[:], first)
+	n += copy(buf[n:], end)
+
+	v, w := binary.Uvarint(buf[:n])
+	if w == 0 {
+		if n < len(buf) {
+			return 0, 0, ErrNeedMoreData
+		}
+		return 0, 0, ErrCorruptedFrame
+	}
+	if w < 0 {
+		return 0, 0, ErrCorruptedFrame
+	}
+	if v > uint64(f.MaxMessageLength) {
+		return 0, 0, ErrFrameTooLong
+	}
+	return int(v), w, nil
+}
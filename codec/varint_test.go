@@ -0,0 +1,132 @@
+package codec
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/zput/ringbuffer"
+)
+
+// delimited 按照 writeDelimitedTo 的格式编码 msg。
+func delimited(msg []byte) []byte {
+	header := make([]byte, binary.MaxVarintLen64)
+	n := binary.PutUvarint(header, uint64(len(msg)))
+	return append(header[:n], msg...)
+}
+
+func TestVarintFramer_Next(t *testing.T) {
+	f, err := NewVarintFramer(1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	messages := [][]byte{
+		bytes.Repeat([]byte{'a'}, 200), // 两个字节的长度前缀
+		{},
+		[]byte("hello"),
+	}
+	var stream []byte
+	for _, msg := range messages {
+		stream = append(stream, delimited(msg)...)
+	}
+
+	// 一个字节一个字节地到达，在不同的位置跨越缓存的尾部
+	for offset := 0; offset < 8; offset++ {
+		rb := ringbuffer.New(256)
+		_, _ = rb.Write(make([]byte, 250+offset))
+		_, _ = rb.Read(make([]byte, 250+offset))
+
+		var got [][]byte
+		for i := 0; i < len(stream); i++ {
+			_ = rb.WriteOneByte(stream[i])
+			for {
+				size := rb.Size()
+				first, end, err := f.Next(rb)
+				if err == ErrNeedMoreData {
+					if rb.Size() != size {
+						t.Fatal("incomplete message should not be consumed")
+					}
+					break
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				got = append(got, append(append([]byte{}, first...), end...))
+			}
+		}
+		if len(got) != len(messages) {
+			t.Fatalf("offset %d: expect %d messages but got %d", offset, len(messages), len(got))
+		}
+		for i := range messages {
+			if !bytes.Equal(got[i], messages[i]) {
+				t.Fatalf("offset %d: message %d mismatch", offset, i)
+			}
+		}
+	}
+}
+
+func TestVarintFramer_ZeroCopy(t *testing.T) {
+	f, _ := NewVarintFramer(64)
+	rb := ringbuffer.New(16)
+	_, _ = rb.Write(make([]byte, 12))
+	_, _ = rb.Read(make([]byte, 12))
+	_ = f.Encode(rb, []byte("0123456789"))
+
+	first, end, n, err := f.Peek(rb)
+	if err != nil || n != 11 {
+		t.Fatalf("unexpected peek %d %v", n, err)
+	}
+	if string(first) != "012" || string(end) != "3456789" {
+		t.Fatalf("expect two segments but got %q %q", first, end)
+	}
+	// 直接引用缓存的内存
+	rbFirst, _ := rb.Peek(2, false)
+	if &rbFirst[1] != &first[0] {
+		t.Fatal("expect zero copy")
+	}
+	if rb.Size() != 11 {
+		t.Fatal("peek should not consume")
+	}
+
+	msg, err := Decode(rb, f)
+	if err != nil || string(msg) != "0123456789" || !rb.IsEmpty() {
+		t.Fatalf("unexpected message %q %v", msg, err)
+	}
+}
+
+func TestVarintFramer_Errors(t *testing.T) {
+	if _, err := NewVarintFramer(0); err != ErrInitCodecParameter {
+		t.Fatalf("expect ErrInitCodecParameter but got %v", err)
+	}
+	f, _ := NewVarintFramer(100)
+
+	cases := []struct {
+		input  []byte
+		expect error
+	}{
+		{nil, ErrNeedMoreData},
+		{[]byte{0x80}, ErrNeedMoreData},
+		{[]byte{5, 'a'}, ErrNeedMoreData},
+		// 声明的长度过大时不等待消息到达
+		{[]byte{101}, ErrFrameTooLong},
+		{[]byte{0xff, 0xff, 0xff, 0xff, 0x0f}, ErrFrameTooLong},
+		{bytes.Repeat([]byte{0x80}, binary.MaxVarintLen64), ErrCorruptedFrame},
+		{append(bytes.Repeat([]byte{0xff}, binary.MaxVarintLen64-1), 0x7f), ErrCorruptedFrame},
+	}
+	for _, c := range cases {
+		rb := ringbuffer.NewWithData(c.input)
+		if _, _, err := f.Next(rb); err != c.expect {
+			t.Fatalf("%x: expect %v but got %v", c.input, c.expect, err)
+		}
+		if _, err := Decode(rb, f); err != c.expect {
+			t.Fatalf("%x: expect %v but got %v", c.input, c.expect, err)
+		}
+		if rb.Size() != len(c.input) {
+			t.Fatalf("%x: nothing should be consumed", c.input)
+		}
+	}
+
+	if err := f.Encode(ringbuffer.New(8), make([]byte, 101)); err != ErrFrameTooLong {
+		t.Fatalf("expect ErrFrameTooLong but got %v", err)
+	}
+}
@@ -0,0 +1,210 @@
+package ringbuffer
+
+import (
+	"io"
+	"net"
+	"time"
+)
+
+const DefaultConnBufferSize = 4096
+
+// Close 写出输出缓存的默认期限，见 SetCloseTimeout。
+const DefaultCloseTimeout = 5 * time.Second
+
+/*
+Conn 包装一个 net.Conn：
+
+- 从 socket 读到的数据保存在输入缓存(inbound)中，可以 Peek/Explore/Next，方便解析协议；
+- 写入的数据先保存在输出缓存(outbound)中，调用 Flush 或者超过 highWaterMark 时才写到 socket。
+
+输入缓存和输出缓存互不影响：可以一个 goroutine 读，一个 goroutine 写；
+但是多个 goroutine 同时读(或者同时写)是不安全的。Close 会 Flush 输出缓存，算作一次写。
+*/
+type Conn struct {
+	net.Conn
+
+	inbound       *RingBuffer
+	outbound      *RingBuffer
+	highWaterMark int
+	closeTimeout  time.Duration
+	readBuf       []byte
+}
+
+// NewConn 返回一个 Conn；bufferSize 是 socket 每次读取的大小以及两个缓存的初始容量，
+// highWaterMark <= 0 时不会自动 Flush。
+func NewConn(conn net.Conn, bufferSize, highWaterMark int) *Conn {
+	if bufferSize <= 0 {
+		bufferSize = DefaultConnBufferSize
+	}
+	return &Conn{
+		Conn:          conn,
+		inbound:       New(bufferSize),
+		outbound:      New(bufferSize),
+		highWaterMark: highWaterMark,
+		closeTimeout:  DefaultCloseTimeout,
+		readBuf:       make([]byte, bufferSize),
+	}
+}
+
+// Inbound 返回输入缓存。
+func (this *Conn) Inbound() *RingBuffer {
+	return this.inbound
+}
+
+// Outbound 返回输出缓存。
+func (this *Conn) Outbound() *RingBuffer {
+	return this.outbound
+}
+
+// Buffered 返回输入缓存中还没有读取的字节数。
+func (this *Conn) Buffered() int {
+	return this.inbound.Size()
+}
+
+// Fill 从 socket 读取一次数据追加到输入缓存中，返回读到的字节数。
+func (this *Conn) Fill() (n int, err error) {
+	n, err = this.Conn.Read(this.readBuf)
+	if n > 0 {
+		_, _ = this.inbound.Write(this.readBuf[:n])
+	}
+	return
+}
+
+// fillAtLeast 不断从 socket 读取数据，直到输入缓存中至少有 n 个字节。
+func (this *Conn) fillAtLeast(n int) error {
+	for this.inbound.Size() < n {
+		if _, err := this.Fill(); err != nil {
+			if err == io.EOF && this.inbound.Size() > 0 {
+				return io.ErrUnexpectedEOF
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// Read 实现 io.Reader：输入缓存为空时才从 socket 读取。
+func (this *Conn) Read(p []byte) (n int, err error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	if this.inbound.IsEmpty() {
+		if _, err = this.Fill(); this.inbound.IsEmpty() {
+			return 0, err
+		}
+	}
+	return this.inbound.Read(p)
+}
+
+// Peek 返回输入缓存中的前 n 个字节，不移动读指针；数据不够时从 socket 读取(阻塞)。
+// 返回的切片指向缓存内部，在下一次读取 socket 之前有效。
+func (this *Conn) Peek(n int) (first []byte, end []byte, err error) {
+	err = this.fillAtLeast(n)
+	first, end = this.inbound.Peek(n, false)
+	return
+}
+
+// Next 读出输入缓存中的前 n 个字节；数据不够时从 socket 读取(阻塞)。
+// 数据在缓存中连续时直接返回缓存内部的切片，在下一次读取 socket 之前有效。
+func (this *Conn) Next(n int) ([]byte, error) {
+	if err := this.fillAtLeast(n); err != nil {
+		return nil, err
+	}
+	first, end := this.inbound.Peek(n, false)
+	if len(end) == 0 {
+		_, _ = this.inbound.Discard(n)
+		return first, nil
+	}
+	buf := make([]byte, n)
+	_, _ = this.inbound.Read(buf)
+	return buf, nil
+}
+
+// Discard 跳过输入缓存中的前 n 个字节；数据不够时从 socket 读取(阻塞)。
+func (this *Conn) Discard(n int) error {
+	if err := this.fillAtLeast(n); err != nil {
+		return err
+	}
+	_, _ = this.inbound.Discard(n)
+	return nil
+}
+
+// 下面的 Explore 系列函数只探索输入缓存中已有的数据，不会读取 socket；
+// 数据不够时先 ExploreBreak，调用 Fill 以后再重新开始。
+func (this *Conn) ExploreBegin() {
+	this.inbound.ExploreBegin()
+}
+
+func (this *Conn) ExploreRead(p []byte) (int, error) {
+	return this.inbound.ExploreRead(p)
+}
+
+func (this *Conn) ExploreSize() int {
+	return this.inbound.ExploreSize()
+}
+
+func (this *Conn) ExploreCommit() {
+	this.inbound.ExploreCommit()
+}
+
+func (this *Conn) ExploreBreak() {
+	this.inbound.ExploreBreak()
+}
+
+// Write 把 p 写入输出缓存；超过 highWaterMark 时自动 Flush。
+func (this *Conn) Write(p []byte) (n int, err error) {
+	n, err = this.outbound.Write(p)
+	if err != nil {
+		return
+	}
+	if this.highWaterMark > 0 && this.outbound.Size() >= this.highWaterMark {
+		err = this.Flush()
+	}
+	return
+}
+
+// Flush 把输出缓存中的数据全部写到 socket。
+func (this *Conn) Flush() error {
+	for !this.outbound.IsEmpty() {
+		first, end := this.outbound.PeekAll(false)
+		n, err := this.Conn.Write(first)
+		if n > 0 {
+			_, _ = this.outbound.Discard(n)
+		}
+		if err != nil {
+			return err
+		}
+		if len(end) == 0 || n < len(first) {
+			continue
+		}
+		n, err = this.Conn.Write(end)
+		if n > 0 {
+			_, _ = this.outbound.Discard(n)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SetCloseTimeout 设置 Close 写出输出缓存的期限，默认是 DefaultCloseTimeout；d <= 0 时不设期限。
+func (this *Conn) SetCloseTimeout(d time.Duration) {
+	this.closeTimeout = d
+}
+
+/*
+Close 先 Flush 输出缓存再关闭 socket。
+输出缓存不为空时，Flush 之前把 socket 的写期限设置为 SetCloseTimeout 指定的时间之后，对端不读取时也不会一直阻塞。
+无论 Flush 是否成功(包括超时)都会关闭 socket；Flush 失败时返回它的错误，没有写出的数据被丢弃。
+*/
+func (this *Conn) Close() error {
+	if this.closeTimeout > 0 && !this.outbound.IsEmpty() {
+		_ = this.Conn.SetWriteDeadline(time.Now().Add(this.closeTimeout))
+	}
+	err := this.Flush()
+	if cerr := this.Conn.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
@@ -0,0 +1,215 @@
+package ringbuffer
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestConn_interface(t *testing.T) {
+	c1, c2 := net.Pipe()
+	defer c1.Close()
+	defer c2.Close()
+
+	var _ net.Conn = NewConn(c1, 16, 0)
+}
+
+func TestConn_Pipe(t *testing.T) {
+	c1, c2 := net.Pipe()
+	defer c1.Close()
+
+	go func() {
+		// 一个字节一个字节地发送，模拟数据分多次到达
+		for _, b := range []byte("\x00\x05hello\x00\x05world") {
+			_, _ = c2.Write([]byte{b})
+		}
+		_ = c2.Close()
+	}()
+
+	conn := NewConn(c1, 4, 0)
+	for _, expect := range []string{"hello", "world"} {
+		first, end, err := conn.Peek(2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		length := int(append(first, end...)[1])
+		if err = conn.Discard(2); err != nil {
+			t.Fatal(err)
+		}
+		payload, err := conn.Next(length)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(payload) != expect {
+			t.Fatalf("expect %s but got %q", expect, payload)
+		}
+	}
+	if _, err := conn.Next(1); err != io.EOF {
+		t.Fatalf("expect io.EOF but got %v", err)
+	}
+}
+
+func TestConn_Explore(t *testing.T) {
+	c1, c2 := net.Pipe()
+	defer c1.Close()
+	defer c2.Close()
+
+	go func() {
+		_, _ = c2.Write([]byte("abc"))
+		_, _ = c2.Write([]byte("def"))
+	}()
+
+	conn := NewConn(c1, 16, 0)
+	buf := make([]byte, 4)
+	for {
+		conn.ExploreBegin()
+		if conn.ExploreSize() >= len(buf) {
+			break
+		}
+		conn.ExploreBreak()
+		if _, err := conn.Fill(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := conn.ExploreRead(buf); err != nil {
+		t.Fatal(err)
+	}
+	conn.ExploreCommit()
+	if string(buf) != "abcd" {
+		t.Fatalf("expect abcd but got %q", buf)
+	}
+	if conn.Buffered() != 2 {
+		t.Fatalf("expect 2 buffered bytes but got %d", conn.Buffered())
+	}
+}
+
+func TestConn_FlushHighWaterMark(t *testing.T) {
+	c1, c2 := net.Pipe()
+	defer c1.Close()
+	defer c2.Close()
+
+	received := make(chan []byte, 1)
+	go func() {
+		buf := make([]byte, 64)
+		n, _ := io.ReadFull(c2, buf[:8])
+		received <- buf[:n]
+	}()
+
+	conn := NewConn(c1, 4, 8)
+	_, _ = conn.Write([]byte("1234"))
+	if conn.Outbound().Size() != 4 {
+		t.Fatalf("expect 4 bytes buffered but got %d", conn.Outbound().Size())
+	}
+	// 达到 highWaterMark，自动 Flush
+	if _, err := conn.Write([]byte("5678")); err != nil {
+		t.Fatal(err)
+	}
+	if got := <-received; string(got) != "12345678" {
+		t.Fatalf("expect 12345678 but got %q", got)
+	}
+	if !conn.Outbound().IsEmpty() {
+		t.Fatalf("expect empty outbound but got %d", conn.Outbound().Size())
+	}
+}
+
+func TestConn_CloseFlushes(t *testing.T) {
+	c1, c2 := net.Pipe()
+	defer c2.Close()
+
+	received := make(chan []byte, 1)
+	go func() {
+		got, _ := ioutil.ReadAll(c2)
+		received <- got
+	}()
+
+	conn := NewConn(c1, 4, 0)
+	_, _ = conn.Write([]byte("unflushed"))
+	if err := conn.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if got := <-received; string(got) != "unflushed" {
+		t.Fatalf("expect unflushed but got %q", got)
+	}
+
+	// Flush 失败时返回它的错误，socket 同样被关闭
+	c1, c2 = net.Pipe()
+	_ = c2.Close()
+	conn = NewConn(c1, 4, 0)
+	_, _ = conn.Write([]byte("lost"))
+	if err := conn.Close(); err != io.ErrClosedPipe {
+		t.Fatalf("expect io.ErrClosedPipe but got %v", err)
+	}
+	if _, err := c1.Write([]byte("x")); err != io.ErrClosedPipe {
+		t.Fatalf("expect socket closed but got %v", err)
+	}
+}
+
+func TestConn_CloseTimeout(t *testing.T) {
+	c1, c2 := net.Pipe()
+	defer c2.Close()
+
+	// 对端不读取时，Close 在期限到了以后放弃输出缓存并关闭 socket
+	conn := NewConn(c1, 4, 0)
+	conn.SetCloseTimeout(20 * time.Millisecond)
+	_, _ = conn.Write([]byte("never read"))
+	runWithTimeout(t, time.Second, func() {
+		err := conn.Close()
+		if ne, ok := err.(net.Error); !ok || !ne.Timeout() {
+			t.Errorf("expect a timeout but got %v", err)
+		}
+	})
+	if _, err := c1.Write([]byte("x")); err != io.ErrClosedPipe {
+		t.Fatalf("expect socket closed but got %v", err)
+	}
+}
+
+func TestConn_Loopback(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skip(err)
+	}
+	defer l.Close()
+
+	go func() {
+		c, err := l.Accept()
+		if err != nil {
+			return
+		}
+		conn := NewConn(c, 8, 0)
+		defer conn.Close()
+		buf := make([]byte, 16)
+		for {
+			n, err := conn.Read(buf)
+			if err != nil {
+				return
+			}
+			_, _ = conn.Write(buf[:n])
+			if err = conn.Flush(); err != nil {
+				return
+			}
+		}
+	}()
+
+	c, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn := NewConn(c, 8, 0)
+	defer conn.Close()
+
+	msg := bytes.Repeat([]byte("loopback"), 100)
+	_, _ = conn.Write(msg)
+	if err = conn.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	got, err := conn.Next(len(msg))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, msg) {
+		t.Fatalf("expect %d bytes echoed but got %q", len(msg), got)
+	}
+}
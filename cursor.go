@@ -0,0 +1,238 @@
+package ringbuffer
+
+import (
+	"errors"
+	"io"
+)
+
+// 缓存中的数据被消费过(Read/Discard/ExploreCommit/其他 Cursor 的 Commit)，Cursor 的位置已经失效；
+// 调用 Reset 以后可以从新的读指针处重新开始。
+var ErrCursorStale = errors.New("cursor is stale; ring buffer cursor")
+
+var ErrInvalidSeek = errors.New("seek position is out of range; ring buffer cursor")
+
+/*
+Cursor 是一个独立的探索游标：
+
+  - 多个 Cursor 可以同时探索同一个缓存，互不影响，也不影响 Explore 系列函数；
+  - Savepoint/RollbackTo 可以嵌套地尝试解析，失败时回到之前的位置；
+  - Commit 把读指针移动到 Cursor 的位置，之后这个 Cursor 从新的读指针处继续，其他的 Cursor 全部失效。
+
+Cursor 记录的是相对读指针的偏移，写入数据、缓存扩容都不影响它；
+读指针被消费移动以后，Cursor 的所有操作都返回 ErrCursorStale，而不是读到错误的位置。
+
+Cursor 的操作会对缓存加锁(如果打开了锁)，但是一个 Cursor 不能同时在多个 goroutine 中使用。
+*/
+type Cursor struct {
+	rb  *RingBuffer
+	gen uint64
+	off int
+}
+
+// Savepoint 是 Cursor 的一个位置，只对创建它的 Cursor 有效。
+type Savepoint struct {
+	gen uint64
+	off int
+}
+
+// NewCursor 返回一个位于读指针处的 Cursor。
+// READ LOCK
+func (this *RingBuffer) NewCursor() *Cursor {
+	this.m.RLock()
+	defer this.m.RUnlock()
+
+	return &Cursor{rb: this, gen: this.readGen}
+}
+
+// peekAt 返回读指针之后偏移 off 处的 n 个字节；调用者保证 -hist <= off 并且 off+n 不超过 size()。
+// called by inside;  non lock
+func (this *RingBuffer) peekAt(off, n int) (first []byte, end []byte) {
+	if n <= 0 {
+		return
+	}
+	pos := (this.rIdx + off + this.cap) % this.cap
+	if pos+n <= this.cap {
+		first = this.buf[pos : pos+n]
+		return
+	}
+	first = this.buf[pos:this.cap]
+	end = this.buf[0 : n-this.cap+pos]
+	return
+}
+
+// called by inside;  non lock
+func (this *Cursor) check() error {
+	if this.gen != this.rb.readGen {
+		return ErrCursorStale
+	}
+	return nil
+}
+
+// Offset 返回 Cursor 相对读指针的偏移。
+func (this *Cursor) Offset() int {
+	return this.off
+}
+
+// Buffered 返回 Cursor 之后还没有探索的字节数；失效时返回 0。
+// READ LOCK
+func (this *Cursor) Buffered() int {
+	this.rb.m.RLock()
+	defer this.rb.m.RUnlock()
+
+	if this.check() != nil {
+		return 0
+	}
+	return this.rb.size() - this.off
+}
+
+// Read 实现 io.Reader：从 Cursor 处拷贝数据并移动 Cursor；没有数据时返回 ErrIsEmpty。
+// READ LOCK
+func (this *Cursor) Read(p []byte) (n int, err error) {
+	this.rb.m.RLock()
+	defer this.rb.m.RUnlock()
+
+	if err = this.check(); err != nil {
+		return 0, err
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+	n = this.rb.size() - this.off
+	if n == 0 {
+		return 0, ErrIsEmpty
+	}
+	if n > len(p) {
+		n = len(p)
+	}
+	first, end := this.rb.peekAt(this.off, n)
+	copy(p, first)
+	copy(p[len(first):], end)
+	this.off += n
+	return n, nil
+}
+
+/*
+Peek 返回 Cursor 处的 n 个字节，不移动 Cursor；跨越缓存尾部时分成两段，first 在前、end 在后。
+数据不够 n 个字节时返回 ErrNotEnoughData。
+返回的切片直接引用缓存的内存，只在下一次写入之前有效。
+*/
+// READ LOCK
+func (this *Cursor) Peek(n int) (first []byte, end []byte, err error) {
+	this.rb.m.RLock()
+	defer this.rb.m.RUnlock()
+
+	if err = this.check(); err != nil {
+		return nil, nil, err
+	}
+	if n < 0 || this.rb.size()-this.off < n {
+		return nil, nil, ErrNotEnoughData
+	}
+	first, end = this.rb.peekAt(this.off, n)
+	return first, end, nil
+}
+
+// Skip 把 Cursor 向后移动 n 个字节；数据不够时返回 ErrNotEnoughData。
+// READ LOCK
+func (this *Cursor) Skip(n int) error {
+	this.rb.m.RLock()
+	defer this.rb.m.RUnlock()
+
+	if err := this.check(); err != nil {
+		return err
+	}
+	if n < 0 || this.rb.size()-this.off < n {
+		return ErrNotEnoughData
+	}
+	this.off += n
+	return nil
+}
+
+// Seek 实现 io.Seeker，位置是相对读指针的偏移，只能在 [0, Size()] 之间。
+// READ LOCK
+func (this *Cursor) Seek(offset int64, whence int) (int64, error) {
+	this.rb.m.RLock()
+	defer this.rb.m.RUnlock()
+
+	if err := this.check(); err != nil {
+		return 0, err
+	}
+	size := int64(this.rb.size())
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += int64(this.off)
+	case io.SeekEnd:
+		offset += size
+	default:
+		return 0, ErrInvalidSeek
+	}
+	if offset < 0 || offset > size {
+		return 0, ErrInvalidSeek
+	}
+	this.off = int(offset)
+	return offset, nil
+}
+
+// Savepoint 记录 Cursor 当前的位置。
+func (this *Cursor) Savepoint() Savepoint {
+	return Savepoint{gen: this.gen, off: this.off}
+}
+
+// RollbackTo 回到 sp 的位置；Cursor 失效，或者 sp 是在上一次 Commit 之前记录的，都返回 ErrCursorStale。
+// READ LOCK
+func (this *Cursor) RollbackTo(sp Savepoint) error {
+	this.rb.m.RLock()
+	defer this.rb.m.RUnlock()
+
+	if err := this.check(); err != nil {
+		return err
+	}
+	if sp.gen != this.gen {
+		return ErrCursorStale
+	}
+	this.off = sp.off
+	return nil
+}
+
+// Commit 消费读指针到 Cursor 之间的数据；之后 Cursor 位于新的读指针处，其他的 Cursor 全部失效。
+// CONSUME LOCK
+func (this *Cursor) Commit() error {
+	this.rb.m.ConsumeLock()
+	defer this.rb.m.ConsumeUnlock()
+
+	return this.commit()
+}
+
+// called by inside;  non lock
+func (this *Cursor) commit() error {
+	if err := this.check(); err != nil {
+		return err
+	}
+	rb := this.rb
+	if this.off == 0 {
+		return nil
+	}
+	// 正在进行的 Explore 落在新的读指针之前时，把它移动到新的读指针处；
+	// 读完全部数据时 advanceRead 会结束 Explore，同样把它放回新的读指针处
+	inExplore := rb.inExplore
+	behind := inExplore && rb.size()-rb.exploreSize() < this.off
+	rb.advanceRead(this.off)
+	if inExplore && (behind || !rb.inExplore) {
+		rb.eprIdx = rb.rIdx
+		rb.episEmpty = rb.isEmpty
+		rb.inExplore = true
+	}
+	this.gen = rb.readGen
+	this.off = 0
+	return nil
+}
+
+// Reset 把 Cursor(包括失效的 Cursor)移动到当前的读指针处。
+// READ LOCK
+func (this *Cursor) Reset() {
+	this.rb.m.RLock()
+	defer this.rb.m.RUnlock()
+
+	this.gen = this.rb.readGen
+	this.off = 0
+}
@@ -0,0 +1,223 @@
+package ringbuffer
+
+import (
+	"io"
+	"io/ioutil"
+	"testing"
+)
+
+func TestCursor_Independent(t *testing.T) {
+	rb := New(8)
+	_, _ = rb.Write(make([]byte, 6))
+	_, _ = rb.Read(make([]byte, 6))
+	_, _ = rb.WriteString("abcdef")
+
+	sniffer := rb.NewCursor()
+	decoder := rb.NewCursor()
+	buf := make([]byte, 4)
+	if n, err := sniffer.Read(buf[:1]); n != 1 || err != nil || buf[0] != 'a' {
+		t.Fatalf("unexpected read %q %v", buf[:n], err)
+	}
+	if n, err := decoder.Read(buf); n != 4 || err != nil || string(buf) != "abcd" {
+		t.Fatalf("unexpected read %q %v", buf[:n], err)
+	}
+	// Explore 同样不受影响
+	rb.ExploreBegin()
+	if n, _ := rb.ExploreRead(buf[:1]); n != 1 || buf[0] != 'a' {
+		t.Fatalf("unexpected explore read %q", buf[:n])
+	}
+	rb.ExploreBreak()
+
+	// 跨越缓存尾部
+	first, end, err := sniffer.Peek(4)
+	if err != nil || string(first)+string(end) != "bcde" || len(end) == 0 {
+		t.Fatalf("unexpected peek %q %q %v", first, end, err)
+	}
+	if _, _, err = sniffer.Peek(6); err != ErrNotEnoughData {
+		t.Fatalf("expect ErrNotEnoughData but got %v", err)
+	}
+	if err = sniffer.Skip(6); err != ErrNotEnoughData || sniffer.Offset() != 1 {
+		t.Fatalf("expect ErrNotEnoughData without moving but got %v at %d", err, sniffer.Offset())
+	}
+	if err = sniffer.Skip(5); err != nil || sniffer.Buffered() != 0 {
+		t.Fatalf("unexpected skip %v %d", err, sniffer.Buffered())
+	}
+	if _, err = sniffer.Read(buf); err != ErrIsEmpty {
+		t.Fatalf("expect ErrIsEmpty but got %v", err)
+	}
+	if rb.Size() != 6 {
+		t.Fatalf("cursors should not consume; got size %d", rb.Size())
+	}
+}
+
+func TestCursor_Savepoint(t *testing.T) {
+	rb := New(4)
+	_, _ = rb.WriteString("header:body")
+	c := rb.NewCursor()
+
+	outer := c.Savepoint()
+	_ = c.Skip(7)
+	inner := c.Savepoint()
+	_ = c.Skip(2)
+	if err := c.RollbackTo(inner); err != nil || c.Offset() != 7 {
+		t.Fatalf("unexpected rollback %v %d", err, c.Offset())
+	}
+	if err := c.RollbackTo(outer); err != nil || c.Offset() != 0 {
+		t.Fatalf("unexpected rollback %v %d", err, c.Offset())
+	}
+
+	_ = c.Skip(7)
+	if err := c.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if got := string(rb.ReadAll2NewByteSlice()); got != "body" {
+		t.Fatalf("expect header consumed but left %q", got)
+	}
+	// Commit 之前的 savepoint 已经失效，Cursor 本身仍然可以使用
+	if err := c.RollbackTo(inner); err != ErrCursorStale {
+		t.Fatalf("expect ErrCursorStale but got %v", err)
+	}
+	buf := make([]byte, 4)
+	if n, err := c.Read(buf); n != 4 || err != nil || string(buf) != "body" {
+		t.Fatalf("unexpected read %q %v", buf[:n], err)
+	}
+	if err := c.Commit(); err != nil || !rb.IsEmpty() {
+		t.Fatalf("expect all consumed but got %v %d", err, rb.Size())
+	}
+}
+
+func TestCursor_Stale(t *testing.T) {
+	rb := New(4)
+	_, _ = rb.WriteString("abcd")
+	c := rb.NewCursor()
+	other := rb.NewCursor()
+	_ = c.Skip(1)
+
+	// 写入与扩容不会让 Cursor 失效
+	_, _ = rb.WriteString("efghijkl")
+	first, end, err := c.Peek(3)
+	if err != nil || string(first)+string(end) != "bcd" {
+		t.Fatalf("unexpected peek %q %q %v", first, end, err)
+	}
+
+	consumers := []func(){
+		func() { _ = other.Commit() },
+		func() { _, _ = rb.Read(make([]byte, 1)) },
+		func() { _, _ = rb.ReadByte() },
+		func() { rb.Retrieve(1) },
+		func() { rb.RetrieveAll() },
+		func() {
+			rb.ExploreBegin()
+			_, _ = rb.ExploreRead(make([]byte, 1))
+			rb.ExploreCommit()
+		},
+	}
+	for i, consume := range consumers {
+		_, _ = rb.WriteString("xyz")
+		c.Reset()
+		other.Reset()
+		_ = other.Skip(1)
+		consume()
+
+		if _, err = c.Read(make([]byte, 1)); err != ErrCursorStale {
+			t.Fatalf("%d: expect ErrCursorStale but got %v", i, err)
+		}
+		if _, _, err = c.Peek(1); err != ErrCursorStale {
+			t.Fatalf("%d: expect ErrCursorStale but got %v", i, err)
+		}
+		if err = c.Skip(0); err != ErrCursorStale {
+			t.Fatalf("%d: expect ErrCursorStale but got %v", i, err)
+		}
+		if err = c.Commit(); err != ErrCursorStale {
+			t.Fatalf("%d: expect ErrCursorStale but got %v", i, err)
+		}
+		if c.Buffered() != 0 {
+			t.Fatalf("%d: stale cursor should have nothing buffered", i)
+		}
+	}
+
+	// 没有移动读指针的 ExploreCommit 不会让 Cursor 失效
+	c.Reset()
+	rb.ExploreBegin()
+	rb.ExploreCommit()
+	if err = c.Skip(0); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCursor_Seek(t *testing.T) {
+	rb := New(8)
+	_, _ = rb.WriteString("0123456789")
+	c := rb.NewCursor()
+
+	cases := []struct {
+		offset int64
+		whence int
+		expect int64
+		err    error
+	}{
+		{3, io.SeekStart, 3, nil},
+		{2, io.SeekCurrent, 5, nil},
+		{-1, io.SeekEnd, 9, nil},
+		{0, io.SeekEnd, 10, nil},
+		{1, io.SeekEnd, 10, ErrInvalidSeek},
+		{-11, io.SeekCurrent, 10, ErrInvalidSeek},
+		{0, 3, 10, ErrInvalidSeek},
+	}
+	for _, cs := range cases {
+		pos, err := c.Seek(cs.offset, cs.whence)
+		if err != cs.err || (err == nil && pos != cs.expect) || c.Offset() != int(cs.expect) {
+			t.Fatalf("seek(%d, %d): expect %d %v but got %d %v", cs.offset, cs.whence, cs.expect, cs.err, pos, err)
+		}
+	}
+
+	_, _ = c.Seek(4, io.SeekStart)
+	rest, err := ioutil.ReadAll(io.LimitReader(c, 3))
+	if err != nil || string(rest) != "456" {
+		t.Fatalf("unexpected read %q %v", rest, err)
+	}
+}
+
+func TestCursor_CommitDuringExplore(t *testing.T) {
+	rb := New(8)
+	_, _ = rb.WriteString("abcdef")
+	buf := make([]byte, 4)
+
+	// Explore 落后于 Cursor 时被移动到新的读指针处
+	rb.ExploreBegin()
+	_, _ = rb.ExploreRead(buf[:1])
+	c := rb.NewCursor()
+	_ = c.Skip(3)
+	_ = c.Commit()
+	if rb.ExploreSize() != 3 {
+		t.Fatalf("expect explore moved to the read index but got %d", rb.ExploreSize())
+	}
+	// Explore 领先于 Cursor 时保持不变
+	_, _ = rb.ExploreRead(buf[:2])
+	_ = c.Skip(1)
+	_ = c.Commit()
+	if n, _ := rb.ExploreRead(buf); n != 1 || buf[0] != 'f' {
+		t.Fatalf("unexpected explore read %q", buf[:n])
+	}
+	rb.ExploreCommit()
+	if !rb.IsEmpty() {
+		t.Fatalf("expect empty but got size %d", rb.Size())
+	}
+
+	// Commit 全部数据也不会结束 Explore
+	_, _ = rb.WriteString("gh")
+	rb.ExploreBegin()
+	c.Reset()
+	_ = c.Skip(c.Buffered())
+	if err := c.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	_, _ = rb.WriteString("ij")
+	if n, err := rb.ExploreRead(buf); n != 2 || err != nil || string(buf[:n]) != "ij" {
+		t.Fatalf("unexpected explore read %q %v", buf[:n], err)
+	}
+	rb.ExploreCommit()
+	if !rb.IsEmpty() {
+		t.Fatalf("expect empty but got size %d", rb.Size())
+	}
+}
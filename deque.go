@@ -0,0 +1,155 @@
+package ringbuffer
+
+import "errors"
+
+/*
+双端操作，让 RingBuffer 可以当作字节的双端队列使用：
+
+  - WriteFront 把数据写到读指针之前，下一次读取先读到它们；
+  - ReadBack/PeekBack 从写指针一端读取；
+  - TruncateTail 撤销最后写入的数据。
+
+探索指针始终留在原来的字节上(被 ReadBack/TruncateTail 删掉时移动到末尾)；
+这些操作以后所有的 Cursor 都会失效。
+缓存中其他数据的偏移保持不变(见 WriteOffset 前面的说明)：WriteFront 写入的数据使用 ReadOffset() 之前的偏移，
+ReadBack 读出的数据与 TruncateTail 撤销的数据的偏移不会再使用，WriteOffset() 不变。
+*/
+
+// WriteFront 写入的字节数超过 ReadOffset()，读指针之前没有足够的偏移。
+var ErrOffsetUnderflow = errors.New("not enough offsets before the read offset; ring buffer")
+
+/*
+WriteFront 把 p 写到缓存的开头，p[0] 是下一个读出的字节；空间不够时扩容。
+ReadOffset() 减少 len(p)，其他数据的偏移不变；ReadOffset() < len(p) 时返回 ErrOffsetUnderflow，不写入任何数据。
+p 使用的偏移原来的字节已经被消费(或者从末尾删掉)，之前记录的指向它们的 WriteMark 在 PatchAt 时返回 ErrOffsetConsumed。
+读指针之前保留的历史数据(NewWithHistory)会被清空。
+*/
+// CONSUME LOCK
+func (this *RingBuffer) WriteFront(p []byte) (n int, err error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	this.m.ConsumeLock()
+	defer this.m.ConsumeUnlock()
+
+	n = len(p)
+	// 新写入的字节使用读指针之前的偏移
+	rOff := this.readOffset()
+	if rOff < uint64(n) {
+		return 0, ErrOffsetUnderflow
+	}
+	if rOff > this.frontEnd {
+		this.frontEnd = rOff
+	}
+	eprOff := this.exploreOffset()
+	// 历史数据紧挨在读指针之前，写到前面会覆盖它们；读指针之前的空洞也不再需要
+	this.hist = 0
+	this.pruneGaps()
+	if free := this.free(); free < n {
+		this.appendSpace(n - free)
+	}
+
+	this.rIdx = (this.rIdx - n + this.cap) % this.cap
+	if k := copy(this.buf[this.rIdx:this.cap], p); k < n {
+		copy(this.buf, p[k:])
+	}
+	this.isEmpty = false
+	this.readGen++
+	if eprOff >= 0 {
+		this.rebaseExplore(eprOff + n)
+	}
+	return n, nil
+}
+
+/*
+ReadBack 从缓存的末尾读出最多 len(p) 个字节，p[:n] 保持写入时的顺序；读出的字节的偏移不会再使用；缓存为空时返回 ErrIsEmpty。
+写事务中不能从末尾读取，返回 ErrInWriteTx。
+*/
+// CONSUME LOCK
+func (this *RingBuffer) ReadBack(p []byte) (n int, err error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	this.m.ConsumeLock()
+	defer this.m.ConsumeUnlock()
+
+	if this.inWrite {
+		return 0, ErrInWriteTx
+	}
+	if this.isEmpty {
+		return 0, ErrIsEmpty
+	}
+	n = this.size()
+	if n > len(p) {
+		n = len(p)
+	}
+	first, end := this.peekAt(this.size()-n, n)
+	copy(p, first)
+	copy(p[len(first):], end)
+	this.cutTail(n)
+	return n, nil
+}
+
+/*
+PeekBack 返回缓存末尾的 n 个字节，不消费；跨越缓存尾部时分成两段，first 在前、end 在后。
+数据不够 n 个字节时返回 ErrNotEnoughData。
+返回的切片直接引用缓存的内存，只在下一次写入之前有效。
+*/
+// READ LOCK
+func (this *RingBuffer) PeekBack(n int) (first []byte, end []byte, err error) {
+	this.m.RLock()
+	defer this.m.RUnlock()
+
+	if n < 0 {
+		return nil, nil, ErrNegativeCount
+	}
+	size := this.size()
+	if n > size {
+		return nil, nil, ErrNotEnoughData
+	}
+	first, end = this.peekAt(size-n, n)
+	return first, end, nil
+}
+
+/*
+TruncateTail 撤销最后写入的 n 个字节，它们的偏移不会再使用，WriteOffset() 不变；数据不够时返回 ErrNotEnoughData，缓存不变。
+写事务中返回 ErrInWriteTx，撤销未提交的数据使用 WriteRollback。
+*/
+// CONSUME LOCK
+func (this *RingBuffer) TruncateTail(n int) error {
+	this.m.ConsumeLock()
+	defer this.m.ConsumeUnlock()
+
+	if this.inWrite {
+		return ErrInWriteTx
+	}
+	if n < 0 {
+		return ErrNegativeCount
+	}
+	if n > this.size() {
+		return ErrNotEnoughData
+	}
+	if n == 0 {
+		return nil
+	}
+	this.cutTail(n)
+	return nil
+}
+
+// cutTail 把写指针向前移动 n 个字节，被删掉的偏移记录为空洞；调用者保证 0 < n <= size()。
+// called by inside;  non lock
+func (this *RingBuffer) cutTail(n int) {
+	eprOff := this.exploreOffset()
+	if n == this.size() {
+		this.isEmpty = true
+	}
+	this.wIdx = (this.wIdx - n + this.cap) % this.cap
+	this.removeOffsets(n)
+	this.readGen++
+	// 探索过的数据被删掉时，探索指针移动到新的末尾
+	if eprOff >= 0 {
+		this.rebaseExplore(eprOff)
+	}
+}
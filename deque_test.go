@@ -0,0 +1,319 @@
+package ringbuffer
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+)
+
+func TestDeque_WriteFront(t *testing.T) {
+	rb := New(4)
+	for i := 0; i < 2; i++ {
+		_, _ = rb.WriteString("0000")
+		_, _ = rb.Read(make([]byte, 4))
+	}
+	_, _ = rb.WriteString("cd")
+	_, _ = rb.ReadByte()
+	if n, err := rb.WriteFront([]byte("ab")); n != 2 || err != nil {
+		t.Fatalf("unexpected write front %d %v", n, err)
+	}
+	if got := string(rb.ReadAll2NewByteSlice()); got != "abd" {
+		t.Fatalf("expect abd but got %q", got)
+	}
+	// 跨越缓存开头，并且需要扩容
+	if _, err := rb.WriteFront([]byte("0123")); err != nil {
+		t.Fatal(err)
+	}
+	if got := string(rb.ReadAll2NewByteSlice()); got != "0123abd" {
+		t.Fatalf("expect 0123abd but got %q", got)
+	}
+	if rb.ReadOffset() != 3 || rb.WriteOffset() != 10 {
+		t.Fatalf("unexpected offsets %d/%d", rb.ReadOffset(), rb.WriteOffset())
+	}
+	// 读指针之前没有足够的偏移
+	if n, err := rb.WriteFront([]byte("wxyz")); n != 0 || err != ErrOffsetUnderflow {
+		t.Fatalf("expect ErrOffsetUnderflow but got %d %v", n, err)
+	}
+	if got := string(rb.ReadAll2NewByteSlice()); got != "0123abd" || rb.ReadOffset() != 3 {
+		t.Fatalf("expect 0123abd but got %q", got)
+	}
+
+	// 空缓存
+	rb = New(4)
+	if _, err := rb.WriteFront([]byte("x")); err != ErrOffsetUnderflow {
+		t.Fatalf("expect ErrOffsetUnderflow but got %v", err)
+	}
+	_, _ = rb.WriteString("ab")
+	_, _ = rb.Read(make([]byte, 2))
+	_, _ = rb.WriteFront([]byte("xy"))
+	_, _ = rb.WriteString("z")
+	if got := string(rb.ReadAll2NewByteSlice()); got != "xyz" {
+		t.Fatalf("expect xyz but got %q", got)
+	}
+
+	// 历史数据被清空
+	rb = NewWithHistory(8, 8)
+	_, _ = rb.WriteString("abc")
+	_, _ = rb.Read(make([]byte, 3))
+	_, _ = rb.WriteFront([]byte("h"))
+	if rb.HistorySize() != 0 || rb.Rewind(1) != ErrNotEnoughHistory {
+		t.Fatalf("expect history cleared but got %d", rb.HistorySize())
+	}
+}
+
+func TestDeque_Back(t *testing.T) {
+	rb := New(4)
+	_, _ = rb.Write(make([]byte, 3))
+	_, _ = rb.Read(make([]byte, 3))
+	_, _ = rb.WriteString("abcd")
+
+	first, end, err := rb.PeekBack(3)
+	if err != nil || string(first)+string(end) != "bcd" {
+		t.Fatalf("unexpected peek back %q %q %v", first, end, err)
+	}
+	if _, _, err = rb.PeekBack(5); err != ErrNotEnoughData {
+		t.Fatalf("expect ErrNotEnoughData but got %v", err)
+	}
+
+	buf := make([]byte, 2)
+	if n, err := rb.ReadBack(buf); n != 2 || err != nil || string(buf) != "cd" {
+		t.Fatalf("unexpected read back %q %v", buf[:n], err)
+	}
+	if rb.ReadOffset() != 3 || rb.WriteOffset() != 7 {
+		t.Fatalf("unexpected offsets %d/%d", rb.ReadOffset(), rb.WriteOffset())
+	}
+
+	if err = rb.TruncateTail(3); err != ErrNotEnoughData {
+		t.Fatalf("expect ErrNotEnoughData but got %v", err)
+	}
+	if err = rb.TruncateTail(1); err != nil || rb.WriteOffset() != 7 {
+		t.Fatalf("unexpected truncate %v %d", err, rb.WriteOffset())
+	}
+	_, _ = rb.WriteString("xyz")
+	if got := string(rb.ReadAll2NewByteSlice()); got != "axyz" {
+		t.Fatalf("expect axyz but got %q", got)
+	}
+
+	if n, err := rb.ReadBack(make([]byte, 8)); n != 4 || err != nil || !rb.IsEmpty() {
+		t.Fatalf("unexpected read back %d %v", n, err)
+	}
+	if _, err = rb.ReadBack(buf); err != ErrIsEmpty {
+		t.Fatalf("expect ErrIsEmpty but got %v", err)
+	}
+}
+
+func TestDeque_ReadBackOffsets(t *testing.T) {
+	rb := New(8)
+	_, _ = rb.WriteString("xx")
+	mark := rb.MarkWrite()
+	_, _ = rb.WriteString("HHHHbody")
+
+	if n, err := rb.ReadBack(make([]byte, 2)); n != 2 || err != nil {
+		t.Fatalf("unexpected read back %d %v", n, err)
+	}
+	// ReadBack 之后其他数据的偏移不变
+	first, end, err := rb.PeekAbs(mark.Offset(), 4)
+	if err != nil || string(first)+string(end) != "HHHH" {
+		t.Fatalf("unexpected peek %q %q %v", first, end, err)
+	}
+	if err = rb.PatchAt(mark, []byte("AAAA")); err != nil {
+		t.Fatal(err)
+	}
+	if got := string(rb.ReadAll2NewByteSlice()); got != "xxAAAAbo" {
+		t.Fatalf("expect xxAAAAbo but got %q", got)
+	}
+	// 读出的字节的偏移不会再使用
+	if err = rb.PatchAt(WriteMark{off: 7}, []byte("dy")); err != ErrOffsetRemoved {
+		t.Fatalf("expect ErrOffsetRemoved but got %v", err)
+	}
+	if err = rb.PatchAt(WriteMark{off: 10}, []byte("d")); err != ErrNotEnoughData {
+		t.Fatalf("expect ErrNotEnoughData but got %v", err)
+	}
+}
+
+func TestDeque_Explore(t *testing.T) {
+	rb := New(8)
+	_, _ = rb.WriteString("zzabcdef")
+	_, _ = rb.Read(make([]byte, 2))
+	c := rb.NewCursor()
+
+	rb.ExploreBegin()
+	_, _ = rb.ExploreDiscard(2)
+	_, _ = rb.WriteFront([]byte("01"))
+	if b, _ := rb.PeekByte(true); b != 'c' {
+		t.Fatalf("expect explore stays on c but got %c", b)
+	}
+	if err := c.Skip(0); err != ErrCursorStale {
+		t.Fatalf("expect ErrCursorStale but got %v", err)
+	}
+	// 探索过的数据被删掉，探索指针移动到末尾
+	_ = rb.TruncateTail(5)
+	if rb.ExploreSize() != 0 {
+		t.Fatalf("expect explore at the end but got %d", rb.ExploreSize())
+	}
+	_, _ = rb.WriteString("g")
+	if b, _ := rb.PeekByte(true); b != 'g' {
+		t.Fatalf("expect g but got %c", b)
+	}
+	rb.ExploreCommit()
+	if got := string(rb.ReadAll2NewByteSlice()); got != "g" {
+		t.Fatalf("expect g but got %q", got)
+	}
+}
+
+// TestDeque_WriteMark 确认 WriteFront/TruncateTail/ReadBack 之前记录的 WriteMark 仍然回填同一个字节，或者被拒绝。
+func TestDeque_WriteMark(t *testing.T) {
+	rb := New(8)
+	_, _ = rb.WriteString("zzzz")
+	_, _ = rb.Read(make([]byte, 4))
+	mark := rb.MarkWrite()
+	_, _ = rb.WriteString("LL")
+	body := rb.MarkWrite()
+	_, _ = rb.WriteString("body")
+
+	// WriteFront 之后 mark 仍然指向 LL
+	if _, err := rb.WriteFront([]byte("ab")); err != nil {
+		t.Fatal(err)
+	}
+	if err := rb.PatchAt(mark, []byte("12")); err != nil {
+		t.Fatal(err)
+	}
+	if got := string(rb.ReadAll2NewByteSlice()); got != "ab12body" {
+		t.Fatalf("expect ab12body but got %q", got)
+	}
+
+	// TruncateTail 删掉 body 以后重新写入的字节使用新的偏移，不会被回填
+	_ = rb.TruncateTail(4)
+	_, _ = rb.WriteString("tail")
+	if err := rb.PatchAt(body, []byte("BODY")); err != ErrOffsetRemoved {
+		t.Fatalf("expect ErrOffsetRemoved but got %v", err)
+	}
+	if n := rb.WrittenSince(body); n != 4 {
+		t.Fatalf("expect 4 written since the removed mark but got %d", n)
+	}
+	if err := rb.PatchAt(mark, []byte("34")); err != nil {
+		t.Fatal(err)
+	}
+	if got := string(rb.ReadAll2NewByteSlice()); got != "ab34tail" {
+		t.Fatalf("expect ab34tail but got %q", got)
+	}
+
+	// ReadBack 只删掉 mark 之后的一部分字节
+	tail := WriteMark{off: body.Offset() + 4}
+	_, _ = rb.ReadBack(make([]byte, 2))
+	if err := rb.PatchAt(tail, []byte("TAIL")); err != ErrOffsetRemoved {
+		t.Fatalf("expect ErrOffsetRemoved but got %v", err)
+	}
+	if err := rb.PatchAt(tail, []byte("TA")); err != nil {
+		t.Fatal(err)
+	}
+	if got := string(rb.ReadAll2NewByteSlice()); got != "ab34TA" {
+		t.Fatalf("expect ab34TA but got %q", got)
+	}
+
+	// body 中被删掉的字节的偏移被 WriteFront 重新使用
+	_, _ = rb.Read(make([]byte, 4))
+	if _, err := rb.WriteFront([]byte("AB")); err != nil {
+		t.Fatal(err)
+	}
+	if err := rb.PatchAt(WriteMark{off: body.Offset() + 2}, []byte("x")); err != ErrOffsetConsumed {
+		t.Fatalf("expect ErrOffsetConsumed but got %v", err)
+	}
+	if got := string(rb.ReadAll2NewByteSlice()); got != "ABTA" {
+		t.Fatalf("expect ABTA but got %q", got)
+	}
+}
+
+// TestDeque_Model 随机地在两端读写，与一个切片对比；同时对比每个字节的偏移。
+func TestDeque_Model(t *testing.T) {
+	for seed := int64(0); seed < 100; seed++ {
+		r := rand.New(rand.NewSource(seed))
+		rb := New(1 + r.Intn(8))
+		var model []byte
+		var offs, removed []uint64
+		var wOff uint64
+		var counter byte
+		next := func(n int) []byte {
+			p := make([]byte, n)
+			for i := range p {
+				counter++
+				p[i] = counter
+			}
+			return p
+		}
+		cut := func(n int) {
+			removed = append(removed, offs[len(offs)-n:]...)
+			model = model[:len(model)-n]
+			offs = offs[:len(offs)-n]
+		}
+
+		for step := 0; step < 300; step++ {
+			switch r.Intn(5) {
+			case 0:
+				p := next(r.Intn(10))
+				_, _ = rb.Write(p)
+				model = append(model, p...)
+				for range p {
+					offs = append(offs, wOff)
+					wOff++
+				}
+			case 1:
+				p := next(r.Intn(10))
+				rOff := rb.ReadOffset()
+				if _, err := rb.WriteFront(p); err == nil {
+					model = append(append([]byte{}, p...), model...)
+					front := make([]uint64, len(p))
+					for i := range front {
+						front[i] = rOff - uint64(len(p)-i)
+					}
+					offs = append(front, offs...)
+					// 被删掉的偏移可以被 WriteFront 重新使用
+					kept := removed[:0]
+					for _, off := range removed {
+						if off < rOff-uint64(len(p)) || off >= rOff {
+							kept = append(kept, off)
+						}
+					}
+					removed = kept
+				} else if rOff >= uint64(len(p)) {
+					t.Fatalf("seed %d: write front %d bytes at %d: %v", seed, len(p), rOff, err)
+				}
+			case 2:
+				p := make([]byte, r.Intn(10))
+				n, _ := rb.Read(p)
+				if !bytes.Equal(p[:n], model[:n]) {
+					t.Fatalf("seed %d: read %v but expect %v", seed, p[:n], model[:n])
+				}
+				model = model[n:]
+				offs = offs[n:]
+			case 3:
+				p := make([]byte, r.Intn(10))
+				n, _ := rb.ReadBack(p)
+				if !bytes.Equal(p[:n], model[len(model)-n:]) {
+					t.Fatalf("seed %d: read back %v but expect %v", seed, p[:n], model[len(model)-n:])
+				}
+				cut(n)
+			default:
+				if n := r.Intn(10); rb.TruncateTail(n) == nil {
+					cut(n)
+				}
+			}
+			if got := rb.ReadAll2NewByteSlice(); !bytes.Equal(got, model) || rb.Size() != len(model) {
+				t.Fatalf("seed %d: content %v but expect %v", seed, got, model)
+			}
+			if rb.WriteOffset() != wOff || (len(offs) > 0 && rb.ReadOffset() != offs[0]) {
+				t.Fatalf("seed %d: offsets %d/%d but expect %v/%d", seed, rb.ReadOffset(), rb.WriteOffset(), offs, wOff)
+			}
+			for i, off := range offs {
+				if first, _, err := rb.PeekAbs(off, 1); err != nil || first[0] != model[i] {
+					t.Fatalf("seed %d: byte at %d is %v %v but expect %d", seed, off, first, err, model[i])
+				}
+			}
+			for _, off := range removed {
+				if _, _, err := rb.PeekAbs(off, 1); off >= rb.ReadOffset() && err != ErrOffsetRemoved {
+					t.Fatalf("seed %d: expect %d removed but got %v", seed, off, err)
+				}
+			}
+		}
+	}
+}
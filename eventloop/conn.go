@@ -0,0 +1,60 @@
+//go:build linux
+// +build linux
+
+package eventloop
+
+import (
+	"net"
+
+	"github.com/zput/ringbuffer"
+)
+
+// Conn 是事件循环中的一个连接；它的方法只能在 Handler 的回调中调用。
+type Conn struct {
+	fd       int
+	inbound  *ringbuffer.RingBuffer
+	outbound *ringbuffer.RingBuffer
+	local    net.Addr
+	remote   net.Addr
+
+	events     uint32 // 在 epoll 中注册的事件
+	readClosed bool   // 对端已经关闭了写端，不再读取
+	closing    bool
+	closed     bool
+
+	// Context 保存用户自己的数据，例如每个连接的解码器
+	Context interface{}
+}
+
+// Inbound 返回输入缓存；从 socket 读到的数据追加在这里，处理过的数据需要自己消费掉。
+func (c *Conn) Inbound() *ringbuffer.RingBuffer {
+	return c.inbound
+}
+
+// Outbound 返回输出缓存；回调返回后事件循环会把其中的数据写到 socket。
+func (c *Conn) Outbound() *ringbuffer.RingBuffer {
+	return c.outbound
+}
+
+// Write 把 p 写入输出缓存。
+func (c *Conn) Write(p []byte) (int, error) {
+	return c.outbound.Write(p)
+}
+
+// Close 在输出缓存中的数据写完以后关闭连接。
+func (c *Conn) Close() error {
+	c.closing = true
+	return nil
+}
+
+func (c *Conn) Fd() int {
+	return c.fd
+}
+
+func (c *Conn) LocalAddr() net.Addr {
+	return c.local
+}
+
+func (c *Conn) RemoteAddr() net.Addr {
+	return c.remote
+}
@@ -0,0 +1,7 @@
+// Package eventloop 是一个基于 epoll 的事件循环(仅支持 Linux)。
+//
+// 每个连接有一个输入缓存和一个输出缓存(ringbuffer.RingBuffer)：
+// socket 可读时数据被读入输入缓存，然后调用 Handler.OnTraffic；
+// Handler 写入的数据先保存在输出缓存中，socket 可写时再写出去。
+// 对端关闭写端(半关闭)以后，输出缓存中的数据仍然会写完，然后才关闭连接。
+package eventloop
@@ -0,0 +1,390 @@
+//go:build linux
+// +build linux
+
+package eventloop
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/zput/ringbuffer"
+)
+
+const (
+	DefaultBufferSize = 4096
+	readBufferSize    = 64 * 1024
+	maxEvents         = 128
+	// accept 因为 fd 或者内存不够失败时，监听 socket 暂停这么久再恢复
+	acceptBackoff = 100 * time.Millisecond
+)
+
+var ErrServerShutdown = errors.New("server is shutting down; event loop")
+var ErrLoopIsRunning = errors.New("event loop is already running; event loop")
+
+// Handler 处理连接上的事件，所有的回调都在事件循环的 goroutine 中执行，不要在回调中阻塞。
+type Handler interface {
+	// OnOpen 在连接建立后调用。
+	OnOpen(c *Conn)
+	// OnTraffic 在输入缓存中有新数据时调用；没有处理完的数据留在输入缓存中，下次继续处理。
+	OnTraffic(c *Conn)
+	// OnClose 在连接关闭后调用；对端正常关闭时 err 为 nil。
+	OnClose(c *Conn, err error)
+}
+
+/*
+EventLoop 在一个 goroutine 中用 epoll 处理监听 socket 和所有连接：
+
+	Listen --> Run(阻塞) --> Stop
+*/
+type EventLoop struct {
+	handler    Handler
+	bufferSize int
+
+	epfd    int
+	lfd     int
+	wakeFds [2]int // Stop 通过写管道唤醒 epoll_wait
+	fdsLock sync.Mutex
+	addr    net.Addr
+
+	conns   map[int]*Conn
+	readBuf []byte
+	running int32
+	stopped int32
+
+	// 非零时监听 socket 已经从 epoll 中移除，到这个时间再加回去
+	acceptPausedUntil time.Time
+}
+
+// Listen 在 addr(tcp) 上监听，返回一个还没有运行的 EventLoop；
+// bufferSize 是每个连接的输入/输出缓存的初始容量，<= 0 时使用 DefaultBufferSize。
+func Listen(addr string, handler Handler, bufferSize int) (el *EventLoop, err error) {
+	if handler == nil {
+		return nil, errors.New("handler is nil; event loop")
+	}
+	if bufferSize <= 0 {
+		bufferSize = DefaultBufferSize
+	}
+	el = &EventLoop{
+		handler:    handler,
+		bufferSize: bufferSize,
+		epfd:       -1,
+		lfd:        -1,
+		wakeFds:    [2]int{-1, -1},
+		conns:      make(map[int]*Conn),
+		readBuf:    make([]byte, readBufferSize),
+	}
+	defer func() {
+		if err != nil {
+			el.closeFds()
+		}
+	}()
+
+	if el.lfd, el.addr, err = listen(addr); err != nil {
+		return nil, err
+	}
+	if el.epfd, err = syscall.EpollCreate1(syscall.EPOLL_CLOEXEC); err != nil {
+		return nil, err
+	}
+	if err = syscall.Pipe2(el.wakeFds[:], syscall.O_NONBLOCK|syscall.O_CLOEXEC); err != nil {
+		return nil, err
+	}
+	if err = el.epollCtl(syscall.EPOLL_CTL_ADD, el.lfd, syscall.EPOLLIN); err != nil {
+		return nil, err
+	}
+	if err = el.epollCtl(syscall.EPOLL_CTL_ADD, el.wakeFds[0], syscall.EPOLLIN); err != nil {
+		return nil, err
+	}
+	return el, nil
+}
+
+// Addr 返回监听的地址。
+func (el *EventLoop) Addr() net.Addr {
+	return el.addr
+}
+
+// Run 运行事件循环，直到 Stop 被调用或者出错；返回前会关闭所有连接。
+func (el *EventLoop) Run() error {
+	if !atomic.CompareAndSwapInt32(&el.running, 0, 1) {
+		return ErrLoopIsRunning
+	}
+	defer func() {
+		for fd, c := range el.conns {
+			el.closeConn(fd, c, ErrServerShutdown)
+		}
+		el.closeFds()
+	}()
+
+	events := make([]syscall.EpollEvent, maxEvents)
+	for {
+		timeout := -1
+		if !el.acceptPausedUntil.IsZero() {
+			timeout = int(time.Until(el.acceptPausedUntil)/time.Millisecond) + 1
+			if timeout < 0 {
+				timeout = 0
+			}
+		}
+		n, err := syscall.EpollWait(el.epfd, events, timeout)
+		el.resumeAccept()
+		if err == syscall.EINTR {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		for i := 0; i < n; i++ {
+			fd := int(events[i].Fd)
+			switch fd {
+			case el.lfd:
+				el.accept()
+			case el.wakeFds[0]:
+				if atomic.LoadInt32(&el.stopped) == 1 {
+					return nil
+				}
+			default:
+				if c, ok := el.conns[fd]; ok {
+					el.handleEvent(c, events[i].Events)
+				}
+			}
+		}
+	}
+}
+
+// Stop 通知事件循环退出；可以在任意 goroutine 中调用。
+func (el *EventLoop) Stop() error {
+	if !atomic.CompareAndSwapInt32(&el.stopped, 0, 1) {
+		return nil
+	}
+	el.fdsLock.Lock()
+	defer el.fdsLock.Unlock()
+
+	if el.wakeFds[1] < 0 {
+		// 事件循环已经退出了
+		return nil
+	}
+	_, err := syscall.Write(el.wakeFds[1], []byte{1})
+	return err
+}
+
+func (el *EventLoop) accept() {
+	for {
+		fd, sa, err := syscall.Accept4(el.lfd, syscall.SOCK_NONBLOCK|syscall.SOCK_CLOEXEC)
+		switch err {
+		case nil:
+		case syscall.EAGAIN:
+			// 已经没有等待的连接了
+			return
+		case syscall.EINTR, syscall.ECONNABORTED:
+			// 连接在 accept 之前被对端重置了，跳过它
+			continue
+		default:
+			// EMFILE/ENFILE/ENOBUFS/ENOMEM 等：等待的连接还在队列中，监听 socket 一直可读，
+			// 水平触发的 epoll 会不停地返回它；暂时把它移出 epoll，acceptBackoff 以后再试
+			el.pauseAccept()
+			return
+		}
+		if err = el.epollCtl(syscall.EPOLL_CTL_ADD, fd, syscall.EPOLLIN|syscall.EPOLLRDHUP); err != nil {
+			_ = syscall.Close(fd)
+			continue
+		}
+		c := &Conn{
+			fd:       fd,
+			events:   syscall.EPOLLIN | syscall.EPOLLRDHUP,
+			inbound:  ringbuffer.New(el.bufferSize),
+			outbound: ringbuffer.New(el.bufferSize),
+			local:    el.addr,
+			remote:   sockaddrToAddr(sa),
+		}
+		el.conns[fd] = c
+		el.handler.OnOpen(c)
+		el.afterCallback(c)
+	}
+}
+
+// pauseAccept 把监听 socket 移出 epoll，acceptBackoff 以后由 resumeAccept 加回去。
+func (el *EventLoop) pauseAccept() {
+	if err := syscall.EpollCtl(el.epfd, syscall.EPOLL_CTL_DEL, el.lfd, nil); err != nil {
+		return
+	}
+	el.acceptPausedUntil = time.Now().Add(acceptBackoff)
+}
+
+// resumeAccept 在暂停的时间到了以后把监听 socket 加回 epoll。
+func (el *EventLoop) resumeAccept() {
+	if el.acceptPausedUntil.IsZero() || time.Now().Before(el.acceptPausedUntil) {
+		return
+	}
+	if err := el.epollCtl(syscall.EPOLL_CTL_ADD, el.lfd, syscall.EPOLLIN); err != nil {
+		el.acceptPausedUntil = time.Now().Add(acceptBackoff)
+		return
+	}
+	el.acceptPausedUntil = time.Time{}
+}
+
+func (el *EventLoop) handleEvent(c *Conn, events uint32) {
+	if events&syscall.EPOLLOUT != 0 {
+		if el.afterCallback(c); c.closed {
+			return
+		}
+	}
+	if events&(syscall.EPOLLIN|syscall.EPOLLRDHUP|syscall.EPOLLHUP|syscall.EPOLLERR) == 0 {
+		return
+	}
+
+	if c.readClosed {
+		// 只是在等待 EPOLLOUT 把输出缓存写完；EPOLLHUP/EPOLLERR 由写入时的错误处理
+		return
+	}
+	n, err := syscall.Read(c.fd, el.readBuf)
+	if err == syscall.EAGAIN || err == syscall.EINTR {
+		return
+	}
+	if err != nil {
+		el.closeConn(c.fd, c, err)
+		return
+	}
+	if n == 0 {
+		// 对端关闭了写端：不再读取，输出缓存中的数据写完以后再关闭连接
+		c.readClosed = true
+		c.closing = true
+		el.afterCallback(c)
+		return
+	}
+	_, _ = c.inbound.Write(el.readBuf[:n])
+	el.handler.OnTraffic(c)
+	el.afterCallback(c)
+}
+
+// afterCallback 在回调之后把输出缓存写出去；回调中调用了 Close 时，写完后关闭连接。
+func (el *EventLoop) afterCallback(c *Conn) {
+	if c.closed {
+		return
+	}
+	if err := el.flush(c); err != nil {
+		el.closeConn(c.fd, c, err)
+	}
+}
+
+// flush 尽可能地把输出缓存写到 socket；写不完时监听 EPOLLOUT。
+func (el *EventLoop) flush(c *Conn) error {
+	for !c.outbound.IsEmpty() {
+		first, _ := c.outbound.PeekAll(false)
+		n, err := syscall.Write(c.fd, first)
+		if n > 0 {
+			_, _ = c.outbound.Discard(n)
+		}
+		if err == syscall.EAGAIN {
+			break
+		}
+		if err == syscall.EINTR {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	writable := !c.outbound.IsEmpty()
+	var events uint32
+	if !c.readClosed {
+		events = syscall.EPOLLIN | syscall.EPOLLRDHUP
+	}
+	if writable {
+		events |= syscall.EPOLLOUT
+	}
+	if events != c.events {
+		if err := el.epollCtl(syscall.EPOLL_CTL_MOD, c.fd, events); err != nil {
+			return err
+		}
+		c.events = events
+	}
+	if !writable && c.closing {
+		el.closeConn(c.fd, c, nil)
+	}
+	return nil
+}
+
+func (el *EventLoop) closeConn(fd int, c *Conn, err error) {
+	if _, ok := el.conns[fd]; !ok {
+		return
+	}
+	delete(el.conns, fd)
+	c.closed = true
+	_ = syscall.EpollCtl(el.epfd, syscall.EPOLL_CTL_DEL, fd, nil)
+	_ = syscall.Close(fd)
+	el.handler.OnClose(c, err)
+}
+
+func (el *EventLoop) epollCtl(op, fd int, events uint32) error {
+	return syscall.EpollCtl(el.epfd, op, fd, &syscall.EpollEvent{Events: events, Fd: int32(fd)})
+}
+
+func (el *EventLoop) closeFds() {
+	el.fdsLock.Lock()
+	defer el.fdsLock.Unlock()
+
+	for _, fd := range []int{el.lfd, el.epfd, el.wakeFds[0], el.wakeFds[1]} {
+		if fd >= 0 {
+			_ = syscall.Close(fd)
+		}
+	}
+	el.lfd, el.epfd, el.wakeFds = -1, -1, [2]int{-1, -1}
+}
+
+// listen 创建一个非阻塞的 tcp 监听 socket。
+func listen(addr string) (fd int, bound net.Addr, err error) {
+	tcpAddr, err := net.ResolveTCPAddr("tcp", addr)
+	if err != nil {
+		return -1, nil, err
+	}
+
+	var (
+		domain = syscall.AF_INET
+		sa     syscall.Sockaddr
+	)
+	if ip4 := tcpAddr.IP.To4(); tcpAddr.IP == nil || ip4 != nil {
+		sa4 := &syscall.SockaddrInet4{Port: tcpAddr.Port}
+		copy(sa4.Addr[:], ip4)
+		sa = sa4
+	} else {
+		domain = syscall.AF_INET6
+		sa6 := &syscall.SockaddrInet6{Port: tcpAddr.Port}
+		copy(sa6.Addr[:], tcpAddr.IP.To16())
+		sa = sa6
+	}
+
+	fd, err = syscall.Socket(domain, syscall.SOCK_STREAM|syscall.SOCK_NONBLOCK|syscall.SOCK_CLOEXEC, syscall.IPPROTO_TCP)
+	if err != nil {
+		return -1, nil, err
+	}
+	if err = syscall.SetsockoptInt(fd, syscall.SOL_SOCKET, syscall.SO_REUSEADDR, 1); err == nil {
+		if err = syscall.Bind(fd, sa); err == nil {
+			err = syscall.Listen(fd, syscall.SOMAXCONN)
+		}
+	}
+	if err != nil {
+		_ = syscall.Close(fd)
+		return -1, nil, err
+	}
+
+	local, err := syscall.Getsockname(fd)
+	if err != nil {
+		_ = syscall.Close(fd)
+		return -1, nil, err
+	}
+	return fd, sockaddrToAddr(local), nil
+}
+
+func sockaddrToAddr(sa syscall.Sockaddr) net.Addr {
+	switch sa := sa.(type) {
+	case *syscall.SockaddrInet4:
+		return &net.TCPAddr{IP: append(net.IP(nil), sa.Addr[:]...), Port: sa.Port}
+	case *syscall.SockaddrInet6:
+		return &net.TCPAddr{IP: append(net.IP(nil), sa.Addr[:]...), Port: sa.Port}
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+//go:build linux
+// +build linux
+
+package eventloop
+
+import (
+	"io"
+	"net"
+	"strings"
+	"testing"
+)
+
+func benchmarkEcho(b *testing.B, size int) {
+	el, stop := startLoop(b, &echoHandler{})
+	defer stop()
+
+	c, err := net.Dial("tcp", el.Addr().String())
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer c.Close()
+
+	data := []byte(strings.Repeat("a", size))
+	buf := make([]byte, size)
+
+	b.SetBytes(int64(size))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err = c.Write(data); err != nil {
+			b.Fatal(err)
+		}
+		if _, err = io.ReadFull(c, buf); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkEventLoop_Echo_64(b *testing.B) {
+	benchmarkEcho(b, 64)
+}
+
+func BenchmarkEventLoop_Echo_4096(b *testing.B) {
+	benchmarkEcho(b, 4096)
+}
+
+func BenchmarkEventLoop_Echo_65536(b *testing.B) {
+	benchmarkEcho(b, 65536)
+}
@@ -0,0 +1,305 @@
+//go:build linux
+// +build linux
+
+package eventloop
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/zput/ringbuffer/codec"
+)
+
+type echoHandler struct {
+	mu     sync.Mutex
+	opened int
+	closed chan error
+}
+
+func (h *echoHandler) OnOpen(c *Conn) {
+	h.mu.Lock()
+	h.opened++
+	h.mu.Unlock()
+}
+
+func (h *echoHandler) OnTraffic(c *Conn) {
+	first, end := c.Inbound().PeekAll(false)
+	_, _ = c.Write(first)
+	_, _ = c.Write(end)
+	c.Inbound().RetrieveAll()
+}
+
+func (h *echoHandler) OnClose(c *Conn, err error) {
+	if h.closed != nil {
+		h.closed <- err
+	}
+}
+
+// startLoop 在一个新的 goroutine 中运行事件循环，返回的函数用来停止它。
+func startLoop(t testing.TB, handler Handler) (*EventLoop, func()) {
+	el, err := Listen("127.0.0.1:0", handler, 64)
+	if err != nil {
+		t.Skip(err)
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- el.Run()
+	}()
+	return el, func() {
+		_ = el.Stop()
+		if err := <-done; err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestEventLoop_Echo(t *testing.T) {
+	h := &echoHandler{closed: make(chan error, 4)}
+	el, stop := startLoop(t, h)
+	defer stop()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			c, err := net.Dial("tcp", el.Addr().String())
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			defer c.Close()
+
+			// 远大于每个连接的缓存容量，需要 EPOLLOUT 才能写完
+			msg := bytes.Repeat([]byte{byte('a' + i)}, 1<<20)
+			go func() {
+				_, _ = c.Write(msg)
+			}()
+			got := make([]byte, len(msg))
+			if _, err = io.ReadFull(c, got); err != nil {
+				t.Error(err)
+				return
+			}
+			if !bytes.Equal(got, msg) {
+				t.Errorf("client %d: echoed data is different", i)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	for i := 0; i < 4; i++ {
+		select {
+		case err := <-h.closed:
+			if err != nil {
+				t.Fatalf("expect nil error when peer closes but got %v", err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("OnClose is not called")
+		}
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.opened != 4 {
+		t.Fatalf("expect 4 connections but got %d", h.opened)
+	}
+}
+
+// frameHandler 用 codec.Pipeline 处理长度字段分帧的请求，收到 "quit" 时关闭连接。
+type frameHandler struct {
+	pipeline *codec.Pipeline
+	closed   chan error
+}
+
+func (h *frameHandler) OnOpen(c *Conn) {}
+
+func (h *frameHandler) OnTraffic(c *Conn) {
+	if _, err := h.pipeline.Run(c.Inbound(), c.Outbound()); err != nil {
+		_ = c.Close()
+	}
+}
+
+func (h *frameHandler) OnClose(c *Conn, err error) {
+	h.closed <- err
+}
+
+func TestEventLoop_Pipeline(t *testing.T) {
+	decoder, _ := codec.NewLengthFieldDecoder(1024, 0, 2, 0, 2)
+	encoder, _ := codec.NewLengthFieldEncoder(2)
+	errQuit := io.EOF
+	p, _ := codec.NewPipeline(decoder, codec.HandlerFunc(func(frame []byte) ([]byte, error) {
+		if string(frame) == "quit" {
+			return nil, errQuit
+		}
+		return bytes.ToUpper(frame), nil
+	}), encoder)
+	h := &frameHandler{pipeline: p, closed: make(chan error, 1)}
+	el, stop := startLoop(t, h)
+	defer stop()
+
+	c, err := net.Dial("tcp", el.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	// 一帧拆成两次发送
+	_, _ = c.Write([]byte{0x00, 0x05, 'h', 'e'})
+	time.Sleep(10 * time.Millisecond)
+	_, _ = c.Write([]byte{'l', 'l', 'o', 0x00, 0x04, 'q', 'u', 'i', 't'})
+
+	got := make([]byte, 7)
+	if _, err = io.ReadFull(c, got); err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "\x00\x05HELLO" {
+		t.Fatalf("expect HELLO but got %q", got)
+	}
+	// 服务端关闭连接
+	if _, err = c.Read(got); err != io.EOF {
+		t.Fatalf("expect io.EOF but got %v", err)
+	}
+	if err = <-h.closed; err != nil {
+		t.Fatalf("expect nil error but got %v", err)
+	}
+}
+
+// replyHandler 收到任何数据时都回复 reply，用来制造写不完的输出缓存。
+type replyHandler struct {
+	reply  []byte
+	closed chan error
+}
+
+func (h *replyHandler) OnOpen(c *Conn) {
+	_ = syscall.SetsockoptInt(c.Fd(), syscall.SOL_SOCKET, syscall.SO_SNDBUF, 4096)
+}
+
+func (h *replyHandler) OnTraffic(c *Conn) {
+	c.Inbound().RetrieveAll()
+	_, _ = c.Write(h.reply)
+}
+
+func (h *replyHandler) OnClose(c *Conn, err error) {
+	h.closed <- err
+}
+
+func TestEventLoop_HalfClose(t *testing.T) {
+	// 远大于 socket 的缓存，服务端读到 EOF 时回复还有一大半留在输出缓存中
+	h := &replyHandler{reply: bytes.Repeat([]byte("half-close"), 1<<17), closed: make(chan error, 1)}
+	el, stop := startLoop(t, h)
+	defer stop()
+
+	c, err := net.Dial("tcp", el.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	_ = c.(*net.TCPConn).SetReadBuffer(16 << 10)
+
+	if _, err = c.Write([]byte("request")); err != nil {
+		t.Fatal(err)
+	}
+	if err = c.(*net.TCPConn).CloseWrite(); err != nil {
+		t.Fatal(err)
+	}
+	// 等待服务端读到 EOF，再开始读取回复
+	time.Sleep(50 * time.Millisecond)
+	_ = c.SetReadDeadline(time.Now().Add(10 * time.Second))
+	got, err := ioutil.ReadAll(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, h.reply) {
+		t.Fatalf("expect %d bytes but got %d", len(h.reply), len(got))
+	}
+	if err = <-h.closed; err != nil {
+		t.Fatalf("expect nil error but got %v", err)
+	}
+}
+
+func TestEventLoop_Stop(t *testing.T) {
+	h := &echoHandler{closed: make(chan error, 1)}
+	el, err := Listen("127.0.0.1:0", h, 0)
+	if err != nil {
+		t.Skip(err)
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- el.Run()
+	}()
+
+	c, err := net.Dial("tcp", el.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	_, _ = c.Write([]byte("ping"))
+	_, _ = io.ReadFull(c, make([]byte, 4))
+
+	_ = el.Stop()
+	if err = <-done; err != nil {
+		t.Fatal(err)
+	}
+	if err = <-h.closed; err != ErrServerShutdown {
+		t.Fatalf("expect ErrServerShutdown but got %v", err)
+	}
+	if err = el.Run(); err != ErrLoopIsRunning {
+		t.Fatalf("expect ErrLoopIsRunning but got %v", err)
+	}
+}
+
+// TestEventLoop_AcceptEMFILE 没有空闲的 fd 时 accept 失败，事件循环不能空转，fd 释放以后继续接受连接。
+func TestEventLoop_AcceptEMFILE(t *testing.T) {
+	h := &echoHandler{}
+	el, stop := startLoop(t, h)
+	defer stop()
+
+	var limit syscall.Rlimit
+	if err := syscall.Getrlimit(syscall.RLIMIT_NOFILE, &limit); err != nil {
+		t.Skip(err)
+	}
+	// 只留下一个 fd 给客户端的 socket，事件循环 accept 时返回 EMFILE
+	fd, err := syscall.Dup(0)
+	if err != nil {
+		t.Skip(err)
+	}
+	_ = syscall.Close(fd)
+	low := limit
+	low.Cur = uint64(fd + 1)
+	if err = syscall.Setrlimit(syscall.RLIMIT_NOFILE, &low); err != nil {
+		t.Skip(err)
+	}
+	c, err := net.Dial("tcp", el.Addr().String())
+	if err != nil {
+		_ = syscall.Setrlimit(syscall.RLIMIT_NOFILE, &limit)
+		t.Skip(err)
+	}
+	defer c.Close()
+
+	cpu := func() time.Duration {
+		var ru syscall.Rusage
+		_ = syscall.Getrusage(syscall.RUSAGE_SELF, &ru)
+		return time.Duration(ru.Utime.Nano() + ru.Stime.Nano())
+	}
+	before := cpu()
+	time.Sleep(300 * time.Millisecond)
+	used := cpu() - before
+	if err = syscall.Setrlimit(syscall.RLIMIT_NOFILE, &limit); err != nil {
+		t.Fatal(err)
+	}
+	if used > 150*time.Millisecond {
+		t.Fatalf("event loop is spinning on accept errors; used %v cpu in 300ms", used)
+	}
+
+	// fd 够用以后连接被接受
+	_, _ = c.Write([]byte("ping"))
+	_ = c.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if _, err = io.ReadFull(c, make([]byte, 4)); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -30,13 +30,19 @@ func main() {
 
 	print(buffer.PeekAll(isUsingExplore))
 
-	fmt.Println(buffer.PeekUint8(isUsingExplore))
+	fmt.Println(buffer.PeekByte(isUsingExplore))
 
-	fmt.Println(buffer.PeekUint16(isUsingExplore))
+	fmt.Println(buffer.PeekUint16BE(isUsingExplore))
 
-	fmt.Println(buffer.PeekUint32(isUsingExplore))
+	fmt.Println(buffer.PeekUint32BE(isUsingExplore))
 
-	fmt.Println(buffer.PeekUint64(isUsingExplore))
+	fmt.Println(buffer.PeekUint64BE(isUsingExplore))
+
+	fmt.Println(buffer.PeekUint64LE(isUsingExplore))
+
+	// 数据不够时返回 ErrNotEnoughData
+	_, _ = buffer.Discard(8)
+	fmt.Println(buffer.PeekUint32BE(isUsingExplore))
 }
 
 /*
@@ -44,10 +50,12 @@ func main() {
 size[11]; capacity[1024]
 writing
 writing ...
-119
-30578
-2003986804
-8607057786564405024
+119 <nil>
+30578 <nil>
+2003986804 <nil>
+8607057786564405024 <nil>
+2334956331018580599 <nil>
+0 not enough data; ring buffer
 
 Process finished with exit code 0
 */
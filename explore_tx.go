@@ -0,0 +1,160 @@
+package ringbuffer
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// ExploreTx 已经 Commit 或者 Abort 过，不能再使用。
+var ErrTxDone = errors.New("explore transaction is already committed or aborted; ring buffer")
+
+/*
+ExploreTx 是线程安全的探索事务，用来代替 ExploreBegin/ExploreRead/.../ExploreCommit：
+
+	tx := rb.BeginExplore()
+	length, err := tx.PeekUint16()
+	...
+	if err != nil {
+		tx.Abort()
+		return
+	}
+	err = tx.Commit()
+
+ExploreTx 从 BeginExplore 到 Commit/Abort 一直持有读者一端的锁(加锁模式下)，同一时间只有一个探索事务；
+其他消费数据或者修改读指针一端的操作(Read/ReadByte/Discard/Retrieve/RetrieveAll/ExploreCommit/Cursor.Commit/
+DiscardTo/Rewind/WriteFront/ReadBack/TruncateTail)也要取这把锁，事务期间阻塞到事务结束，
+所以事务看到的数据不会被其他 goroutine 消费。
+它不持有缓存的读写锁，所以其他 goroutine 仍然可以同时写入，写入的数据在事务中立即可见。
+ExploreTx 基于 Cursor 实现，不影响 Explore 系列函数的状态。
+
+不加锁(New(size) 不开启锁)时没有这些保证，事务期间消费了数据时，事务的后续操作(包括 Commit)返回 ErrCursorStale。
+
+同一个 goroutine 在 Commit/Abort 之前再次调用 BeginExplore、或者调用上面这些消费数据的函数会死锁；
+一个 ExploreTx 不能在多个 goroutine 中使用。
+*/
+type ExploreTx struct {
+	c    *Cursor
+	done bool
+}
+
+// BeginExplore 开始一个探索事务；已经有其他事务、或者其他 goroutine 正在消费数据时阻塞，直到它们结束。
+// 事务结束时必须调用 Commit 或者 Abort。
+func (this *RingBuffer) BeginExplore() *ExploreTx {
+	this.m.ReaderLock()
+	return &ExploreTx{c: this.NewCursor()}
+}
+
+// Read 从探索的位置拷贝数据并向后移动；没有数据时返回 ErrIsEmpty。
+func (this *ExploreTx) Read(p []byte) (int, error) {
+	if this.done {
+		return 0, ErrTxDone
+	}
+	return this.c.Read(p)
+}
+
+// Retrieve 跳过 n 个字节；数据不够时返回 ErrNotEnoughData，位置不变。
+func (this *ExploreTx) Retrieve(n int) error {
+	if this.done {
+		return ErrTxDone
+	}
+	return this.c.Skip(n)
+}
+
+// Size 返回还没有探索的字节数。
+func (this *ExploreTx) Size() int {
+	if this.done {
+		return 0
+	}
+	return this.c.Buffered()
+}
+
+/*
+Peek 返回探索位置处的 n 个字节，不移动位置；数据不够时返回 ErrNotEnoughData。
+返回的切片直接引用缓存的内存，只在下一次写入之前有效；并发写入时应该使用拷贝的 Read 或者 PeekUintXX。
+*/
+func (this *ExploreTx) Peek(n int) (first []byte, end []byte, err error) {
+	if this.done {
+		return nil, nil, ErrTxDone
+	}
+	return this.c.Peek(n)
+}
+
+// peekBytes 在持有读锁的时候把 len(p) 个字节拷贝到 p 中。
+func (this *ExploreTx) peekBytes(p []byte) error {
+	if this.done {
+		return ErrTxDone
+	}
+	rb := this.c.rb
+	rb.m.RLock()
+	defer rb.m.RUnlock()
+
+	if err := this.c.check(); err != nil {
+		return err
+	}
+	if rb.size()-this.c.off < len(p) {
+		return ErrNotEnoughData
+	}
+	first, end := rb.peekAt(this.c.off, len(p))
+	copy(p, first)
+	copy(p[len(first):], end)
+	return nil
+}
+
+// PeekUint8 返回探索位置处的一个字节，不移动位置。
+func (this *ExploreTx) PeekUint8() (uint8, error) {
+	var b [1]byte
+	err := this.peekBytes(b[:])
+	return b[0], err
+}
+
+// PeekUint16 按照大端序返回探索位置处的 uint16，不移动位置。
+func (this *ExploreTx) PeekUint16() (uint16, error) {
+	var b [2]byte
+	if err := this.peekBytes(b[:]); err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint16(b[:]), nil
+}
+
+// PeekUint32 按照大端序返回探索位置处的 uint32，不移动位置。
+func (this *ExploreTx) PeekUint32() (uint32, error) {
+	var b [4]byte
+	if err := this.peekBytes(b[:]); err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint32(b[:]), nil
+}
+
+// PeekUint64 按照大端序返回探索位置处的 uint64，不移动位置。
+func (this *ExploreTx) PeekUint64() (uint64, error) {
+	var b [8]byte
+	if err := this.peekBytes(b[:]); err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint64(b[:]), nil
+}
+
+// Commit 消费探索过的数据并结束事务；不加锁时，事务期间数据被消费过时返回 ErrCursorStale，缓存不变，
+// 事务同样结束。
+func (this *ExploreTx) Commit() error {
+	if this.done {
+		return ErrTxDone
+	}
+	this.done = true
+	rb := this.c.rb
+	// 事务已经持有 reader，只需要写锁
+	rb.m.Lock()
+	defer rb.m.ReaderUnlock()
+	defer rb.m.Unlock()
+
+	return this.c.commit()
+}
+
+// Abort 放弃探索过的位置并结束事务，缓存不变。
+func (this *ExploreTx) Abort() {
+	if this.done {
+		return
+	}
+	this.done = true
+	this.c.rb.m.ReaderUnlock()
+}
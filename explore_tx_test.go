@@ -0,0 +1,198 @@
+package ringbuffer
+
+import (
+	"bytes"
+	"encoding/binary"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestExploreTx(t *testing.T) {
+	rb := New(8, true)
+	_, _ = rb.Write([]byte{0, 3, 'a', 'b'})
+
+	tx := rb.BeginExplore()
+	length, err := tx.PeekUint16()
+	if err != nil || length != 3 {
+		t.Fatalf("unexpected length %d %v", length, err)
+	}
+	if _, err = tx.PeekUint32(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = tx.PeekUint64(); err != ErrNotEnoughData {
+		t.Fatalf("expect ErrNotEnoughData but got %v", err)
+	}
+	if err = tx.Retrieve(2); err != nil || tx.Size() != 2 {
+		t.Fatalf("unexpected retrieve %v %d", err, tx.Size())
+	}
+	if err = tx.Retrieve(3); err != ErrNotEnoughData {
+		t.Fatalf("expect ErrNotEnoughData but got %v", err)
+	}
+	// 帧还不完整，放弃
+	tx.Abort()
+	tx.Abort()
+	if _, err = tx.Read(make([]byte, 1)); err != ErrTxDone {
+		t.Fatalf("expect ErrTxDone but got %v", err)
+	}
+	if err = tx.Commit(); err != ErrTxDone {
+		t.Fatalf("expect ErrTxDone but got %v", err)
+	}
+	if rb.Size() != 4 {
+		t.Fatalf("abort should not consume; got size %d", rb.Size())
+	}
+
+	_ = rb.WriteByte('c')
+	tx = rb.BeginExplore()
+	_ = tx.Retrieve(2)
+	buf := make([]byte, 3)
+	if n, err := tx.Read(buf); n != 3 || err != nil || string(buf) != "abc" {
+		t.Fatalf("unexpected read %q %v", buf[:n], err)
+	}
+	if b, err := tx.PeekUint8(); err != ErrNotEnoughData || b != 0 {
+		t.Fatalf("expect ErrNotEnoughData but got %d %v", b, err)
+	}
+	if err = tx.Commit(); err != nil || !rb.IsEmpty() {
+		t.Fatalf("unexpected commit %v %d", err, rb.Size())
+	}
+}
+
+// TestExploreTx_Stale 不加锁时事务期间消费了数据，事务返回 ErrCursorStale。
+func TestExploreTx_Stale(t *testing.T) {
+	rb := New(8)
+	_, _ = rb.WriteString("abcd")
+
+	tx := rb.BeginExplore()
+	_ = tx.Retrieve(1)
+	_, _ = rb.ReadByte()
+	if err := tx.Commit(); err != ErrCursorStale {
+		t.Fatalf("expect ErrCursorStale but got %v", err)
+	}
+	if rb.Size() != 3 {
+		t.Fatalf("stale commit should not consume; got size %d", rb.Size())
+	}
+}
+
+// TestExploreTx_BlocksConsumers 加锁时其他 goroutine 消费数据要等待事务结束。
+func TestExploreTx_BlocksConsumers(t *testing.T) {
+	rb := New(8, true)
+	consumers := map[string]func(){
+		"Read":        func() { _, _ = rb.Read(make([]byte, 1)) },
+		"ReadByte":    func() { _, _ = rb.ReadByte() },
+		"Discard":     func() { _, _ = rb.Discard(1) },
+		"Retrieve":    func() { rb.Retrieve(1) },
+		"RetrieveAll": func() { rb.RetrieveAll() },
+		"ExploreCommit": func() {
+			rb.ExploreBegin()
+			_, _ = rb.ExploreDiscard(1)
+			rb.ExploreCommit()
+		},
+		"Cursor.Commit": func() {
+			c := rb.NewCursor()
+			_ = c.Skip(1)
+			_ = c.Commit()
+		},
+		"DiscardTo":    func() { _ = rb.DiscardTo(rb.WriteOffset()) },
+		"WriteFront":   func() { _, _ = rb.WriteFront([]byte("w")) },
+		"ReadBack":     func() { _, _ = rb.ReadBack(make([]byte, 1)) },
+		"TruncateTail": func() { _ = rb.TruncateTail(1) },
+		"Rewind":       func() { _ = rb.Rewind(1) },
+	}
+	for name, consume := range consumers {
+		_, _ = rb.WriteString("xyz")
+		tx := rb.BeginExplore()
+		_ = tx.Retrieve(1)
+
+		done := make(chan struct{})
+		go func() {
+			consume()
+			close(done)
+		}()
+		select {
+		case <-done:
+			t.Fatalf("%s: should wait for the transaction", name)
+		case <-time.After(20 * time.Millisecond):
+		}
+		if err := tx.Commit(); err != nil {
+			t.Fatalf("%s: unexpected commit %v", name, err)
+		}
+		runWithTimeout(t, time.Second, func() { <-done })
+	}
+}
+
+func TestExploreTx_Serialized(t *testing.T) {
+	rb := New(8, true)
+	tx := rb.BeginExplore()
+
+	began := make(chan struct{})
+	go func() {
+		other := rb.BeginExplore()
+		close(began)
+		other.Abort()
+	}()
+
+	// 写入不被事务阻塞
+	_, _ = rb.WriteString("abcdefghij")
+	select {
+	case <-began:
+		t.Fatal("the second transaction should wait")
+	case <-time.After(20 * time.Millisecond):
+	}
+	if tx.Size() != 10 {
+		t.Fatalf("expect concurrent writes visible but got %d", tx.Size())
+	}
+	tx.Abort()
+	<-began
+}
+
+// TestExploreTx_ConcurrentProducer 一个 goroutine 写入长度前缀的帧，另一个 goroutine 用探索事务解析。
+func TestExploreTx_ConcurrentProducer(t *testing.T) {
+	const frames = 2000
+	rb := New(16, true)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < frames; i++ {
+			payload := bytes.Repeat([]byte{byte(i)}, i%50)
+			frame := make([]byte, 2+len(payload))
+			binary.BigEndian.PutUint16(frame, uint16(len(payload)))
+			copy(frame[2:], payload)
+			// 一次写一部分，让解析的一方看到不完整的帧
+			for len(frame) > 0 {
+				n := 1 + i%7
+				if n > len(frame) {
+					n = len(frame)
+				}
+				_, _ = rb.Write(frame[:n])
+				frame = frame[n:]
+			}
+		}
+	}()
+
+	for i := 0; i < frames; {
+		tx := rb.BeginExplore()
+		length, err := tx.PeekUint16()
+		if err != nil || tx.Size() < 2+int(length) {
+			tx.Abort()
+			continue
+		}
+		_ = tx.Retrieve(2)
+		payload := make([]byte, length)
+		if _, err = tx.Read(payload); length > 0 && err != nil {
+			t.Fatal(err)
+		}
+		if err = tx.Commit(); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(payload, bytes.Repeat([]byte{byte(i)}, i%50)) {
+			t.Fatalf("frame %d: unexpected payload %v", i, payload)
+		}
+		i++
+	}
+	wg.Wait()
+	if !rb.IsEmpty() {
+		t.Fatalf("expect empty but got size %d", rb.Size())
+	}
+}
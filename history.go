@@ -0,0 +1,115 @@
+package ringbuffer
+
+import "errors"
+
+// 保留的历史数据不够。
+var ErrNotEnoughHistory = errors.New("not enough history; ring buffer")
+
+// 回溯的距离是 0，或者超过了缓存中的数据加上历史数据。
+var ErrInvalidDistance = errors.New("back-reference distance is out of the window; ring buffer")
+
+/*
+NewWithHistory 返回一个保留历史数据的 RingBuffer：读指针之前最近读过的 history 个字节不会被写入覆盖，
+缓存不够时扩容，而不是覆盖历史数据。
+
+  - Rewind 把读过的数据退回缓存，用于重传；
+  - CopyFromHistory 把之前写入的数据再写入一次，用于 LZ77/DEFLATE 这样的解压缩；
+  - PeekAbs 也可以访问历史数据。
+
+RetrieveAll/Reset 会同时清空历史数据。
+*/
+func NewWithHistory(cap, history int, isOpenLock ...bool) *RingBuffer {
+	rb := New(cap, isOpenLock...)
+	if history > 0 {
+		rb.history = history
+	}
+	return rb
+}
+
+// HistorySize 返回现在保留的历史数据的字节数。
+// READ LOCK
+func (this *RingBuffer) HistorySize() int {
+	this.m.RLock()
+	defer this.m.RUnlock()
+
+	return this.hist
+}
+
+/*
+Rewind 把最近读过的 n 个字节退回缓存，下一次读取从这 n 个字节开始；ReadOffset() 相应减少。
+历史数据不够 n 个字节时返回 ErrNotEnoughHistory，缓存不变。
+Rewind 以后所有的 Cursor 都会失效。
+*/
+// CONSUME LOCK
+func (this *RingBuffer) Rewind(n int) error {
+	this.m.ConsumeLock()
+	defer this.m.ConsumeUnlock()
+
+	if n < 0 {
+		return ErrNegativeCount
+	}
+	if n > this.hist {
+		return ErrNotEnoughHistory
+	}
+	if n == 0 {
+		return nil
+	}
+	eprOff := this.exploreOffset()
+	this.rIdx = (this.rIdx - n + this.cap) % this.cap
+	this.isEmpty = false
+	this.hist -= n
+	this.readGen++
+	// 探索指针留在原来的数据上
+	if eprOff >= 0 {
+		this.rebaseExplore(eprOff + n)
+	}
+	return nil
+}
+
+/*
+CopyFromHistory 把 distance 个字节之前写入的 length 个字节再写入缓存，也就是 LZ77 的回溯引用：
+
+	distance = 1, length = 4: "ab" -> "abbbbb"
+	distance = 2, length = 3: "ab" -> "ababa"
+
+length 大于 distance 时，后面的字节复制的是这一次刚刚写入的字节。
+distance 的范围是 [1, Size()+HistorySize()]，写事务中还包括未提交的字节；超出时返回 ErrInvalidDistance，缓存不变。
+写事务中复制的字节与 Write 一样，要等到 WriteCommit 才能读取。
+*/
+// READ/WRITE LOCK
+func (this *RingBuffer) CopyFromHistory(distance, length int) error {
+	this.m.Lock()
+	defer this.m.Unlock()
+
+	if length < 0 {
+		return ErrNegativeCount
+	}
+	if distance <= 0 || distance > this.size()+this.hist+this.pend {
+		return ErrInvalidDistance
+	}
+	if length == 0 {
+		return nil
+	}
+
+	if free := this.free(); free < length {
+		this.appendSpace(length - free)
+	}
+	// 空闲空间紧跟在 dst 之后，不会与 [src, dst) 的数据重叠
+	dst := (this.wIdx + this.pend) % this.cap
+	src := (dst - distance + this.cap) % this.cap
+	for i := 0; i < length; i++ {
+		this.buf[dst] = this.buf[src]
+		if dst++; dst == this.cap {
+			dst = 0
+		}
+		if src++; src == this.cap {
+			src = 0
+		}
+	}
+	if this.inWrite {
+		this.pend += length
+	} else {
+		this.publish(length)
+	}
+	return nil
+}
@@ -0,0 +1,158 @@
+package ringbuffer
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+)
+
+func TestHistory_Rewind(t *testing.T) {
+	rb := NewWithHistory(8, 4)
+	_, _ = rb.WriteString("abcdef")
+	buf := make([]byte, 5)
+	_, _ = rb.Read(buf)
+	if rb.HistorySize() != 4 {
+		t.Fatalf("expect history 4 but got %d", rb.HistorySize())
+	}
+	// 写满除了历史数据以外的空间，历史数据不会被覆盖
+	_, _ = rb.WriteString("ghi")
+	if rb.Capacity() != 8 {
+		t.Fatalf("expect no growth but got capacity %d", rb.Capacity())
+	}
+	_, _ = rb.WriteString("j")
+	if rb.Capacity() == 8 {
+		t.Fatal("expect growth instead of overwriting history")
+	}
+
+	if err := rb.Rewind(5); err != ErrNotEnoughHistory {
+		t.Fatalf("expect ErrNotEnoughHistory but got %v", err)
+	}
+	if err := rb.Rewind(-1); err != ErrNegativeCount {
+		t.Fatalf("expect ErrNegativeCount but got %v", err)
+	}
+	offset := rb.ReadOffset()
+	if err := rb.Rewind(3); err != nil || rb.ReadOffset() != offset-3 || rb.HistorySize() != 1 {
+		t.Fatalf("unexpected rewind %v %d %d", err, rb.ReadOffset(), rb.HistorySize())
+	}
+	if got := string(rb.ReadAll2NewByteSlice()); got != "cdefghij" {
+		t.Fatalf("expect cdefghij but got %q", got)
+	}
+	first, end, err := rb.PeekAbs(1, 2)
+	if err != nil || string(first)+string(end) != "bc" {
+		t.Fatalf("unexpected peek %q %q %v", first, end, err)
+	}
+	if _, _, err = rb.PeekAbs(0, 1); err != ErrOffsetConsumed {
+		t.Fatalf("expect ErrOffsetConsumed but got %v", err)
+	}
+
+	// 读完以后历史数据仍然保留，RetrieveAll 会清空
+	_, _ = rb.Discard(rb.Size())
+	if rb.HistorySize() != 4 || rb.Rewind(4) != nil {
+		t.Fatalf("expect history kept after discarding all; got %d", rb.HistorySize())
+	}
+	if got := string(rb.ReadAll2NewByteSlice()); got != "ghij" {
+		t.Fatalf("expect ghij but got %q", got)
+	}
+	rb.RetrieveAll()
+	if rb.HistorySize() != 0 {
+		t.Fatalf("expect history cleared but got %d", rb.HistorySize())
+	}
+}
+
+func TestHistory_RewindExplore(t *testing.T) {
+	rb := NewWithHistory(8, 8)
+	_, _ = rb.WriteString("abcdef")
+	_, _ = rb.Read(make([]byte, 2))
+	c := rb.NewCursor()
+
+	rb.ExploreBegin()
+	_, _ = rb.ExploreDiscard(1)
+	_ = rb.Rewind(2)
+	if b, _ := rb.PeekByte(true); b != 'd' {
+		t.Fatalf("expect explore stays on d but got %c", b)
+	}
+	rb.ExploreBreak()
+	if err := c.Skip(0); err != ErrCursorStale {
+		t.Fatalf("expect ErrCursorStale but got %v", err)
+	}
+}
+
+func TestHistory_CopyFromHistory(t *testing.T) {
+	rb := NewWithHistory(4, 4)
+	_, _ = rb.WriteString("ab")
+
+	if err := rb.CopyFromHistory(0, 1); err != ErrInvalidDistance {
+		t.Fatalf("expect ErrInvalidDistance but got %v", err)
+	}
+	if err := rb.CopyFromHistory(3, 1); err != ErrInvalidDistance {
+		t.Fatalf("expect ErrInvalidDistance but got %v", err)
+	}
+	if err := rb.CopyFromHistory(1, -1); err != ErrNegativeCount {
+		t.Fatalf("expect ErrNegativeCount but got %v", err)
+	}
+	// 重叠的复制
+	if err := rb.CopyFromHistory(2, 3); err != nil {
+		t.Fatal(err)
+	}
+	if got := string(rb.ReadAll2NewByteSlice()); got != "ababa" {
+		t.Fatalf("expect ababa but got %q", got)
+	}
+	// 已经读过的数据也可以引用
+	_, _ = rb.Read(make([]byte, 5))
+	if err := rb.CopyFromHistory(4, 6); err != nil || rb.WriteOffset() != 11 {
+		t.Fatalf("unexpected copy %v %d", err, rb.WriteOffset())
+	}
+	if got := string(rb.ReadAll2NewByteSlice()); got != "bababa" {
+		t.Fatalf("expect bababa but got %q", got)
+	}
+}
+
+// TestHistory_Inflate 模拟一个流式的解压缩：随机写入字面量与回溯引用，另一端随机读取，与直接拼接的结果对比。
+func TestHistory_Inflate(t *testing.T) {
+	const window = 32
+	for seed := int64(0); seed < 50; seed++ {
+		r := rand.New(rand.NewSource(seed))
+		var rb *RingBuffer
+		if seed%2 == 0 {
+			rb = NewWithHistory(1+r.Intn(window), window)
+		} else {
+			// 底层数组有余量，走原地扩容
+			rb = NewWithHistory(1, window)
+			rb.buf = make([]byte, 1, 256)
+		}
+
+		var expect, got []byte
+		for step := 0; step < 500; step++ {
+			switch r.Intn(3) {
+			case 0:
+				p := make([]byte, 1+r.Intn(5))
+				r.Read(p)
+				_, _ = rb.Write(p)
+				expect = append(expect, p...)
+			case 1:
+				avail := rb.Size() + rb.HistorySize()
+				if avail == 0 {
+					continue
+				}
+				distance, length := 1+r.Intn(avail), r.Intn(40)
+				if err := rb.CopyFromHistory(distance, length); err != nil {
+					t.Fatalf("seed %d: %v", seed, err)
+				}
+				for i := 0; i < length; i++ {
+					expect = append(expect, expect[len(expect)-distance])
+				}
+			default:
+				p := make([]byte, r.Intn(30))
+				n, _ := rb.Read(p)
+				got = append(got, p[:n]...)
+			}
+			if rb.HistorySize() > window || int(rb.WriteOffset()) != len(expect) {
+				t.Fatalf("seed %d: history %d, write offset %d, expect %d", seed, rb.HistorySize(), rb.WriteOffset(), len(expect))
+			}
+		}
+		got = append(got, rb.ReadAll2NewByteSlice()...)
+		if !bytes.Equal(got, expect) {
+			t.Fatalf("seed %d: output mismatch", seed)
+		}
+	}
+}
@@ -0,0 +1,224 @@
+package http1
+
+import (
+	"io"
+
+	"github.com/zput/ringbuffer"
+	"github.com/zput/ringbuffer/codec"
+)
+
+const (
+	DefaultMaxChunkLineLength = 4096
+	DefaultMaxTrailerBytes    = 16 * 1024
+)
+
+const (
+	chunkSize = iota
+	chunkData
+	chunkDataEnd
+	chunkTrailer
+	chunkDone
+)
+
+/*
+ChunkedReader 以流的方式解码 chunked 编码的消息体：每次调用 Read 从缓存中消费尽可能多的数据，
+chunk 的大小行、数据之后的 "\r\n" 以及 trailer 都在内部处理。
+
+	4\r\n
+	Wiki\r\n
+	0\r\n
+	Expires: Wed, 21 Oct 2015 07:28:00 GMT\r\n
+	\r\n
+
+保存着解码的状态，每个消息体一个，不是线程安全的。
+*/
+type ChunkedReader struct {
+	MaxLineLength   int // chunk 大小行(包括扩展)的最大长度
+	MaxTrailerBytes int // trailer 的最大总长度
+
+	// 消息体结束之后(Read 返回 io.EOF)保存收到的 trailer；拷贝出来的，不引用缓存的内存
+	Trailers Headers
+
+	state        int
+	remaining    int64
+	trailerBytes int
+}
+
+// NewChunkedReader 返回使用默认限制的 ChunkedReader。
+func NewChunkedReader() *ChunkedReader {
+	return &ChunkedReader{
+		MaxLineLength:   DefaultMaxChunkLineLength,
+		MaxTrailerBytes: DefaultMaxTrailerBytes,
+	}
+}
+
+// Reset 让 ChunkedReader 可以用来解码下一个消息体。
+func (c *ChunkedReader) Reset() {
+	c.Trailers = c.Trailers[:0]
+	c.state = chunkSize
+	c.remaining = 0
+	c.trailerBytes = 0
+}
+
+// Done 返回消息体(包括 trailer)是否已经全部读完。
+func (c *ChunkedReader) Done() bool {
+	return c.state == chunkDone
+}
+
+/*
+Read 从 rb 中解码消息体的数据到 p 中。
+
+缓存中暂时没有可以返回的数据时返回 codec.ErrNeedMoreData；消息体结束时返回 io.EOF。
+与 io.Reader 一样，n > 0 时 err 可能是 nil 或者 io.EOF。
+no thread safety guarantees
+*/
+func (c *ChunkedReader) Read(rb *ringbuffer.RingBuffer, p []byte) (n int, err error) {
+	for n < len(p) || c.state == chunkTrailer || c.state == chunkDone {
+		switch c.state {
+		case chunkSize:
+			err = c.readSize(rb)
+		case chunkData:
+			m := len(p) - n
+			if int64(m) > c.remaining {
+				m = int(c.remaining)
+			}
+			m, _ = rb.Read(p[n : n+m])
+			if m == 0 {
+				err = codec.ErrNeedMoreData
+				break
+			}
+			n += m
+			c.remaining -= int64(m)
+			if c.remaining == 0 {
+				c.state = chunkDataEnd
+			}
+		case chunkDataEnd:
+			err = c.readDataEnd(rb)
+		case chunkTrailer:
+			err = c.readTrailer(rb)
+		case chunkDone:
+			return n, io.EOF
+		}
+
+		if err != nil {
+			if err == codec.ErrNeedMoreData && n > 0 {
+				err = nil
+			}
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+/*
+Reader 返回一个绑定了 rb 的 io.Reader，每次 Read(p) 调用 c.Read(rb, p)，可以交给 io.Copy 等使用。
+
+缓存中暂时没有可以返回的数据时 Read 返回 (0, codec.ErrNeedMoreData)：io.Copy 等会停下来并返回这个错误，
+数据到达以后用同一个 Reader 继续读即可；消息体结束时返回 io.EOF。
+no thread safety guarantees
+*/
+func (c *ChunkedReader) Reader(rb *ringbuffer.RingBuffer) io.Reader {
+	return &bodyReader{c: c, rb: rb}
+}
+
+// bodyReader 把 ChunkedReader 与一个缓存绑定在一起。
+type bodyReader struct {
+	c  *ChunkedReader
+	rb *ringbuffer.RingBuffer
+}
+
+func (b *bodyReader) Read(p []byte) (int, error) {
+	return b.c.Read(b.rb, p)
+}
+
+// readSize 解析 "chunk-size [ chunk-ext ] CRLF"。
+func (c *ChunkedReader) readSize(rb *ringbuffer.RingBuffer) error {
+	line, n, err := peekLine(rb, c.MaxLineLength)
+	if err != nil {
+		return err
+	}
+	size, err := parseChunkSize(line)
+	if err != nil {
+		return err
+	}
+	_, _ = rb.Discard(n)
+	if size == 0 {
+		c.state = chunkTrailer
+	} else {
+		c.remaining = size
+		c.state = chunkData
+	}
+	return nil
+}
+
+// readDataEnd 消费 chunk 数据之后的 CRLF。
+func (c *ChunkedReader) readDataEnd(rb *ringbuffer.RingBuffer) error {
+	line, n, err := peekLine(rb, 0)
+	if err == ErrLineTooLong || (err == nil && len(line) != 0) {
+		return ErrInvalidChunk
+	}
+	if err != nil {
+		return err
+	}
+	_, _ = rb.Discard(n)
+	c.state = chunkSize
+	return nil
+}
+
+// readTrailer 消费 trailer 中的一行，空行表示消息体结束。
+func (c *ChunkedReader) readTrailer(rb *ringbuffer.RingBuffer) error {
+	line, n, err := peekLine(rb, c.MaxTrailerBytes-c.trailerBytes)
+	if err == ErrLineTooLong {
+		return ErrTrailerTooLarge
+	}
+	if err != nil {
+		return err
+	}
+	if len(line) == 0 {
+		_, _ = rb.Discard(n)
+		c.state = chunkDone
+		return nil
+	}
+	if line[0] == ' ' || line[0] == '\t' {
+		return ErrInvalidHeader
+	}
+	h, err := parseHeader(line)
+	if err != nil {
+		return err
+	}
+	name := append([]byte(nil), h.Name...)
+	value := append([]byte(nil), h.Value...)
+	c.Trailers = append(c.Trailers, Header{Name: name, Value: value})
+	c.trailerBytes += n
+	_, _ = rb.Discard(n)
+	return nil
+}
+
+// parseChunkSize 解析十六进制的 chunk 大小，忽略 ";" 之后的扩展。
+func parseChunkSize(line []byte) (int64, error) {
+	for i, b := range line {
+		if b == ';' {
+			line = line[:i]
+			break
+		}
+	}
+	line = trimOWS(line)
+	if len(line) == 0 || len(line) > 15 {
+		return 0, ErrInvalidChunk
+	}
+	var size int64
+	for _, b := range line {
+		switch {
+		case '0' <= b && b <= '9':
+			b = b - '0'
+		case 'a' <= b && b <= 'f':
+			b = b - 'a' + 10
+		case 'A' <= b && b <= 'F':
+			b = b - 'A' + 10
+		default:
+			return 0, ErrInvalidChunk
+		}
+		size = size<<4 | int64(b)
+	}
+	return size, nil
+}
@@ -0,0 +1,131 @@
+package http1
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/zput/ringbuffer"
+	"github.com/zput/ringbuffer/codec"
+)
+
+const chunkedBody = "4\r\nWiki\r\n5;name=value\r\npedia\r\nE\r\n in\r\n\r\nchunks.\r\n0\r\nExpires: never\r\nX-Sum: 42\r\n\r\nNEXT"
+
+func TestChunkedReader(t *testing.T) {
+	rb := ringbuffer.NewWithData([]byte(chunkedBody))
+	c := NewChunkedReader()
+
+	var body []byte
+	buf := make([]byte, 3)
+	for {
+		n, err := c.Read(rb, buf)
+		body = append(body, buf[:n]...)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if string(body) != "Wikipedia in\r\n\r\nchunks." {
+		t.Fatalf("unexpected body %q", body)
+	}
+	if !c.Done() || len(c.Trailers) != 2 || string(c.Trailers.Get("x-sum")) != "42" {
+		t.Fatalf("unexpected trailers %q", c.Trailers)
+	}
+	if got := string(rb.ReadAll2NewByteSlice()); got != "NEXT" {
+		t.Fatalf("expect the next message left but got %q", got)
+	}
+}
+
+func TestChunkedReader_Streaming(t *testing.T) {
+	rb := ringbuffer.New(4)
+	c := NewChunkedReader()
+	buf := make([]byte, 64)
+
+	var body []byte
+	for i := 0; i < len(chunkedBody); i++ {
+		_ = rb.WriteOneByte(chunkedBody[i])
+		n, err := c.Read(rb, buf)
+		body = append(body, buf[:n]...)
+		if err == io.EOF {
+			if i != len(chunkedBody)-len("NEXT")-1 {
+				t.Fatalf("unexpected EOF at %d", i)
+			}
+			break
+		}
+		if err != nil && err != codec.ErrNeedMoreData {
+			t.Fatalf("at %d: %v", i, err)
+		}
+		// 数据一到达就可以读出来，不需要等待整个 chunk
+		if n == 0 && err == nil {
+			t.Fatalf("at %d: expect ErrNeedMoreData when nothing is read", i)
+		}
+	}
+	if string(body) != "Wikipedia in\r\n\r\nchunks." {
+		t.Fatalf("unexpected body %q", body)
+	}
+	if n, err := c.Read(rb, buf); n != 0 || err != io.EOF {
+		t.Fatalf("expect io.EOF again but got %d %v", n, err)
+	}
+
+	// Reset 之后可以解码下一个消息体
+	c.Reset()
+	rb.RetrieveAll()
+	_, _ = rb.WriteString("0\r\n\r\n")
+	if n, err := c.Read(rb, buf); n != 0 || err != io.EOF || len(c.Trailers) != 0 {
+		t.Fatalf("expect an empty body but got %d %v", n, err)
+	}
+}
+
+func TestChunkedReader_Errors(t *testing.T) {
+	cases := []struct {
+		raw    string
+		expect error
+	}{
+		{"x\r\n", ErrInvalidChunk},
+		{"\r\n", ErrInvalidChunk},
+		{"1000000000000000\r\n", ErrInvalidChunk},
+		{"1\r\nab\r\n", ErrInvalidChunk},
+		{"1\r\na\r\n0\r\nbad trailer\r\n\r\n", ErrInvalidHeader},
+		{"1;" + string(make([]byte, 32)) + "\r\n", ErrLineTooLong},
+		{"0\r\nX: " + string(make([]byte, 32)), ErrTrailerTooLarge},
+	}
+	for _, c := range cases {
+		rb := ringbuffer.NewWithData([]byte(c.raw))
+		r := NewChunkedReader()
+		r.MaxLineLength = 16
+		r.MaxTrailerBytes = 16
+		buf := make([]byte, 8)
+		var err error
+		for err == nil {
+			_, err = r.Read(rb, buf)
+		}
+		if err != c.expect {
+			t.Fatalf("%q: expect %v but got %v", c.raw, c.expect, err)
+		}
+	}
+}
+
+func TestChunkedReader_Reader(t *testing.T) {
+	rb := ringbuffer.New(8)
+	c := NewChunkedReader()
+	r := c.Reader(rb)
+
+	var body bytes.Buffer
+	half := len(chunkedBody) / 2
+	_, _ = rb.WriteString(chunkedBody[:half])
+	if _, err := io.Copy(&body, r); err != codec.ErrNeedMoreData {
+		t.Fatalf("expect ErrNeedMoreData but got %v", err)
+	}
+	_, _ = rb.WriteString(chunkedBody[half:])
+	if _, err := io.Copy(&body, r); err != nil {
+		t.Fatal(err)
+	}
+	if body.String() != "Wikipedia in\r\n\r\nchunks." || !c.Done() {
+		t.Fatalf("unexpected body %q", body.String())
+	}
+	if got := string(rb.ReadAll2NewByteSlice()); got != "NEXT" {
+		t.Fatalf("expect NEXT left but got %q", got)
+	}
+}
@@ -0,0 +1,280 @@
+// Package http1 直接从 RingBuffer 中增量地解析 HTTP/1.x 的消息头(请求行/状态行和头部)，
+// 并以流的方式解码 chunked 编码的消息体。
+//
+// 解析出来的切片在数据连续时直接引用缓存的内存(零拷贝)，只在下一次写入缓存之前有效。
+package http1
+
+import (
+	"bytes"
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/zput/ringbuffer"
+	"github.com/zput/ringbuffer/codec"
+)
+
+var ErrHeaderTooLarge = errors.New("message head exceeds the limit; http1")
+var ErrTooManyHeaders = errors.New("number of headers exceeds the limit; http1")
+var ErrInvalidRequestLine = errors.New("request line is malformed; http1")
+var ErrInvalidStatusLine = errors.New("status line is malformed; http1")
+var ErrInvalidHeader = errors.New("header field is malformed; http1")
+var ErrInvalidContentLength = errors.New("content-length is invalid; http1")
+var ErrUnsupportedTransferEncoding = errors.New("transfer-encoding is not chunked; http1")
+var ErrAmbiguousLength = errors.New("both transfer-encoding and content-length are present; http1")
+var ErrInvalidChunk = errors.New("chunk is malformed; http1")
+var ErrLineTooLong = errors.New("chunk line exceeds the limit; http1")
+var ErrTrailerTooLarge = errors.New("trailer section exceeds the limit; http1")
+
+// Header 是一个头部字段；Value 已经去掉了前后的空白。
+type Header struct {
+	Name  []byte
+	Value []byte
+}
+
+// Headers 按照收到的顺序保存头部字段，同名的字段可能出现多次。
+type Headers []Header
+
+// Get 返回第一个名字为 name(不区分大小写)的字段的值，不存在时返回 nil。
+func (h Headers) Get(name string) []byte {
+	for i := range h {
+		if equalFold(h[i].Name, name) {
+			return h[i].Value
+		}
+	}
+	return nil
+}
+
+// Has 返回是否存在名字为 name 的字段。
+func (h Headers) Has(name string) bool {
+	for i := range h {
+		if equalFold(h[i].Name, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// HasToken 返回名字为 name 的字段(逗号分隔的列表，例如 Connection)中是否有 token。
+func (h Headers) HasToken(name, token string) bool {
+	for i := range h {
+		if !equalFold(h[i].Name, name) {
+			continue
+		}
+		for v := h[i].Value; len(v) > 0; {
+			var elem []byte
+			if idx := bytes.IndexByte(v, ','); idx >= 0 {
+				elem, v = v[:idx], v[idx+1:]
+			} else {
+				elem, v = v, nil
+			}
+			if equalFold(trimOWS(elem), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ContentLength 返回 Content-Length 的值，不存在时返回 -1。
+// 多个 Content-Length 的值必须相同，否则返回 ErrInvalidContentLength(防止请求走私)。
+func (h Headers) ContentLength() (int64, error) {
+	length := int64(-1)
+	for i := range h {
+		if !equalFold(h[i].Name, "Content-Length") {
+			continue
+		}
+		for _, v := range bytes.Split(h[i].Value, []byte{','}) {
+			n, err := parseContentLength(trimOWS(v))
+			if err != nil {
+				return 0, err
+			}
+			if length >= 0 && n != length {
+				return 0, ErrInvalidContentLength
+			}
+			length = n
+		}
+	}
+	return length, nil
+}
+
+// framing 按照 RFC 7230 3.3.3 确定消息体的长度：chunked 为 true，或者 length 为 Content-Length(不存在时为 -1)。
+func (h Headers) framing() (length int64, chunked bool, err error) {
+	var last []byte
+	for i := range h {
+		if !equalFold(h[i].Name, "Transfer-Encoding") {
+			continue
+		}
+		v := h[i].Value
+		if idx := bytes.LastIndexByte(v, ','); idx >= 0 {
+			v = v[idx+1:]
+		}
+		last = trimOWS(v)
+	}
+	if last != nil {
+		if h.Has("Content-Length") {
+			return 0, false, ErrAmbiguousLength
+		}
+		if !equalFold(last, "chunked") {
+			return 0, false, ErrUnsupportedTransferEncoding
+		}
+		return -1, true, nil
+	}
+	length, err = h.ContentLength()
+	return length, false, err
+}
+
+func parseContentLength(b []byte) (int64, error) {
+	if len(b) == 0 {
+		return 0, ErrInvalidContentLength
+	}
+	for _, c := range b {
+		if c < '0' || c > '9' {
+			return 0, ErrInvalidContentLength
+		}
+	}
+	n, err := strconv.ParseInt(string(b), 10, 64)
+	if err != nil {
+		return 0, ErrInvalidContentLength
+	}
+	return n, nil
+}
+
+// equalFold 是不区分 ASCII 大小写的比较，不分配内存。
+func equalFold(b []byte, s string) bool {
+	if len(b) != len(s) {
+		return false
+	}
+	for i := 0; i < len(b); i++ {
+		if toLower(b[i]) != toLower(s[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func toLower(c byte) byte {
+	if 'A' <= c && c <= 'Z' {
+		return c + 'a' - 'A'
+	}
+	return c
+}
+
+func trimOWS(b []byte) []byte {
+	for len(b) > 0 && (b[0] == ' ' || b[0] == '\t') {
+		b = b[1:]
+	}
+	for len(b) > 0 && (b[len(b)-1] == ' ' || b[len(b)-1] == '\t') {
+		b = b[:len(b)-1]
+	}
+	return b
+}
+
+// isTokenChar 见 RFC 7230 3.2.6 的 tchar。
+func isTokenChar(c byte) bool {
+	switch {
+	case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9':
+		return true
+	}
+	return strings.IndexByte("!#$%&'*+-.^_`|~", c) >= 0
+}
+
+func isToken(b []byte) bool {
+	if len(b) == 0 {
+		return false
+	}
+	for _, c := range b {
+		if !isTokenChar(c) {
+			return false
+		}
+	}
+	return true
+}
+
+// isFieldValue 检查字段的值中没有除了 HTAB 之外的控制字符。
+func isFieldValue(b []byte) bool {
+	for _, c := range b {
+		if c != '\t' && (c < 0x20 || c == 0x7f) {
+			return false
+		}
+	}
+	return true
+}
+
+// parseHeader 解析一行 "name: value"；不允许 name 与冒号之间有空白，也不允许 obs-fold。
+func parseHeader(line []byte) (Header, error) {
+	colon := bytes.IndexByte(line, ':')
+	if colon <= 0 || !isToken(line[:colon]) {
+		return Header{}, ErrInvalidHeader
+	}
+	value := trimOWS(line[colon+1:])
+	if !isFieldValue(value) {
+		return Header{}, ErrInvalidHeader
+	}
+	return Header{Name: line[:colon], Value: value}, nil
+}
+
+// segments 是 Peek 返回的两段数据，当作一段连续的数据来访问。
+type segments struct {
+	first, end []byte
+}
+
+func (s segments) len() int {
+	return len(s.first) + len(s.end)
+}
+
+func (s segments) at(i int) byte {
+	if i < len(s.first) {
+		return s.first[i]
+	}
+	return s.end[i-len(s.first)]
+}
+
+func (s segments) indexByte(from int, c byte) int {
+	if from < len(s.first) {
+		if i := bytes.IndexByte(s.first[from:], c); i >= 0 {
+			return from + i
+		}
+		from = len(s.first)
+	}
+	if i := bytes.IndexByte(s.end[from-len(s.first):], c); i >= 0 {
+		return from + i
+	}
+	return -1
+}
+
+// slice 返回 [from, to) 的数据；在同一段中时直接引用，跨越两段时拷贝到一个新的切片中。
+func (s segments) slice(from, to int) []byte {
+	n := len(s.first)
+	switch {
+	case to <= n:
+		return s.first[from:to]
+	case from >= n:
+		return s.end[from-n : to-n]
+	}
+	buf := make([]byte, to-from)
+	copy(buf, s.first[from:])
+	copy(buf[n-from:], s.end[:to-n])
+	return buf
+}
+
+// peekLine 返回读指针处的一行(不包括 "\r\n" 或 "\n")以及这一行占用的字节数，不消费数据。
+func peekLine(rb *ringbuffer.RingBuffer, max int) (line []byte, n int, err error) {
+	first, end := rb.Peek(max+2, false)
+	s := segments{first, end}
+	idx := s.indexByte(0, '\n')
+	if idx < 0 {
+		if s.len() > max+1 {
+			return nil, 0, ErrLineTooLong
+		}
+		return nil, 0, codec.ErrNeedMoreData
+	}
+	line = s.slice(0, idx)
+	if len(line) > 0 && line[len(line)-1] == '\r' {
+		line = line[:len(line)-1]
+	}
+	if len(line) > max {
+		return nil, 0, ErrLineTooLong
+	}
+	return line, idx + 1, nil
+}
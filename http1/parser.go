@@ -0,0 +1,304 @@
+package http1
+
+import (
+	"bytes"
+
+	"github.com/zput/ringbuffer"
+	"github.com/zput/ringbuffer/codec"
+)
+
+const (
+	DefaultMaxHeaderBytes = 64 * 1024
+	DefaultMaxHeaders     = 100
+)
+
+// Request 是请求的消息头。
+type Request struct {
+	Method     []byte
+	URI        []byte
+	ProtoMajor int
+	ProtoMinor int
+	Headers    Headers
+}
+
+// KeepAlive 返回请求之后连接是否可以复用。
+func (r *Request) KeepAlive() bool {
+	return keepAlive(r.ProtoMajor, r.ProtoMinor, r.Headers)
+}
+
+// BodyLength 返回请求体的长度；chunked 为 true 时长度由 chunk 决定，此时 length 为 -1。
+func (r *Request) BodyLength() (length int64, chunked bool, err error) {
+	length, chunked, err = r.Headers.framing()
+	if err == nil && !chunked && length < 0 {
+		length = 0
+	}
+	return
+}
+
+// Response 是响应的消息头。
+type Response struct {
+	ProtoMajor int
+	ProtoMinor int
+	StatusCode int
+	Reason     []byte
+	Headers    Headers
+}
+
+// KeepAlive 返回响应之后连接是否可以复用。
+func (r *Response) KeepAlive() bool {
+	return keepAlive(r.ProtoMajor, r.ProtoMinor, r.Headers)
+}
+
+/*
+BodyLength 返回响应体的长度：
+
+  - 1xx/204/304 的响应没有响应体，length 为 0；
+  - chunked 为 true 时长度由 chunk 决定，此时 length 为 -1；
+  - 既没有 chunked 也没有 Content-Length 时 length 为 -1，响应体一直到连接关闭。
+
+HEAD 请求的响应没有响应体，需要调用者自己判断。
+*/
+func (r *Response) BodyLength() (length int64, chunked bool, err error) {
+	if r.StatusCode/100 == 1 || r.StatusCode == 204 || r.StatusCode == 304 {
+		return 0, false, nil
+	}
+	length, chunked, err = r.Headers.framing()
+	if err == ErrUnsupportedTransferEncoding {
+		return -1, false, nil
+	}
+	return
+}
+
+func keepAlive(major, minor int, h Headers) bool {
+	if h.HasToken("Connection", "close") {
+		return false
+	}
+	if major == 1 && minor == 0 {
+		return h.HasToken("Connection", "keep-alive")
+	}
+	return true
+}
+
+// Parser 增量地解析消息头：消息头不完整时记住已经扫描过的位置，数据到达后从这里继续扫描；
+// 换了缓存，或者缓存的 ReadOffset() 变了(数据被其他人消费了)时从头扫描。
+// 保存着扫描的状态，每个连接一个，不是线程安全的。
+type Parser struct {
+	MaxHeaderBytes int // 消息头(包括起始行和结束的空行)的最大长度
+	MaxHeaders     int // 头部字段的最大个数
+
+	scanned   int                    // 已经扫描过、确定不是消息头结束位置的字节数
+	scannedRB *ringbuffer.RingBuffer // scanned 所属的缓存
+	scannedAt uint64                 // 扫描时缓存的 ReadOffset()
+}
+
+// NewParser 返回使用默认限制的 Parser。
+func NewParser() *Parser {
+	return &Parser{
+		MaxHeaderBytes: DefaultMaxHeaderBytes,
+		MaxHeaders:     DefaultMaxHeaders,
+	}
+}
+
+// Reset 丢弃扫描的状态，例如连接上的数据被其他人消费之后。
+func (p *Parser) Reset() {
+	p.scanned = 0
+	p.scannedRB = nil
+}
+
+/*
+ParseRequest 从 rb 中解析一个请求的消息头到 req 中(复用 req.Headers 的空间)，并消费消息头。
+
+消息头不完整时返回 codec.ErrNeedMoreData；出错时不消费数据(请求行之前的空行除外)。
+消息头在缓存中连续时，req 中的切片直接引用缓存的内存，只在下一次写入 rb 之前有效。
+no thread safety guarantees
+*/
+func (p *Parser) ParseRequest(rb *ringbuffer.RingBuffer, req *Request) error {
+	head, err := p.peekHead(rb)
+	if err != nil {
+		return err
+	}
+	line, rest := nextLine(head)
+	req.Headers = req.Headers[:0]
+	if err = p.parseRequestLine(line, req); err != nil {
+		return err
+	}
+	if req.Headers, err = p.parseHeaders(rest, req.Headers); err != nil {
+		return err
+	}
+	p.consume(rb, len(head))
+	return nil
+}
+
+// ParseResponse 与 ParseRequest 相同，解析一个响应的消息头。
+func (p *Parser) ParseResponse(rb *ringbuffer.RingBuffer, resp *Response) error {
+	head, err := p.peekHead(rb)
+	if err != nil {
+		return err
+	}
+	line, rest := nextLine(head)
+	resp.Headers = resp.Headers[:0]
+	if err = p.parseStatusLine(line, resp); err != nil {
+		return err
+	}
+	if resp.Headers, err = p.parseHeaders(rest, resp.Headers); err != nil {
+		return err
+	}
+	p.consume(rb, len(head))
+	return nil
+}
+
+func (p *Parser) consume(rb *ringbuffer.RingBuffer, n int) {
+	_, _ = rb.Discard(n)
+	p.scanned = 0
+}
+
+// peekHead 返回完整的消息头(包括结束的空行)，不消费数据。
+func (p *Parser) peekHead(rb *ringbuffer.RingBuffer) ([]byte, error) {
+	if rb != p.scannedRB || rb.ReadOffset() != p.scannedAt {
+		// 之前的扫描结果不属于现在缓存中的数据
+		p.scanned = 0
+	}
+	// 忽略起始行之前的空行，见 RFC 7230 3.5
+	for p.scanned == 0 {
+		first, _ := rb.Peek(1, false)
+		if len(first) == 0 {
+			return nil, codec.ErrNeedMoreData
+		}
+		if first[0] != '\r' && first[0] != '\n' {
+			break
+		}
+		_, _ = rb.Discard(1)
+	}
+
+	first, end := rb.Peek(p.MaxHeaderBytes, false)
+	s := segments{first, end}
+	if p.scanned > s.len() {
+		p.scanned = 0
+	}
+	p.scannedRB, p.scannedAt = rb, rb.ReadOffset()
+	for i := p.scanned; ; {
+		idx := s.indexByte(i, '\n')
+		if idx < 0 {
+			p.scanned = s.len()
+			break
+		}
+		// 换行之后紧跟着 "\n" 或者 "\r\n" 就是消息头的结束
+		if idx+1 < s.len() && s.at(idx+1) == '\n' {
+			return s.slice(0, idx+2), nil
+		}
+		if idx+1 < s.len() && s.at(idx+1) == '\r' {
+			if idx+2 < s.len() && s.at(idx+2) == '\n' {
+				return s.slice(0, idx+3), nil
+			}
+		}
+		if idx+2 >= s.len() {
+			// 还不能确定，下次从这个换行继续
+			p.scanned = idx
+			break
+		}
+		i = idx + 1
+	}
+	if s.len() >= p.MaxHeaderBytes {
+		return nil, ErrHeaderTooLarge
+	}
+	return nil, codec.ErrNeedMoreData
+}
+
+// parseRequestLine 解析 "method SP request-target SP HTTP-version"。
+func (p *Parser) parseRequestLine(line []byte, req *Request) error {
+	sp1 := bytes.IndexByte(line, ' ')
+	if sp1 <= 0 {
+		return ErrInvalidRequestLine
+	}
+	sp2 := bytes.IndexByte(line[sp1+1:], ' ')
+	if sp2 <= 0 {
+		return ErrInvalidRequestLine
+	}
+	sp2 += sp1 + 1
+
+	req.Method = line[:sp1]
+	req.URI = line[sp1+1 : sp2]
+	if !isToken(req.Method) || !isFieldValue(req.URI) || bytes.IndexByte(req.URI, '\t') >= 0 {
+		return ErrInvalidRequestLine
+	}
+	var ok bool
+	if req.ProtoMajor, req.ProtoMinor, ok = parseVersion(line[sp2+1:]); !ok {
+		return ErrInvalidRequestLine
+	}
+	return nil
+}
+
+// parseStatusLine 解析 "HTTP-version SP status-code SP reason-phrase"，允许没有 reason-phrase。
+func (p *Parser) parseStatusLine(line []byte, resp *Response) error {
+	if len(line) < 12 || line[8] != ' ' || (len(line) > 12 && line[12] != ' ') {
+		return ErrInvalidStatusLine
+	}
+	var ok bool
+	if resp.ProtoMajor, resp.ProtoMinor, ok = parseVersion(line[:8]); !ok {
+		return ErrInvalidStatusLine
+	}
+	resp.StatusCode = 0
+	for _, c := range line[9:12] {
+		if c < '0' || c > '9' {
+			return ErrInvalidStatusLine
+		}
+		resp.StatusCode = resp.StatusCode*10 + int(c-'0')
+	}
+	if resp.StatusCode < 100 {
+		return ErrInvalidStatusLine
+	}
+	resp.Reason = nil
+	if len(line) > 12 {
+		resp.Reason = line[13:]
+		if !isFieldValue(resp.Reason) {
+			return ErrInvalidStatusLine
+		}
+	}
+	return nil
+}
+
+func (p *Parser) parseHeaders(rest []byte, headers Headers) (Headers, error) {
+	for {
+		var line []byte
+		line, rest = nextLine(rest)
+		if len(line) == 0 {
+			return headers, nil
+		}
+		// obs-fold 已经被 RFC 7230 废弃，直接拒绝
+		if line[0] == ' ' || line[0] == '\t' {
+			return headers, ErrInvalidHeader
+		}
+		h, err := parseHeader(line)
+		if err != nil {
+			return headers, err
+		}
+		if len(headers) >= p.MaxHeaders {
+			return headers, ErrTooManyHeaders
+		}
+		headers = append(headers, h)
+	}
+}
+
+// parseVersion 解析 "HTTP/x.y"。
+func parseVersion(b []byte) (major, minor int, ok bool) {
+	if len(b) != 8 || string(b[:5]) != "HTTP/" || b[6] != '.' {
+		return 0, 0, false
+	}
+	if b[5] < '0' || b[5] > '9' || b[7] < '0' || b[7] > '9' {
+		return 0, 0, false
+	}
+	return int(b[5] - '0'), int(b[7] - '0'), true
+}
+
+// nextLine 返回 b 中的第一行(去掉 "\r\n" 或 "\n")以及剩下的数据；b 一定以空行结束。
+func nextLine(b []byte) (line, rest []byte) {
+	idx := bytes.IndexByte(b, '\n')
+	if idx < 0 {
+		return b, nil
+	}
+	line, rest = b[:idx], b[idx+1:]
+	if len(line) > 0 && line[len(line)-1] == '\r' {
+		line = line[:len(line)-1]
+	}
+	return line, rest
+}
@@ -0,0 +1,207 @@
+package http1
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/zput/ringbuffer"
+	"github.com/zput/ringbuffer/codec"
+)
+
+func TestParser_ParseRequest(t *testing.T) {
+	raw := "\r\nPOST /upload?x=1 HTTP/1.1\r\n" +
+		"Host: example.com\r\n" +
+		"Content-Type:text/plain \r\n" +
+		"Transfer-Encoding: gzip, chunked\r\n" +
+		"Connection: Upgrade, close\r\n" +
+		"\r\n" +
+		"body"
+	rb := ringbuffer.New(16)
+	_, _ = rb.WriteString(raw)
+
+	p := NewParser()
+	var req Request
+	if err := p.ParseRequest(rb, &req); err != nil {
+		t.Fatal(err)
+	}
+	if string(req.Method) != "POST" || string(req.URI) != "/upload?x=1" || req.ProtoMajor != 1 || req.ProtoMinor != 1 {
+		t.Fatalf("unexpected request line %q %q %d.%d", req.Method, req.URI, req.ProtoMajor, req.ProtoMinor)
+	}
+	if len(req.Headers) != 4 || string(req.Headers.Get("content-type")) != "text/plain" {
+		t.Fatalf("unexpected headers %q", req.Headers)
+	}
+	if req.KeepAlive() {
+		t.Fatal("expect not keep alive")
+	}
+	if length, chunked, err := req.BodyLength(); length != -1 || !chunked || err != nil {
+		t.Fatalf("unexpected body length %d %v %v", length, chunked, err)
+	}
+	if got := string(rb.ReadAll2NewByteSlice()); got != "body" {
+		t.Fatalf("expect only the head consumed but left %q", got)
+	}
+}
+
+func TestParser_Resume(t *testing.T) {
+	raw := "GET / HTTP/1.0\r\nHost: a\r\nConnection: keep-alive\r\n\r\n"
+	rb := ringbuffer.New(8)
+	p := NewParser()
+	var req Request
+
+	for i := 0; i < len(raw)-1; i++ {
+		_ = rb.WriteOneByte(raw[i])
+		if err := p.ParseRequest(rb, &req); err != codec.ErrNeedMoreData {
+			t.Fatalf("at %d: expect ErrNeedMoreData but got %v", i, err)
+		}
+		if rb.Size() != i+1 {
+			t.Fatalf("at %d: nothing should be consumed", i)
+		}
+		// 下一次从上次停下的地方继续扫描，而不是从头开始
+		if p.scanned < i-2 {
+			t.Fatalf("at %d: expect resuming from near the end but scanned %d", i, p.scanned)
+		}
+	}
+	_ = rb.WriteOneByte(raw[len(raw)-1])
+	if err := p.ParseRequest(rb, &req); err != nil {
+		t.Fatal(err)
+	}
+	if !req.KeepAlive() || req.ProtoMinor != 0 || string(req.Headers.Get("HOST")) != "a" {
+		t.Fatalf("unexpected request %+v", req)
+	}
+	if !rb.IsEmpty() || p.scanned != 0 {
+		t.Fatal("expect the head consumed and the parser reset")
+	}
+}
+
+// TestParser_Consumed 扫描状态属于缓存中的数据，数据被其他人消费以后从头扫描。
+func TestParser_Consumed(t *testing.T) {
+	rb := ringbuffer.New(64)
+	p := NewParser()
+	var req Request
+
+	_, _ = rb.WriteString("GET / HTTP/1.1\r\nX: yyyyyyyyyyyy")
+	if err := p.ParseRequest(rb, &req); err != codec.ErrNeedMoreData {
+		t.Fatalf("expect ErrNeedMoreData but got %v", err)
+	}
+	// 其他人消费了这个不完整的消息头，换成新的数据
+	rb.RetrieveAll()
+	_, _ = rb.WriteString("GET /a HTTP/1.1\r\n\r\nGET /b HTTP/1.1\r\n\r\n")
+	if err := p.ParseRequest(rb, &req); err != nil || string(req.URI) != "/a" {
+		t.Fatalf("expect /a but got %q %v", req.URI, err)
+	}
+	if rb.Size() != len("GET /b HTTP/1.1\r\n\r\n") {
+		t.Fatalf("expect only the first head consumed but left %d bytes", rb.Size())
+	}
+
+	// 换了一个缓存
+	other := ringbuffer.New(64)
+	_, _ = other.WriteString("GET /c HTTP/1.1\r\nX: yyyyyyyyyyyy")
+	if err := p.ParseRequest(other, &req); err != codec.ErrNeedMoreData {
+		t.Fatalf("expect ErrNeedMoreData but got %v", err)
+	}
+	if err := p.ParseRequest(rb, &req); err != nil || string(req.URI) != "/b" {
+		t.Fatalf("expect /b but got %q %v", req.URI, err)
+	}
+}
+
+func TestParser_ZeroCopy(t *testing.T) {
+	rb := ringbuffer.New(64)
+	_, _ = rb.WriteString("GET / HTTP/1.1\r\nX-Key: value\r\n\r\n")
+	raw, _ := rb.PeekAll(false)
+
+	var req Request
+	if err := NewParser().ParseRequest(rb, &req); err != nil {
+		t.Fatal(err)
+	}
+	v := req.Headers.Get("x-key")
+	if string(v) != "value" || &v[0] != &raw[strings.Index(string(raw), "value")] {
+		t.Fatal("expect the header value to reference the ring buffer")
+	}
+}
+
+func TestParser_ParseResponse(t *testing.T) {
+	cases := []struct {
+		raw     string
+		code    int
+		reason  string
+		length  int64
+		chunked bool
+	}{
+		{"HTTP/1.1 200 OK\r\nContent-Length: 12\r\n\r\n", 200, "OK", 12, false},
+		{"HTTP/1.1 204 No Content\r\n\r\n", 204, "No Content", 0, false},
+		{"HTTP/1.1 404\nTransfer-Encoding: chunked\n\n", 404, "", -1, true},
+		{"HTTP/1.0 200 OK\r\n\r\n", 200, "OK", -1, false},
+		{"HTTP/1.1 200 OK\r\nContent-Length: 3, 3\r\nContent-Length: 3\r\n\r\n", 200, "OK", 3, false},
+	}
+	p := NewParser()
+	var resp Response
+	for _, c := range cases {
+		rb := ringbuffer.New(8)
+		_, _ = rb.WriteString(c.raw)
+		if err := p.ParseResponse(rb, &resp); err != nil {
+			t.Fatalf("%q: %v", c.raw, err)
+		}
+		if resp.StatusCode != c.code || string(resp.Reason) != c.reason {
+			t.Fatalf("%q: unexpected status %d %q", c.raw, resp.StatusCode, resp.Reason)
+		}
+		length, chunked, err := resp.BodyLength()
+		if length != c.length || chunked != c.chunked || err != nil {
+			t.Fatalf("%q: unexpected body length %d %v %v", c.raw, length, chunked, err)
+		}
+	}
+}
+
+func TestParser_Errors(t *testing.T) {
+	p := NewParser()
+	p.MaxHeaderBytes = 64
+	p.MaxHeaders = 2
+
+	cases := []struct {
+		raw    string
+		expect error
+	}{
+		{"GET /\r\n\r\n", ErrInvalidRequestLine},
+		{"GET  / HTTP/1.1\r\n\r\n", ErrInvalidRequestLine},
+		{"G(T / HTTP/1.1\r\n\r\n", ErrInvalidRequestLine},
+		{"GET / HTTP/1.1 \r\n\r\n", ErrInvalidRequestLine},
+		{"GET / HTTP/1.1\r\nHost : a\r\n\r\n", ErrInvalidHeader},
+		{"GET / HTTP/1.1\r\nHost: a\r\n b\r\n\r\n", ErrInvalidHeader},
+		{"GET / HTTP/1.1\r\nNoColon\r\n\r\n", ErrInvalidHeader},
+		{"GET / HTTP/1.1\r\nX: a\x00b\r\n\r\n", ErrInvalidHeader},
+		{"GET / HTTP/1.1\r\nA: 1\r\nB: 2\r\nC: 3\r\n\r\n", ErrTooManyHeaders},
+		{"GET / HTTP/1.1\r\nX: " + strings.Repeat("a", 64) + "\r\n\r\n", ErrHeaderTooLarge},
+		{"GET / HTTP/1.1\r\nX: " + strings.Repeat("a", 64), ErrHeaderTooLarge},
+	}
+	for _, c := range cases {
+		rb := ringbuffer.New(8)
+		_, _ = rb.WriteString(c.raw)
+		var req Request
+		if err := p.ParseRequest(rb, &req); err != c.expect {
+			t.Fatalf("%q: expect %v but got %v", c.raw, c.expect, err)
+		}
+		if rb.Size() != len(c.raw) {
+			t.Fatalf("%q: nothing should be consumed", c.raw)
+		}
+		p.Reset()
+	}
+
+	bodyCases := []struct {
+		raw    string
+		expect error
+	}{
+		{"POST / HTTP/1.1\r\nContent-Length: 1\r\nContent-Length: 2\r\n\r\n", ErrInvalidContentLength},
+		{"POST / HTTP/1.1\r\nContent-Length: +1\r\n\r\n", ErrInvalidContentLength},
+		{"POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\nContent-Length: 1\r\n\r\n", ErrAmbiguousLength},
+		{"POST / HTTP/1.1\r\nTransfer-Encoding: chunked, gzip\r\n\r\n", ErrUnsupportedTransferEncoding},
+	}
+	p = NewParser()
+	for _, c := range bodyCases {
+		rb := ringbuffer.NewWithData([]byte(c.raw))
+		var req Request
+		if err := p.ParseRequest(rb, &req); err != nil {
+			t.Fatalf("%q: %v", c.raw, err)
+		}
+		if _, _, err := req.BodyLength(); err != c.expect {
+			t.Fatalf("%q: expect %v but got %v", c.raw, c.expect, err)
+		}
+	}
+}
@@ -0,0 +1,190 @@
+package ringbuffer
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// runWithTimeout 在 timeout 内没有执行完 f 时认为发生了死锁。
+func runWithTimeout(t *testing.T, timeout time.Duration, f func()) {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		f()
+	}()
+	select {
+	case <-done:
+	case <-time.After(timeout):
+		t.Fatal("deadlock")
+	}
+}
+
+func TestLock_RetrieveNoop(t *testing.T) {
+	rb := New(4, true)
+	runWithTimeout(t, time.Second, func() {
+		// 空缓存与非正数长度的 Retrieve 也要解锁
+		rb.Retrieve(1)
+		_, _ = rb.WriteString("ab")
+		rb.Retrieve(0)
+		rb.Retrieve(-1)
+		if rb.Size() != 2 {
+			t.Errorf("expect size 2 but got %d", rb.Size())
+		}
+	})
+}
+
+func TestLock_PeekBehindWriter(t *testing.T) {
+	rb := New(4, true)
+	_, _ = rb.Write([]byte{0, 1, 2, 3})
+	runWithTimeout(t, 5*time.Second, func() {
+		var wg sync.WaitGroup
+		for i := 0; i < 4; i++ {
+			wg.Add(2)
+			go func() {
+				defer wg.Done()
+				for j := 0; j < 2000; j++ {
+					_ = rb.PeekUint16(false)
+					_ = rb.PeekUint32(false)
+					_ = rb.PeekUint64(false)
+					_ = rb.PrintRingBufferInfo()
+				}
+			}()
+			// 等待中的写者会阻塞新的读锁，重复加读锁就会死锁
+			go func() {
+				defer wg.Done()
+				for j := 0; j < 2000; j++ {
+					_ = rb.WriteByte(byte(j))
+					_, _ = rb.ReadByte()
+				}
+			}()
+		}
+		wg.Wait()
+	})
+}
+
+// TestLock_Stress 每个导出的函数都与写入、读取的 goroutine 并发执行，用 go test -race 检查数据竞争与死锁。
+func TestLock_Stress(t *testing.T) {
+	const rounds = 500
+	methods := map[string]func(rb *RingBuffer){
+		"Capacity":             func(rb *RingBuffer) { _ = rb.Capacity() },
+		"Size":                 func(rb *RingBuffer) { _ = rb.Size() },
+		"IsFull":               func(rb *RingBuffer) { _ = rb.IsFull() },
+		"IsEmpty":              func(rb *RingBuffer) { _ = rb.IsEmpty() },
+		"Write":                func(rb *RingBuffer) { _, _ = rb.Write([]byte("abc")) },
+		"WriteString":          func(rb *RingBuffer) { _, _ = rb.WriteString("abc") },
+		"WriteOneByte":         func(rb *RingBuffer) { _ = rb.WriteOneByte('a') },
+		"WriteByte":            func(rb *RingBuffer) { _ = rb.WriteByte('a') },
+		"Read":                 func(rb *RingBuffer) { _, _ = rb.Read(make([]byte, 3)) },
+		"ReadOneByte":          func(rb *RingBuffer) { _, _ = rb.ReadOneByte() },
+		"ReadByte":             func(rb *RingBuffer) { _, _ = rb.ReadByte() },
+		"ReadAll2NewByteSlice": func(rb *RingBuffer) { _ = rb.ReadAll2NewByteSlice() },
+		"Retrieve":             func(rb *RingBuffer) { rb.Retrieve(2) },
+		"Discard":              func(rb *RingBuffer) { _, _ = rb.Discard(2) },
+		"Deque": func(rb *RingBuffer) {
+			_, _ = rb.WriteFront([]byte("ab"))
+			f, e, _ := rb.PeekBack(1)
+			_ = len(f) + len(e)
+			_, _ = rb.ReadBack(make([]byte, 1))
+			_ = rb.TruncateTail(1)
+		},
+		"WriteTx": func(rb *RingBuffer) {
+			rb.WriteBegin()
+			_, _ = rb.WriteString("abc")
+			_ = rb.PendingSize()
+			if rb.Size()%2 == 0 {
+				_ = rb.WriteCommit()
+			} else {
+				_ = rb.WriteRollback()
+			}
+		},
+		"Patch": func(rb *RingBuffer) {
+			mark := rb.MarkWrite()
+			_, _ = rb.WriteString("abcd")
+			_ = rb.PatchUint32BE(mark, uint32(rb.WrittenSince(mark)))
+		},
+		"History": func(rb *RingBuffer) {
+			_ = rb.Rewind(rb.HistorySize())
+			_ = rb.CopyFromHistory(1, 2)
+		},
+		"Offset": func(rb *RingBuffer) {
+			_, _, _ = rb.PeekAbs(rb.ReadOffset(), 2)
+			_ = rb.DiscardTo(rb.WriteOffset())
+		},
+		"RetrieveAll":         func(rb *RingBuffer) { rb.RetrieveAll() },
+		"Reset":               func(rb *RingBuffer) { rb.Reset() },
+		"PrintRingBufferInfo": func(rb *RingBuffer) { _ = rb.PrintRingBufferInfo() },
+		// 返回的切片引用缓存的内存，并发写入时只能看长度
+		"Peek":       func(rb *RingBuffer) { f, e := rb.Peek(3, false); _ = len(f) + len(e) },
+		"PeekAll":    func(rb *RingBuffer) { f, e := rb.PeekAll(true); _ = len(f) + len(e) },
+		"PeekUint8":  func(rb *RingBuffer) { _ = rb.PeekUint8(false) },
+		"PeekUint16": func(rb *RingBuffer) { _ = rb.PeekUint16(true) },
+		"PeekUint32": func(rb *RingBuffer) { _ = rb.PeekUint32(false) },
+		"PeekUint64": func(rb *RingBuffer) { _ = rb.PeekUint64(true) },
+		"PeekTyped": func(rb *RingBuffer) {
+			_, _ = rb.PeekByte(false)
+			_, _ = rb.PeekUint16LE(true)
+			_, _ = rb.PeekUint32BE(false)
+			_, _ = rb.PeekUint64LE(true)
+		},
+		"Explore": func(rb *RingBuffer) {
+			rb.ExploreBegin()
+			_, _ = rb.ExploreRead(make([]byte, 2))
+			_ = rb.ExploreRetrieve(1)
+			_, _ = rb.ExploreDiscard(1)
+			_ = rb.ExploreSize()
+			if rb.Size()%2 == 0 {
+				rb.ExploreCommit()
+			} else {
+				rb.ExploreBreak()
+			}
+		},
+		"Cursor": func(rb *RingBuffer) {
+			c := rb.NewCursor()
+			_, _ = c.Read(make([]byte, 2))
+			_, _ = c.Seek(0, 2)
+			_ = c.Buffered()
+			_ = c.Commit()
+		},
+		"BeginExplore": func(rb *RingBuffer) {
+			tx := rb.BeginExplore()
+			_, _ = tx.PeekUint32()
+			_, _ = tx.Read(make([]byte, 2))
+			_ = tx.Commit()
+		},
+	}
+
+	for name, method := range methods {
+		method := method
+		t.Run(name, func(t *testing.T) {
+			rb := New(4, true)
+			runWithTimeout(t, 10*time.Second, func() {
+				var wg sync.WaitGroup
+				wg.Add(4)
+				go func() {
+					defer wg.Done()
+					p := []byte("01234567")
+					for i := 0; i < rounds; i++ {
+						_, _ = rb.Write(p[:1+i%len(p)])
+					}
+				}()
+				go func() {
+					defer wg.Done()
+					p := make([]byte, 3)
+					for i := 0; i < rounds; i++ {
+						_, _ = rb.Read(p[:1+i%len(p)])
+					}
+				}()
+				for g := 0; g < 2; g++ {
+					go func() {
+						defer wg.Done()
+						for i := 0; i < rounds; i++ {
+							method(rb)
+						}
+					}()
+				}
+				wg.Wait()
+			})
+		})
+	}
+}
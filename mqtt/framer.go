@@ -0,0 +1,155 @@
+package mqtt
+
+import (
+	"github.com/zput/ringbuffer"
+	"github.com/zput/ringbuffer/codec"
+)
+
+// DefaultMaxPacketSize 是默认的最大报文长度(包括固定报头)。
+const DefaultMaxPacketSize = 1024 * 1024
+
+// Packet 是一个完整的控制报文。
+type Packet struct {
+	Type  PacketType
+	Flags byte
+	// 可变报头与有效载荷；跨越缓存尾部时分成两段，First 在前、End 在后
+	First []byte
+	End   []byte
+}
+
+// Length 返回剩余长度，即 First 与 End 的总长度。
+func (p Packet) Length() int {
+	return len(p.First) + len(p.End)
+}
+
+// Bytes 返回可变报头与有效载荷；只有一段时直接返回，否则拷贝到一个新的切片中。
+func (p Packet) Bytes() []byte {
+	if len(p.End) == 0 {
+		return p.First
+	}
+	buf := make([]byte, p.Length())
+	copy(buf, p.First)
+	copy(buf[len(p.First):], p.End)
+	return buf
+}
+
+// Framer 把 RingBuffer 中的字节流切分成控制报文；没有状态，可以在多个连接之间共享。
+type Framer struct {
+	// 报文(包括固定报头)的最大长度，对应 MQTT 5.0 的 Maximum Packet Size
+	MaxPacketSize int
+}
+
+// NewFramer 返回一个最大报文长度为 maxPacketSize 的 Framer；maxPacketSize 为 0 时使用 DefaultMaxPacketSize。
+func NewFramer(maxPacketSize int) (*Framer, error) {
+	if maxPacketSize < 0 {
+		return nil, codec.ErrInitCodecParameter
+	}
+	if maxPacketSize == 0 {
+		maxPacketSize = DefaultMaxPacketSize
+	}
+	return &Framer{MaxPacketSize: maxPacketSize}, nil
+}
+
+/*
+Next 从 rb 中取出一个完整的控制报文，并消费它。
+
+报文不完整时返回 codec.ErrNeedMoreData，不消费任何数据；出错时同样不消费数据，这时连接应该被关闭。
+Packet 中的 First/End 直接引用 rb 的内存，只在下一次写入 rb 之前有效。
+no thread safety guarantees
+*/
+func (f *Framer) Next(rb *ringbuffer.RingBuffer) (Packet, error) {
+	p, headerLength, err := f.peek(rb)
+	if err != nil {
+		return Packet{}, err
+	}
+	_, _ = rb.Discard(headerLength + p.Length())
+	return p, nil
+}
+
+// Peek 与 Next 相同，但是不消费报文；之后用 rb.Discard(n) 消费，n 是返回的报文总长度。
+func (f *Framer) Peek(rb *ringbuffer.RingBuffer) (p Packet, n int, err error) {
+	p, headerLength, err := f.peek(rb)
+	if err != nil {
+		return Packet{}, 0, err
+	}
+	return p, headerLength + p.Length(), nil
+}
+
+func (f *Framer) peek(rb *ringbuffer.RingBuffer) (p Packet, headerLength int, err error) {
+	var length int
+	p.Type, p.Flags, headerLength, length, err = f.parseFixedHeader(rb, false)
+	if err != nil {
+		return Packet{}, 0, err
+	}
+
+	first, end := rb.Peek(headerLength+length, false)
+	if len(first) > headerLength {
+		p.First, p.End = first[headerLength:], end
+	} else {
+		// 固定报头本身跨越了缓存的尾部
+		p.First = end[headerLength-len(first):]
+	}
+	return p, headerLength, nil
+}
+
+// Decode 实现 codec.Decoder：读出整个报文(包括固定报头)到一个新的切片中，只移动 explore 游标。
+func (f *Framer) Decode(rb *ringbuffer.RingBuffer) ([]byte, error) {
+	_, _, headerLength, length, err := f.parseFixedHeader(rb, true)
+	if err != nil {
+		return nil, err
+	}
+	return codec.ExploreNext(rb, headerLength+length)
+}
+
+// parseFixedHeader 解析读指针(或者 explore 游标)处的固定报头，并确认整个报文都已经在缓存中。
+func (f *Framer) parseFixedHeader(rb *ringbuffer.RingBuffer, isUsingExplore bool) (t PacketType, flags byte, headerLength, length int, err error) {
+	// 固定报头最多 5 个字节，剩余长度可能跨越缓存的尾部
+	var buf [5]byte
+	first, end := rb.Peek(len(buf), isUsingExplore)
+	header := append(append(buf[:0], first...), end...)
+	if len(header) < 2 {
+		return 0, 0, 0, 0, codec.ErrNeedMoreData
+	}
+
+	t = PacketType(header[0] >> 4)
+	flags = header[0] & 0x0f
+	if t == 0 {
+		return 0, 0, 0, 0, ErrInvalidPacketType
+	}
+	if !validFlags(t, flags) {
+		return 0, 0, 0, 0, ErrInvalidFlags
+	}
+
+	w := 0
+	for {
+		if w == 4 {
+			return 0, 0, 0, 0, ErrMalformedLength
+		}
+		if 1+w >= len(header) {
+			return 0, 0, 0, 0, codec.ErrNeedMoreData
+		}
+		b := header[1+w]
+		length |= int(b&0x7f) << (7 * uint(w))
+		w++
+		if b&0x80 == 0 {
+			break
+		}
+	}
+	// 必须使用最短的编码，例如 0x80 0x00 是非法的
+	if w > 1 && header[w] == 0 {
+		return 0, 0, 0, 0, ErrMalformedLength
+	}
+
+	headerLength = 1 + w
+	if headerLength+length > f.MaxPacketSize {
+		return 0, 0, 0, 0, ErrPacketTooLarge
+	}
+	size := rb.Size()
+	if isUsingExplore {
+		size = rb.ExploreSize()
+	}
+	if size < headerLength+length {
+		return 0, 0, 0, 0, codec.ErrNeedMoreData
+	}
+	return t, flags, headerLength, length, nil
+}
@@ -0,0 +1,106 @@
+// Package mqtt 把 RingBuffer 中的 MQTT 3.1.1/5.0 字节流切分成完整的控制报文，并编码固定报头。
+// 只负责分帧，不解析可变报头和有效载荷的语义。
+package mqtt
+
+import (
+	"errors"
+
+	"github.com/zput/ringbuffer"
+)
+
+// PacketType 是固定报头中的报文类型。
+type PacketType byte
+
+const (
+	CONNECT     PacketType = 1
+	CONNACK     PacketType = 2
+	PUBLISH     PacketType = 3
+	PUBACK      PacketType = 4
+	PUBREC      PacketType = 5
+	PUBREL      PacketType = 6
+	PUBCOMP     PacketType = 7
+	SUBSCRIBE   PacketType = 8
+	SUBACK      PacketType = 9
+	UNSUBSCRIBE PacketType = 10
+	UNSUBACK    PacketType = 11
+	PINGREQ     PacketType = 12
+	PINGRESP    PacketType = 13
+	DISCONNECT  PacketType = 14
+	AUTH        PacketType = 15 // 只在 MQTT 5.0 中使用
+)
+
+var packetTypeNames = [...]string{
+	"RESERVED", "CONNECT", "CONNACK", "PUBLISH", "PUBACK", "PUBREC", "PUBREL", "PUBCOMP",
+	"SUBSCRIBE", "SUBACK", "UNSUBSCRIBE", "UNSUBACK", "PINGREQ", "PINGRESP", "DISCONNECT", "AUTH",
+}
+
+func (t PacketType) String() string {
+	if int(t) < len(packetTypeNames) {
+		return packetTypeNames[t]
+	}
+	return "UNKNOWN"
+}
+
+// MaxRemainingLength 是剩余长度(4 个字节的变长编码)能表示的最大值。
+const MaxRemainingLength = 268435455
+
+var ErrInvalidPacketType = errors.New("packet type is reserved; mqtt")
+var ErrInvalidFlags = errors.New("fixed header flags are invalid for the packet type; mqtt")
+var ErrMalformedLength = errors.New("remaining length is malformed; mqtt")
+var ErrPacketTooLarge = errors.New("packet size exceeds the limit; mqtt")
+
+// validFlags 检查固定报头的标志位，见 MQTT 3.1.1 2.2.2。
+func validFlags(t PacketType, flags byte) bool {
+	switch t {
+	case PUBLISH:
+		// QoS 不能是 3
+		return flags&0x06 != 0x06
+	case PUBREL, SUBSCRIBE, UNSUBSCRIBE:
+		return flags == 0x02
+	}
+	return flags == 0
+}
+
+// AppendRemainingLength 把 n 编码成剩余长度追加到 dst 之后。
+func AppendRemainingLength(dst []byte, n int) ([]byte, error) {
+	if n < 0 || n > MaxRemainingLength {
+		return dst, ErrMalformedLength
+	}
+	for {
+		b := byte(n & 0x7f)
+		n >>= 7
+		if n > 0 {
+			b |= 0x80
+		}
+		dst = append(dst, b)
+		if n == 0 {
+			return dst, nil
+		}
+	}
+}
+
+// WriteFixedHeader 把固定报头写入 out，之后需要再写入 remainingLength 个字节。
+func WriteFixedHeader(out *ringbuffer.RingBuffer, t PacketType, flags byte, remainingLength int) error {
+	if t == 0 || t > AUTH {
+		return ErrInvalidPacketType
+	}
+	if !validFlags(t, flags) {
+		return ErrInvalidFlags
+	}
+	var buf [5]byte
+	header, err := AppendRemainingLength(append(buf[:0], byte(t)<<4|flags), remainingLength)
+	if err != nil {
+		return err
+	}
+	_, err = out.Write(header)
+	return err
+}
+
+// WritePacket 把固定报头和 body(可变报头与有效载荷)依次写入 out。
+func WritePacket(out *ringbuffer.RingBuffer, t PacketType, flags byte, body []byte) error {
+	if err := WriteFixedHeader(out, t, flags, len(body)); err != nil {
+		return err
+	}
+	_, err := out.Write(body)
+	return err
+}
@@ -0,0 +1,169 @@
+package mqtt
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/zput/ringbuffer"
+	"github.com/zput/ringbuffer/codec"
+)
+
+func TestFramer_Next(t *testing.T) {
+	f, _ := NewFramer(0)
+	rb := ringbuffer.NewWithData([]byte{
+		0xc0, 0x00, // PINGREQ
+		0x82, 0x05, 0x00, 0x01, 0x00, 0x01, 'a', // SUBSCRIBE
+		0x3b, 0x02, 0x00, 0x00, // PUBLISH dup=1 qos=1 retain=1
+	})
+
+	p, err := f.Next(rb)
+	if err != nil || p.Type != PINGREQ || p.Flags != 0 || p.Length() != 0 {
+		t.Fatalf("unexpected packet %v %+v", err, p)
+	}
+	p, err = f.Next(rb)
+	if err != nil || p.Type != SUBSCRIBE || p.Flags != 0x02 || !bytes.Equal(p.Bytes(), []byte{0x00, 0x01, 0x00, 0x01, 'a'}) {
+		t.Fatalf("unexpected packet %v %+v", err, p)
+	}
+	p, err = f.Next(rb)
+	if err != nil || p.Type != PUBLISH || p.Flags != 0x0b || p.Length() != 2 {
+		t.Fatalf("unexpected packet %v %+v", err, p)
+	}
+	if _, err = f.Next(rb); err != codec.ErrNeedMoreData {
+		t.Fatalf("expect ErrNeedMoreData but got %v", err)
+	}
+}
+
+func TestFramer_Wrap(t *testing.T) {
+	payload := bytes.Repeat([]byte{'m'}, 200)
+	packet := append([]byte{0x30, 0xc8, 0x01}, payload...)
+
+	// 剩余长度的两个字节分别在缓存的尾部和头部
+	rb := ringbuffer.New(256)
+	_, _ = rb.Write(make([]byte, 254))
+	_, _ = rb.Read(make([]byte, 254))
+
+	f, _ := NewFramer(0)
+	for i := 0; i < len(packet)-1; i++ {
+		_ = rb.WriteOneByte(packet[i])
+		if _, err := f.Next(rb); err != codec.ErrNeedMoreData {
+			t.Fatalf("at %d: expect ErrNeedMoreData but got %v", i, err)
+		}
+		if rb.Size() != i+1 {
+			t.Fatalf("at %d: nothing should be consumed", i)
+		}
+	}
+	_ = rb.WriteOneByte(packet[len(packet)-1])
+	if rb.Capacity() != 256 {
+		t.Fatalf("expect no growth but capacity is %d", rb.Capacity())
+	}
+
+	p, n, err := f.Peek(rb)
+	if err != nil || n != len(packet) {
+		t.Fatalf("unexpected peek %d %v", n, err)
+	}
+	if p.Type != PUBLISH || len(p.End) != 0 || !bytes.Equal(p.First, payload) {
+		t.Fatalf("unexpected packet %+v", p)
+	}
+	rb.Retrieve(n)
+	if !rb.IsEmpty() {
+		t.Fatal("expect all data consumed")
+	}
+
+	// 有效载荷跨越缓存的尾部时分成两段
+	_, _ = rb.Write(make([]byte, 200))
+	_, _ = rb.Read(make([]byte, 200))
+	_ = WritePacket(rb, PUBLISH, 0, payload)
+	if p, err = f.Next(rb); err != nil {
+		t.Fatal(err)
+	}
+	if len(p.First) == 0 || len(p.End) == 0 || !bytes.Equal(p.Bytes(), payload) {
+		t.Fatalf("expect two segments but got %d and %d", len(p.First), len(p.End))
+	}
+}
+
+func TestFramer_Errors(t *testing.T) {
+	f, _ := NewFramer(64)
+	cases := []struct {
+		input  []byte
+		expect error
+	}{
+		{[]byte{0x00, 0x00}, ErrInvalidPacketType},
+		{[]byte{0xc1, 0x00}, ErrInvalidFlags},
+		{[]byte{0x80, 0x00}, ErrInvalidFlags},
+		{[]byte{0x36, 0x00}, ErrInvalidFlags},
+		{[]byte{0x30, 0xff, 0xff, 0xff, 0xff, 0x01}, ErrMalformedLength},
+		{[]byte{0x30, 0x80, 0x00}, ErrMalformedLength},
+		// 报文还没有到达就可以拒绝
+		{[]byte{0x30, 0x3f}, ErrPacketTooLarge},
+		{[]byte{0x30, 0x80, 0x80, 0x01}, ErrPacketTooLarge},
+	}
+	for _, c := range cases {
+		rb := ringbuffer.NewWithData(c.input)
+		if _, err := f.Next(rb); err != c.expect {
+			t.Fatalf("%x: expect %v but got %v", c.input, c.expect, err)
+		}
+		if rb.Size() != len(c.input) {
+			t.Fatalf("%x: nothing should be consumed", c.input)
+		}
+	}
+	if _, err := NewFramer(-1); err != codec.ErrInitCodecParameter {
+		t.Fatalf("expect ErrInitCodecParameter but got %v", err)
+	}
+}
+
+func TestRemainingLength(t *testing.T) {
+	cases := []struct {
+		n     int
+		width int
+	}{
+		{0, 1}, {127, 1}, {128, 2}, {16383, 2}, {16384, 3}, {2097151, 3}, {2097152, 4}, {MaxRemainingLength, 4},
+	}
+	for _, c := range cases {
+		b, err := AppendRemainingLength(nil, c.n)
+		if err != nil || len(b) != c.width {
+			t.Fatalf("%d: expect %d bytes but got %x %v", c.n, c.width, b, err)
+		}
+		// 只有固定报头时解码出的长度没有问题，只是在等待剩下的数据
+		f := &Framer{MaxPacketSize: MaxRemainingLength + 5}
+		rb := ringbuffer.NewWithData(append([]byte{0x10}, b...))
+		expect := codec.ErrNeedMoreData
+		if c.n == 0 {
+			expect = nil
+		}
+		if _, _, _, _, err = f.parseFixedHeader(rb, false); err != expect {
+			t.Fatalf("%d: expect %v but got %v", c.n, expect, err)
+		}
+	}
+	if _, err := AppendRemainingLength(nil, MaxRemainingLength+1); err != ErrMalformedLength {
+		t.Fatalf("expect ErrMalformedLength but got %v", err)
+	}
+}
+
+func TestWritePacket(t *testing.T) {
+	out := ringbuffer.New(4)
+	if err := WritePacket(out, CONNACK, 0, []byte{0x00, 0x00}); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteFixedHeader(out, PINGRESP, 0, 0); err != nil {
+		t.Fatal(err)
+	}
+	if got := out.ReadAll2NewByteSlice(); !bytes.Equal(got, []byte{0x20, 0x02, 0x00, 0x00, 0xd0, 0x00}) {
+		t.Fatalf("unexpected bytes %x", got)
+	}
+	out.RetrieveAll()
+
+	if err := WriteFixedHeader(out, 0, 0, 0); err != ErrInvalidPacketType {
+		t.Fatalf("expect ErrInvalidPacketType but got %v", err)
+	}
+	if err := WriteFixedHeader(out, PUBREL, 0, 2); err != ErrInvalidFlags {
+		t.Fatalf("expect ErrInvalidFlags but got %v", err)
+	}
+
+	// 作为 codec.Decoder 使用
+	f, _ := NewFramer(0)
+	_ = WritePacket(out, PUBREL, 0x02, []byte{0x00, 0x07})
+	frame, err := codec.Decode(out, f)
+	if err != nil || !bytes.Equal(frame, []byte{0x62, 0x02, 0x00, 0x07}) {
+		t.Fatalf("unexpected frame %x %v", frame, err)
+	}
+}
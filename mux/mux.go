@@ -0,0 +1,142 @@
+/*
+Package mux 在一个 net.Conn 上复用多个双向的逻辑流，帧头与 yamux 相同：
+
+	+---------+------+-------+-----------+--------+
+	| version | type | flags | stream id | length |
+	|    1    |  1   |   2   |     4     |   4    |
+	+---------+------+-------+-----------+--------+
+
+Data 帧的 length 是负载的长度，WindowUpdate 帧的 length 是增加的发送窗口，
+Ping 帧的 length 是回显的 id，GoAway 帧的 length 是原因；
+客户端打开的流 id 是奇数，服务端打开的流 id 是偶数，id 0 用于 Ping 与 GoAway。
+
+每个 Stream 有自己的接收 RingBuffer，容量就是它的最大接收窗口：
+对方最多只能发送窗口大小的数据，应用读走一半以上以后才给对方增加窗口，所以接收缓存永远不会扩容。
+Session 从 socket 读到的数据先进入 ringbuffer.Conn 的输入缓存，再按照 stream id 分发到各个流的接收缓存中。
+*/
+package mux
+
+import (
+	"encoding/binary"
+	"errors"
+
+	"github.com/zput/ringbuffer"
+	"github.com/zput/ringbuffer/codec"
+)
+
+const (
+	protoVersion = 0
+	headerLength = 12
+
+	// initialStreamWindow 是协议规定的初始窗口；建立流时双方都假定对方的接收窗口是这个大小
+	initialStreamWindow = 256 * 1024
+)
+
+type frameType uint8
+
+const (
+	typeData frameType = iota
+	typeWindowUpdate
+	typePing
+	typeGoAway
+)
+
+const (
+	flagSYN uint16 = 1 << iota // 打开一个流
+	flagACK                    // 确认打开的流或者 Ping
+	flagFIN                    // 半关闭，不再发送数据
+	flagRST                    // 立即关闭流
+)
+
+const (
+	goAwayNormal uint32 = iota
+	goAwayProtoErr
+	goAwayInternalErr
+)
+
+var ErrInvalidVersion = errors.New("invalid protocol version; mux")
+var ErrInvalidFrameType = errors.New("invalid frame type; mux")
+var ErrInvalidStreamID = errors.New("invalid stream id; mux")
+var ErrDuplicateStream = errors.New("duplicate stream opened; mux")
+var ErrRecvWindowExceeded = errors.New("peer exceeded the receive window; mux")
+
+// session 已经关闭；所有的流都不能再读写。
+var ErrSessionShutdown = errors.New("session is shutdown; mux")
+
+// 对方发送了 GoAway，不能再打开新的流。
+var ErrRemoteGoAway = errors.New("remote end is not accepting streams; mux")
+
+var ErrStreamsExhausted = errors.New("stream ids are exhausted; mux")
+var ErrStreamClosed = errors.New("stream is closed; mux")
+var ErrStreamReset = errors.New("stream is reset; mux")
+
+// ErrTimeout 在超过 Stream 的读写 deadline 时返回，实现了 net.Error。
+var ErrTimeout error = timeoutError{}
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o deadline exceeded; mux" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+const (
+	DefaultAcceptBacklog    = 256
+	DefaultStreamWindowSize = initialStreamWindow
+)
+
+// Config 是 Session 的配置。
+type Config struct {
+	// 等待 Accept 的流的最大数量，超过时新的流会被 RST
+	AcceptBacklog int
+	// 每个流接收缓存的容量，也就是最大接收窗口；不能小于协议规定的初始窗口 256KB
+	StreamWindowSize int
+	// socket 每次读取的大小，<= 0 时使用 ringbuffer.DefaultConnBufferSize
+	ReadBufferSize int
+}
+
+// DefaultConfig 返回默认的配置。
+func DefaultConfig() *Config {
+	return &Config{
+		AcceptBacklog:    DefaultAcceptBacklog,
+		StreamWindowSize: DefaultStreamWindowSize,
+		ReadBufferSize:   ringbuffer.DefaultConnBufferSize,
+	}
+}
+
+func (c *Config) verify() error {
+	if c.AcceptBacklog <= 0 || c.StreamWindowSize < initialStreamWindow || c.StreamWindowSize > 1<<31-1 {
+		return codec.ErrInitCodecParameter
+	}
+	return nil
+}
+
+type header [headerLength]byte
+
+func encodeHeader(typ frameType, flags uint16, streamID uint32, length uint32) (h header) {
+	h[0] = protoVersion
+	h[1] = byte(typ)
+	binary.BigEndian.PutUint16(h[2:], flags)
+	binary.BigEndian.PutUint32(h[4:], streamID)
+	binary.BigEndian.PutUint32(h[8:], length)
+	return
+}
+
+func (h header) version() uint8 {
+	return h[0]
+}
+
+func (h header) typ() frameType {
+	return frameType(h[1])
+}
+
+func (h header) flags() uint16 {
+	return binary.BigEndian.Uint16(h[2:])
+}
+
+func (h header) streamID() uint32 {
+	return binary.BigEndian.Uint32(h[4:])
+}
+
+func (h header) length() uint32 {
+	return binary.BigEndian.Uint32(h[8:])
+}
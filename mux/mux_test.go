@@ -0,0 +1,297 @@
+package mux
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testSessions 在 net.Pipe 上创建一对 Session。
+func testSessions(t *testing.T, config *Config) (client, server *Session) {
+	c, s := net.Pipe()
+	client, err := Client(c, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server, err = Server(s, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client, server
+}
+
+func TestSession_OpenAccept(t *testing.T) {
+	client, server := testSessions(t, nil)
+	defer client.Close()
+	defer server.Close()
+
+	// 服务端把收到的数据原样写回，对方关闭以后也关闭
+	go func() {
+		for {
+			stream, err := server.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				_, _ = io.Copy(stream, stream)
+				_ = stream.Close()
+			}()
+		}
+	}()
+
+	for i := 0; i < 2; i++ {
+		stream, err := client.OpenStream()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stream.ID() != uint32(2*i+1) {
+			t.Fatalf("expect odd stream id but got %d", stream.ID())
+		}
+		if _, err = stream.Write([]byte("hello")); err != nil {
+			t.Fatal(err)
+		}
+		buf := make([]byte, 5)
+		if _, err = io.ReadFull(stream, buf); err != nil || string(buf) != "hello" {
+			t.Fatalf("unexpected echo %q %v", buf, err)
+		}
+		_ = stream.Close()
+		if _, err = stream.Write([]byte("x")); err != ErrStreamClosed {
+			t.Fatalf("expect ErrStreamClosed but got %v", err)
+		}
+		if _, err = stream.Read(buf); err != io.EOF {
+			t.Fatalf("expect io.EOF but got %v", err)
+		}
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for client.NumStreams() != 0 || server.NumStreams() != 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("expect all streams removed but got %d %d", client.NumStreams(), server.NumStreams())
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestSession_ConcurrentStreams(t *testing.T) {
+	client, server := testSessions(t, nil)
+	defer client.Close()
+	defer server.Close()
+
+	go func() {
+		for {
+			stream, err := server.AcceptStream()
+			if err != nil {
+				return
+			}
+			go func() {
+				_, _ = io.Copy(stream, stream)
+				_ = stream.Close()
+			}()
+		}
+	}()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 16)
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			stream, err := client.Open()
+			if err != nil {
+				errs <- err
+				return
+			}
+			data := bytes.Repeat([]byte{byte(i)}, 100*1024+i)
+			go func() {
+				_, _ = stream.Write(data)
+				_ = stream.Close()
+			}()
+			echo, err := ioutil.ReadAll(stream)
+			if err != nil {
+				errs <- err
+				return
+			}
+			if !bytes.Equal(echo, data) {
+				errs <- io.ErrShortWrite
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatal(err)
+	}
+}
+
+func TestStream_FlowControl(t *testing.T) {
+	config := DefaultConfig()
+	config.StreamWindowSize = 512 * 1024
+	client, server := testSessions(t, config)
+	defer client.Close()
+	defer server.Close()
+
+	stream, err := client.OpenStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+	remote, err := server.AcceptStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 对方不读取时，写完窗口大小的数据就会阻塞
+	_ = stream.SetWriteDeadline(time.Now().Add(100 * time.Millisecond))
+	data := make([]byte, 2*1024*1024)
+	for i := range data {
+		data[i] = byte(i * 7)
+	}
+	n, err := stream.Write(data)
+	if ne, ok := err.(net.Error); !ok || !ne.Timeout() {
+		t.Fatalf("expect timeout but got %v", err)
+	}
+	if n != config.StreamWindowSize {
+		t.Fatalf("expect %d bytes written but got %d", config.StreamWindowSize, n)
+	}
+	remote.mu.Lock()
+	size, capacity := remote.recvBuf.Size(), remote.recvBuf.Capacity()
+	remote.mu.Unlock()
+	if size != config.StreamWindowSize || capacity != config.StreamWindowSize {
+		t.Fatalf("unexpected receive buffer %d/%d", size, capacity)
+	}
+
+	// 对方读取以后窗口增加，剩下的数据可以继续写
+	_ = stream.SetWriteDeadline(time.Time{})
+	go func() {
+		_, _ = stream.Write(data[n:])
+		_ = stream.Close()
+	}()
+	received, err := ioutil.ReadAll(remote)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(received, data) {
+		t.Fatal("data mismatch")
+	}
+	remote.mu.Lock()
+	capacity = remote.recvBuf.Capacity()
+	remote.mu.Unlock()
+	if capacity != config.StreamWindowSize {
+		t.Fatalf("receive buffer should never grow but got %d", capacity)
+	}
+}
+
+func TestStream_ReadDeadline(t *testing.T) {
+	client, server := testSessions(t, nil)
+	defer client.Close()
+	defer server.Close()
+
+	stream, err := client.OpenStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = stream.SetReadDeadline(time.Now().Add(20 * time.Millisecond))
+	if _, err = stream.Read(make([]byte, 1)); err != ErrTimeout {
+		t.Fatalf("expect ErrTimeout but got %v", err)
+	}
+
+	// 修改 deadline 会唤醒阻塞的 Read
+	done := make(chan error, 1)
+	_ = stream.SetReadDeadline(time.Time{})
+	go func() {
+		_, err := stream.Read(make([]byte, 1))
+		done <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+	_ = stream.SetReadDeadline(time.Now())
+	if err = <-done; err != ErrTimeout {
+		t.Fatalf("expect ErrTimeout but got %v", err)
+	}
+}
+
+func TestSession_PingAndClose(t *testing.T) {
+	client, server := testSessions(t, nil)
+
+	if _, err := client.Ping(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := server.Ping(); err != nil {
+		t.Fatal(err)
+	}
+
+	stream, err := client.OpenStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+	remote, err := server.AcceptStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = stream.Write([]byte("bye")); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 3)
+	if _, err = io.ReadFull(remote, buf[:1]); err != nil {
+		t.Fatal(err)
+	}
+
+	_ = client.Close()
+	if _, err = server.AcceptStream(); err != ErrSessionShutdown {
+		t.Fatalf("expect ErrSessionShutdown but got %v", err)
+	}
+	// 已经收到的数据仍然可以读出
+	if _, err = io.ReadFull(remote, buf[1:]); err != nil || string(buf) != "bye" {
+		t.Fatalf("unexpected data %q %v", buf, err)
+	}
+	if _, err = remote.Read(buf); err != ErrSessionShutdown {
+		t.Fatalf("expect ErrSessionShutdown but got %v", err)
+	}
+	if _, err = client.OpenStream(); err != ErrSessionShutdown {
+		t.Fatalf("expect ErrSessionShutdown but got %v", err)
+	}
+}
+
+func TestSession_GoAway(t *testing.T) {
+	client, server := testSessions(t, nil)
+	defer client.Close()
+	defer server.Close()
+
+	if err := server.GoAway(); err != nil {
+		t.Fatal(err)
+	}
+	// 等待 GoAway 到达
+	if _, err := client.Ping(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.OpenStream(); err != ErrRemoteGoAway {
+		t.Fatalf("expect ErrRemoteGoAway but got %v", err)
+	}
+}
+
+func TestSession_ProtocolError(t *testing.T) {
+	c, s := net.Pipe()
+	server, err := Server(s, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 客户端违反窗口，发送超过初始窗口的数据
+	go func() {
+		h := encodeHeader(typeData, flagSYN, 1, initialStreamWindow+1)
+		_, _ = c.Write(h[:])
+	}()
+	var h header
+	if _, err = io.ReadFull(c, h[:]); err != nil {
+		t.Fatal(err)
+	}
+	if h.typ() != typeGoAway || h.length() != goAwayProtoErr {
+		t.Fatalf("expect GoAway with protocol error but got %x", h)
+	}
+	<-server.shutdownCh
+
+	if _, err = Client(c, &Config{AcceptBacklog: 1, StreamWindowSize: 1024}); err == nil {
+		t.Fatal("expect the window size to be rejected")
+	}
+}
@@ -0,0 +1,383 @@
+package mux
+
+import (
+	"io"
+	"math"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/zput/ringbuffer"
+)
+
+// goAwayTimeout 是关闭时发送 GoAway 的最长等待时间。
+const goAwayTimeout = time.Second
+
+/*
+Session 是一个连接上的多路复用会话，同时实现了 net.Listener：Accept 返回对方打开的流。
+
+一个 goroutine 不断从连接中读取帧，分发到各个流的接收缓存中，它从不阻塞在流上；
+需要由它发送的帧(Ping 的回复、拒绝新流的 RST)在单独的 goroutine 中发送，避免两端同时写而互相等待。
+*/
+type Session struct {
+	config   *Config
+	conn     *ringbuffer.Conn
+	isClient bool
+
+	streamLock   sync.Mutex
+	streams      map[uint32]*Stream
+	nextStreamID uint32
+
+	acceptCh chan *Stream
+
+	sendLock sync.Mutex
+
+	pingLock sync.Mutex
+	pingID   uint32
+	pings    map[uint32]chan struct{}
+
+	localGoAway  int32
+	remoteGoAway int32
+
+	shutdownLock sync.Mutex
+	shutdown     bool
+	shutdownCh   chan struct{}
+}
+
+// Client 在 conn 上创建客户端的 Session；config 为 nil 时使用 DefaultConfig。
+func Client(conn net.Conn, config *Config) (*Session, error) {
+	return newSession(conn, config, true)
+}
+
+// Server 在 conn 上创建服务端的 Session；config 为 nil 时使用 DefaultConfig。
+func Server(conn net.Conn, config *Config) (*Session, error) {
+	return newSession(conn, config, false)
+}
+
+func newSession(conn net.Conn, config *Config, isClient bool) (*Session, error) {
+	if config == nil {
+		config = DefaultConfig()
+	}
+	if err := config.verify(); err != nil {
+		return nil, err
+	}
+	s := &Session{
+		config:     config,
+		conn:       ringbuffer.NewConn(conn, config.ReadBufferSize, 0),
+		isClient:   isClient,
+		streams:    make(map[uint32]*Stream),
+		acceptCh:   make(chan *Stream, config.AcceptBacklog),
+		pings:      make(map[uint32]chan struct{}),
+		shutdownCh: make(chan struct{}),
+	}
+	if isClient {
+		s.nextStreamID = 1
+	} else {
+		s.nextStreamID = 2
+	}
+	go s.recvLoop()
+	return s, nil
+}
+
+// Open 打开一个新的流，实现与 net.Dialer 类似的用法。
+func (s *Session) Open() (net.Conn, error) {
+	stream, err := s.OpenStream()
+	if err != nil {
+		return nil, err
+	}
+	return stream, nil
+}
+
+// OpenStream 打开一个新的流；不等待对方 Accept，可以立即写入初始窗口大小的数据。
+func (s *Session) OpenStream() (*Stream, error) {
+	if s.IsClosed() {
+		return nil, ErrSessionShutdown
+	}
+	if atomic.LoadInt32(&s.remoteGoAway) == 1 {
+		return nil, ErrRemoteGoAway
+	}
+
+	s.streamLock.Lock()
+	id := s.nextStreamID
+	if id >= math.MaxUint32-1 {
+		s.streamLock.Unlock()
+		return nil, ErrStreamsExhausted
+	}
+	s.nextStreamID += 2
+	stream := newStream(s, id)
+	s.streams[id] = stream
+	s.streamLock.Unlock()
+
+	if err := stream.sendWindowUpdate(flagSYN); err != nil {
+		s.removeStream(id)
+		return nil, err
+	}
+	return stream, nil
+}
+
+// Accept 实现 net.Listener，等待对方打开的流。
+func (s *Session) Accept() (net.Conn, error) {
+	stream, err := s.AcceptStream()
+	if err != nil {
+		return nil, err
+	}
+	return stream, nil
+}
+
+// AcceptStream 等待对方打开的流，并确认它。
+func (s *Session) AcceptStream() (*Stream, error) {
+	select {
+	case stream := <-s.acceptCh:
+		if err := stream.sendWindowUpdate(flagACK); err != nil {
+			return nil, err
+		}
+		return stream, nil
+	case <-s.shutdownCh:
+		return nil, ErrSessionShutdown
+	}
+}
+
+// Addr 实现 net.Listener，返回连接的本地地址。
+func (s *Session) Addr() net.Addr {
+	return s.conn.LocalAddr()
+}
+
+// Close 通知对方 GoAway 以后关闭连接；所有的流都不能再读写，已经收到的数据仍然可以读出。
+func (s *Session) Close() error {
+	s.exit(goAwayNormal)
+	return nil
+}
+
+// IsClosed 返回 Session 是否已经关闭。
+func (s *Session) IsClosed() bool {
+	select {
+	case <-s.shutdownCh:
+		return true
+	default:
+		return false
+	}
+}
+
+// NumStreams 返回没有完全关闭的流的数量。
+func (s *Session) NumStreams() int {
+	s.streamLock.Lock()
+	defer s.streamLock.Unlock()
+	return len(s.streams)
+}
+
+// GoAway 通知对方不再接受新的流，已经打开的流不受影响。
+func (s *Session) GoAway() error {
+	atomic.StoreInt32(&s.localGoAway, 1)
+	return s.writeFrame(encodeHeader(typeGoAway, 0, 0, goAwayNormal), nil)
+}
+
+// Ping 发送一个 Ping 并等待对方的回复，返回往返时间。
+func (s *Session) Ping() (time.Duration, error) {
+	s.pingLock.Lock()
+	id := s.pingID
+	s.pingID++
+	ch := make(chan struct{})
+	s.pings[id] = ch
+	s.pingLock.Unlock()
+
+	start := time.Now()
+	if err := s.writeFrame(encodeHeader(typePing, flagSYN, 0, id), nil); err != nil {
+		s.pingLock.Lock()
+		delete(s.pings, id)
+		s.pingLock.Unlock()
+		return 0, err
+	}
+	select {
+	case <-ch:
+		return time.Since(start), nil
+	case <-s.shutdownCh:
+		return 0, ErrSessionShutdown
+	}
+}
+
+// exit 关闭 Session；code 不是 goAwayNormal 时说明对方违反了协议。
+func (s *Session) exit(code uint32) {
+	s.shutdownLock.Lock()
+	if s.shutdown {
+		s.shutdownLock.Unlock()
+		return
+	}
+	s.shutdown = true
+	s.shutdownLock.Unlock()
+
+	// 对方不读取时不能一直等待；deadline 同时会让阻塞在写上的其他 goroutine 返回
+	_ = s.conn.SetWriteDeadline(time.Now().Add(goAwayTimeout))
+	_ = s.writeFrame(encodeHeader(typeGoAway, 0, 0, code), nil)
+	close(s.shutdownCh)
+	// GoAway 已经 Flush 过了；不用 Conn.Close，它会在没有 sendLock 的情况下 Flush 输出缓存
+	_ = s.conn.Conn.Close()
+}
+
+// writeFrame 把帧头和负载写入输出缓存，然后一起写到连接中。
+func (s *Session) writeFrame(h header, body []byte) error {
+	s.sendLock.Lock()
+	defer s.sendLock.Unlock()
+
+	if s.IsClosed() {
+		return ErrSessionShutdown
+	}
+	_, _ = s.conn.Write(h[:])
+	_, _ = s.conn.Write(body)
+	if err := s.conn.Flush(); err != nil {
+		// 连接已经坏了，丢弃没有发出去的数据，由接收的 goroutine 关闭 Session
+		s.conn.Outbound().RetrieveAll()
+		return err
+	}
+	return nil
+}
+
+func (s *Session) removeStream(id uint32) {
+	s.streamLock.Lock()
+	delete(s.streams, id)
+	s.streamLock.Unlock()
+}
+
+func (s *Session) recvLoop() {
+	code := goAwayNormal
+	switch s.recv() {
+	case ErrInvalidVersion, ErrInvalidFrameType, ErrInvalidStreamID, ErrDuplicateStream, ErrRecvWindowExceeded:
+		code = goAwayProtoErr
+	}
+	s.exit(code)
+}
+
+// recv 不断读取并处理帧，直到连接出错或者对方违反了协议。
+func (s *Session) recv() error {
+	for {
+		first, end, err := s.conn.Peek(headerLength)
+		if err != nil {
+			return err
+		}
+		var h header
+		n := copy(h[:], first)
+		copy(h[n:], end)
+		_, _ = s.conn.Inbound().Discard(headerLength)
+
+		if h.version() != protoVersion {
+			return ErrInvalidVersion
+		}
+		switch h.typ() {
+		case typeData, typeWindowUpdate:
+			err = s.handleStreamMessage(h)
+		case typePing:
+			s.handlePing(h)
+		case typeGoAway:
+			err = s.handleGoAway(h)
+		default:
+			return ErrInvalidFrameType
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (s *Session) handleStreamMessage(h header) error {
+	id := h.streamID()
+	if h.flags()&flagSYN != 0 {
+		if err := s.incomingStream(id); err != nil {
+			return err
+		}
+	}
+
+	s.streamLock.Lock()
+	stream := s.streams[id]
+	s.streamLock.Unlock()
+
+	if stream == nil {
+		// 已经关闭或者被拒绝的流，丢弃它的数据
+		if h.typ() == typeData {
+			return s.readPayload(int(h.length()), nil)
+		}
+		return nil
+	}
+	if h.typ() == typeWindowUpdate {
+		stream.incrSendWindow(h.length(), h.flags())
+		return nil
+	}
+	return stream.readData(h.length(), h.flags())
+}
+
+func (s *Session) incomingStream(id uint32) error {
+	// 对方只能使用与自己不同奇偶性的 id
+	if id == 0 || (id%2 == 1) == s.isClient {
+		return ErrInvalidStreamID
+	}
+	if atomic.LoadInt32(&s.localGoAway) == 1 {
+		go s.writeFrame(encodeHeader(typeWindowUpdate, flagRST, id, 0), nil)
+		return nil
+	}
+
+	stream := newStream(s, id)
+	s.streamLock.Lock()
+	if _, ok := s.streams[id]; ok {
+		s.streamLock.Unlock()
+		return ErrDuplicateStream
+	}
+	s.streams[id] = stream
+	s.streamLock.Unlock()
+
+	select {
+	case s.acceptCh <- stream:
+	default:
+		// 等待 Accept 的流太多了
+		s.removeStream(id)
+		go s.writeFrame(encodeHeader(typeWindowUpdate, flagRST, id, 0), nil)
+	}
+	return nil
+}
+
+func (s *Session) handlePing(h header) {
+	id := h.length()
+	if h.flags()&flagSYN != 0 {
+		go s.writeFrame(encodeHeader(typePing, flagACK, 0, id), nil)
+		return
+	}
+
+	s.pingLock.Lock()
+	ch := s.pings[id]
+	delete(s.pings, id)
+	s.pingLock.Unlock()
+	if ch != nil {
+		close(ch)
+	}
+}
+
+func (s *Session) handleGoAway(h header) error {
+	atomic.StoreInt32(&s.remoteGoAway, 1)
+	if h.length() != goAwayNormal {
+		return ErrRemoteGoAway
+	}
+	return nil
+}
+
+// readPayload 把连接中接下来的 n 个字节交给 fn，数据一到达就交出去，不等待整个负载；
+// fn 为 nil 时丢弃这些数据。传给 fn 的切片只在 fn 返回之前有效。
+func (s *Session) readPayload(n int, fn func(first, end []byte)) error {
+	inbound := s.conn.Inbound()
+	for n > 0 {
+		if inbound.IsEmpty() {
+			if _, err := s.conn.Fill(); err != nil && inbound.IsEmpty() {
+				if err == io.EOF {
+					err = io.ErrUnexpectedEOF
+				}
+				return err
+			}
+			continue
+		}
+		first, end := inbound.Peek(n, false)
+		if fn != nil {
+			fn(first, end)
+		}
+		k := len(first) + len(end)
+		_, _ = inbound.Discard(k)
+		n -= k
+	}
+	return nil
+}
@@ -0,0 +1,276 @@
+package mux
+
+import (
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/zput/ringbuffer"
+)
+
+/*
+Stream 是 Session 中的一个逻辑流，实现了 net.Conn。
+
+  - 收到的数据保存在 recvBuf 中，recvBuf 的容量就是最大接收窗口；
+    Read 读走一半以上的窗口以后才发送 WindowUpdate，避免每次读取都产生一个帧。
+  - Write 受对方给的发送窗口限制，窗口用完时阻塞，直到对方读取数据、增加窗口。
+  - Close 是半关闭：发送 FIN 以后不能再写，但是仍然可以读，直到对方也关闭(io.EOF)。
+
+一个 goroutine 读、一个 goroutine 写是安全的。
+*/
+type Stream struct {
+	id      uint32
+	session *Session
+
+	mu            sync.Mutex
+	recvBuf       *ringbuffer.RingBuffer
+	recvWindow    uint32 // 对方还可以发送的字节数
+	sendWindow    uint32 // 还可以发送给对方的字节数
+	localClosed   bool
+	remoteClosed  bool
+	reset         bool
+	readDeadline  time.Time
+	writeDeadline time.Time
+
+	recvNotify chan struct{}
+	sendNotify chan struct{}
+}
+
+func newStream(s *Session, id uint32) *Stream {
+	return &Stream{
+		id:         id,
+		session:    s,
+		recvBuf:    ringbuffer.New(s.config.StreamWindowSize),
+		recvWindow: initialStreamWindow,
+		sendWindow: initialStreamWindow,
+		recvNotify: make(chan struct{}, 1),
+		sendNotify: make(chan struct{}, 1),
+	}
+}
+
+// ID 返回流的 id。
+func (st *Stream) ID() uint32 {
+	return st.id
+}
+
+// Read 实现 io.Reader；缓存中的数据读完并且对方已经关闭时返回 io.EOF。
+func (st *Stream) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	for {
+		st.mu.Lock()
+		if !st.recvBuf.IsEmpty() {
+			n, _ := st.recvBuf.Read(p)
+			st.mu.Unlock()
+			// 读走的数据腾出了接收缓存，窗口更新失败不影响这次读取
+			_ = st.sendWindowUpdate(0)
+			return n, nil
+		}
+		switch {
+		case st.reset:
+			st.mu.Unlock()
+			return 0, ErrStreamReset
+		case st.remoteClosed:
+			st.mu.Unlock()
+			return 0, io.EOF
+		}
+		deadline := st.readDeadline
+		st.mu.Unlock()
+
+		if err := st.wait(st.recvNotify, deadline); err != nil {
+			return 0, err
+		}
+	}
+}
+
+// Write 实现 io.Writer；每个 Data 帧的负载不超过当时的发送窗口。
+// deadline 只限制等待窗口的时间，不限制写连接的时间。
+func (st *Stream) Write(p []byte) (n int, err error) {
+	for n < len(p) {
+		st.mu.Lock()
+		switch {
+		case st.reset:
+			st.mu.Unlock()
+			return n, ErrStreamReset
+		case st.localClosed:
+			st.mu.Unlock()
+			return n, ErrStreamClosed
+		}
+		if st.sendWindow == 0 {
+			deadline := st.writeDeadline
+			st.mu.Unlock()
+			if err = st.wait(st.sendNotify, deadline); err != nil {
+				return n, err
+			}
+			continue
+		}
+		k := len(p) - n
+		if uint32(k) > st.sendWindow {
+			k = int(st.sendWindow)
+		}
+		st.sendWindow -= uint32(k)
+		st.mu.Unlock()
+
+		if err = st.session.writeFrame(encodeHeader(typeData, 0, st.id, uint32(k)), p[n:n+k]); err != nil {
+			return n, err
+		}
+		n += k
+	}
+	return n, nil
+}
+
+// Close 发送 FIN 半关闭这个流；双方都关闭以后流从 Session 中移除。
+func (st *Stream) Close() error {
+	st.mu.Lock()
+	if st.localClosed || st.reset {
+		st.mu.Unlock()
+		return nil
+	}
+	st.localClosed = true
+	closed := st.remoteClosed
+	st.mu.Unlock()
+
+	notify(st.sendNotify)
+	if closed {
+		st.session.removeStream(st.id)
+	}
+	return st.session.writeFrame(encodeHeader(typeWindowUpdate, flagFIN, st.id, 0), nil)
+}
+
+func (st *Stream) LocalAddr() net.Addr {
+	return st.session.conn.LocalAddr()
+}
+
+func (st *Stream) RemoteAddr() net.Addr {
+	return st.session.conn.RemoteAddr()
+}
+
+func (st *Stream) SetDeadline(t time.Time) error {
+	_ = st.SetReadDeadline(t)
+	return st.SetWriteDeadline(t)
+}
+
+func (st *Stream) SetReadDeadline(t time.Time) error {
+	st.mu.Lock()
+	st.readDeadline = t
+	st.mu.Unlock()
+	notify(st.recvNotify)
+	return nil
+}
+
+func (st *Stream) SetWriteDeadline(t time.Time) error {
+	st.mu.Lock()
+	st.writeDeadline = t
+	st.mu.Unlock()
+	notify(st.sendNotify)
+	return nil
+}
+
+/*
+sendWindowUpdate 把接收缓存中空出来的空间作为窗口增量发给对方：
+
+	delta = cap(recvBuf) - recvBuf.Size() - recvWindow
+
+flags 为 0 时，增量不到缓存容量的一半就不发送；带有 SYN/ACK 的帧总是发送。
+*/
+func (st *Stream) sendWindowUpdate(flags uint16) error {
+	st.mu.Lock()
+	max := uint32(st.recvBuf.Capacity())
+	delta := max - uint32(st.recvBuf.Size()) - st.recvWindow
+	if flags == 0 && (delta < max/2 || st.remoteClosed || st.reset) {
+		st.mu.Unlock()
+		return nil
+	}
+	st.recvWindow += delta
+	st.mu.Unlock()
+
+	return st.session.writeFrame(encodeHeader(typeWindowUpdate, flags, st.id, delta), nil)
+}
+
+// readData 在接收的 goroutine 中调用，把 Data 帧的负载读到接收缓存中。
+func (st *Stream) readData(length uint32, flags uint16) error {
+	st.mu.Lock()
+	if length > st.recvWindow {
+		st.mu.Unlock()
+		return ErrRecvWindowExceeded
+	}
+	st.mu.Unlock()
+
+	// 窗口与接收缓存在同一次加锁中修改，保证 sendWindowUpdate 看到的 Size()+recvWindow 不超过容量
+	err := st.session.readPayload(int(length), func(first, end []byte) {
+		st.mu.Lock()
+		st.recvWindow -= uint32(len(first) + len(end))
+		if !st.reset {
+			_, _ = st.recvBuf.Write(first)
+			_, _ = st.recvBuf.Write(end)
+		}
+		st.mu.Unlock()
+		notify(st.recvNotify)
+	})
+	if err != nil {
+		return err
+	}
+	st.processFlags(flags)
+	return nil
+}
+
+// incrSendWindow 在接收的 goroutine 中调用，处理 WindowUpdate 帧。
+func (st *Stream) incrSendWindow(delta uint32, flags uint16) {
+	st.processFlags(flags)
+	st.mu.Lock()
+	st.sendWindow += delta
+	st.mu.Unlock()
+	notify(st.sendNotify)
+}
+
+func (st *Stream) processFlags(flags uint16) {
+	if flags&(flagFIN|flagRST) == 0 {
+		return
+	}
+	st.mu.Lock()
+	if flags&flagFIN != 0 {
+		st.remoteClosed = true
+	}
+	if flags&flagRST != 0 {
+		st.reset = true
+	}
+	closed := st.reset || (st.localClosed && st.remoteClosed)
+	st.mu.Unlock()
+
+	if closed {
+		st.session.removeStream(st.id)
+	}
+	notify(st.recvNotify)
+	notify(st.sendNotify)
+}
+
+// wait 等待 ch 的通知，直到 deadline 或者 Session 关闭。
+func (st *Stream) wait(ch chan struct{}, deadline time.Time) error {
+	var timeout <-chan time.Time
+	if !deadline.IsZero() {
+		d := time.Until(deadline)
+		if d <= 0 {
+			return ErrTimeout
+		}
+		timer := time.NewTimer(d)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	select {
+	case <-ch:
+		return nil
+	case <-timeout:
+		return ErrTimeout
+	case <-st.session.shutdownCh:
+		return ErrSessionShutdown
+	}
+}
+
+func notify(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
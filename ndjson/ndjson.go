@@ -0,0 +1,78 @@
+// Package ndjson 从 RingBuffer 中逐条取出换行分隔的 JSON 记录(NDJSON / JSON Lines)。
+package ndjson
+
+import (
+	"encoding/json"
+
+	"github.com/zput/ringbuffer"
+	"github.com/zput/ringbuffer/codec"
+)
+
+// DefaultMaxRecordSize 是一条记录(不包括换行)默认的最大长度。
+const DefaultMaxRecordSize = 1 << 20
+
+/*
+Decoder 按照 "\n" 或 "\r\n" 切分记录，跳过只有空白的行。
+
+  - 记录不完整时返回 codec.ErrNeedMoreData，不消费任何数据；
+  - 记录超过 MaxRecordSize 时返回 codec.ErrFrameTooLong，并且丢弃这条记录，之后继续正常解码。
+
+Decoder 保存了扫描状态，一个 Decoder 只能用于一个数据流。
+*/
+type Decoder struct {
+	lines *codec.DelimiterDecoder
+}
+
+// NewDecoder 返回一个 Decoder；maxRecordSize <= 0 时使用 DefaultMaxRecordSize。
+func NewDecoder(maxRecordSize int) *Decoder {
+	if maxRecordSize <= 0 {
+		maxRecordSize = DefaultMaxRecordSize
+	}
+	lines, _ := codec.NewLineDecoder(maxRecordSize, true)
+	return &Decoder{lines: lines}
+}
+
+// Next 取出下一条记录并消费它；返回的切片是一段连续的新内存，可以直接交给 json.Unmarshal。
+// no thread safety guarantees; 内部使用 rb 的 explore 游标
+func (d *Decoder) Next(rb *ringbuffer.RingBuffer) ([]byte, error) {
+	for {
+		record, err := codec.Decode(rb, d.lines)
+		if err != nil {
+			return nil, err
+		}
+		if !isBlank(record) {
+			return record, nil
+		}
+	}
+}
+
+// Decode 取出下一条记录并用 json.Unmarshal 解码到 v 中。
+// 记录不是合法的 JSON 时返回 json 的错误，这条记录已经被消费，不影响后面的记录。
+func (d *Decoder) Decode(rb *ringbuffer.RingBuffer, v interface{}) error {
+	record, err := d.Next(rb)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(record, v)
+}
+
+func isBlank(b []byte) bool {
+	for _, c := range b {
+		if c != ' ' && c != '\t' && c != '\r' {
+			return false
+		}
+	}
+	return true
+}
+
+// Encode 把 v 编码成一行 JSON 写入 out；json.Marshal 的输出不包含换行，不需要转义。
+func Encode(out *ringbuffer.RingBuffer, v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if _, err = out.Write(b); err != nil {
+		return err
+	}
+	return out.WriteOneByte('\n')
+}
@@ -0,0 +1,90 @@
+package ndjson
+
+import (
+	"testing"
+
+	"github.com/zput/ringbuffer"
+	"github.com/zput/ringbuffer/codec"
+)
+
+type record struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+func TestDecoder(t *testing.T) {
+	stream := "{\"id\":1,\"name\":\"a\"}\n\n  \r\n{\"id\":2,\"name\":\"b\\nc\"}\r\n{\"id\":3}\n"
+
+	// 一个字节一个字节地到达，经过缓存的尾部
+	rb := ringbuffer.New(16)
+	_, _ = rb.Write(make([]byte, 10))
+	_, _ = rb.Read(make([]byte, 10))
+
+	d := NewDecoder(0)
+	var got []record
+	for i := 0; i < len(stream); i++ {
+		_ = rb.WriteOneByte(stream[i])
+		for {
+			var r record
+			err := d.Decode(rb, &r)
+			if err == codec.ErrNeedMoreData {
+				break
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			got = append(got, r)
+		}
+	}
+	expect := []record{{1, "a"}, {2, "b\nc"}, {3, ""}}
+	if len(got) != len(expect) {
+		t.Fatalf("expect %v but got %v", expect, got)
+	}
+	for i := range expect {
+		if got[i] != expect[i] {
+			t.Fatalf("expect %v but got %v", expect, got)
+		}
+	}
+	if !rb.IsEmpty() {
+		t.Fatalf("expect empty but got size %d", rb.Size())
+	}
+}
+
+func TestDecoder_Errors(t *testing.T) {
+	d := NewDecoder(16)
+	rb := ringbuffer.New(8)
+	_, _ = rb.WriteString("{\"id\":1,\"name\":\"too long\"}\n{bad}\n{\"id\":4}")
+
+	var r record
+	if err := d.Decode(rb, &r); err != codec.ErrFrameTooLong {
+		t.Fatalf("expect ErrFrameTooLong but got %v", err)
+	}
+	if err := d.Decode(rb, &r); err == nil {
+		t.Fatal("expect a json error")
+	}
+	// 不完整的记录原样留在缓存中
+	if err := d.Decode(rb, &r); err != codec.ErrNeedMoreData {
+		t.Fatalf("expect ErrNeedMoreData but got %v", err)
+	}
+	if rb.Size() != len("{\"id\":4}") {
+		t.Fatalf("partial record should be untouched; got size %d", rb.Size())
+	}
+	_ = rb.WriteOneByte('\n')
+	if err := d.Decode(rb, &r); err != nil || r.ID != 4 {
+		t.Fatalf("unexpected record %v %v", r, err)
+	}
+}
+
+func TestEncode(t *testing.T) {
+	rb := ringbuffer.New(8)
+	if err := Encode(rb, record{ID: 1, Name: "x\ny"}); err != nil {
+		t.Fatal(err)
+	}
+	if got := string(rb.ReadAll2NewByteSlice()); got != "{\"id\":1,\"name\":\"x\\ny\"}\n" {
+		t.Fatalf("unexpected output %q", got)
+	}
+	record, err := NewDecoder(0).Next(rb)
+	if err != nil || string(record) != "{\"id\":1,\"name\":\"x\\ny\"}" {
+		t.Fatalf("unexpected record %q %v", record, err)
+	}
+}
@@ -0,0 +1,196 @@
+package ringbuffer
+
+import "errors"
+
+// 偏移之前的数据已经被消费，并且不在保留的历史数据中。
+var ErrOffsetConsumed = errors.New("offset is already consumed; ring buffer")
+
+// 偏移对应的字节已经被 TruncateTail/ReadBack 从末尾删掉。
+var ErrOffsetRemoved = errors.New("offset is removed from the tail; ring buffer")
+
+/*
+读写偏移是字节在整个流中的位置，ReadOffset() 是缓存中第一个字节的偏移，WriteOffset() 是下一个写入的字节的偏移：
+
+	ReadOffset() <= 缓存中的数据 < WriteOffset()
+
+环绕、扩容、Reset 不影响偏移；一个字节从写入开始到被消费为止，偏移保持不变，偏移也不会分配给另一个还在缓存中的字节。
+
+  - WriteOffset() 只会增加；
+  - ReadOffset() 只在 Rewind/WriteFront 把字节放回读指针之前时减少：
+    Rewind 退回的字节使用原来的偏移，WriteFront 写入的 n 个字节使用 [ReadOffset()-n, ReadOffset()) 的偏移；
+  - TruncateTail/ReadBack 删掉的字节的偏移不会分配给之后写入的字节，之后写入的字节仍然从 WriteOffset() 开始；
+    访问这些偏移时返回 ErrOffsetRemoved(除非它们在 ReadOffset() 之前，被 WriteFront 重新使用)。
+
+可以用偏移做流重组、断点记录、与日志对应；PeekAbs/DiscardTo 用偏移直接访问缓存中的数据。
+NewWithData/NewWithDataAndPointer 中已有的数据当作从偏移 0 开始写入的。
+*/
+
+// offsetGap 是从末尾删掉的字节留下的空洞：位置 at 以及之后的字节，偏移都要再加上 n。
+type offsetGap struct {
+	at uint64
+	n  uint64
+}
+
+// WriteOffset 返回下一个写入的字节的偏移。
+// READ LOCK
+func (this *RingBuffer) WriteOffset() uint64 {
+	this.m.RLock()
+	defer this.m.RUnlock()
+
+	return this.offsetOf(this.wPos)
+}
+
+// ReadOffset 返回缓存中第一个字节的偏移。
+// READ LOCK
+func (this *RingBuffer) ReadOffset() uint64 {
+	this.m.RLock()
+	defer this.m.RUnlock()
+
+	return this.readOffset()
+}
+
+// called by inside;  non lock
+func (this *RingBuffer) readOffset() uint64 {
+	return this.offsetOf(this.headPos())
+}
+
+// headPos 返回读指针的位置。
+// called by inside;  non lock
+func (this *RingBuffer) headPos() uint64 {
+	return this.wPos - uint64(this.size())
+}
+
+// offsetOf 返回位置 pos 处的字节的偏移。
+// called by inside;  non lock
+func (this *RingBuffer) offsetOf(pos uint64) uint64 {
+	off := pos
+	for _, g := range this.gaps {
+		if g.at > pos {
+			break
+		}
+		off += g.n
+	}
+	return off
+}
+
+// posOf 返回偏移 off 对应的位置；off 是被删掉的偏移时 ok 为 false，pos 是空洞之后的第一个位置。
+// called by inside;  non lock
+func (this *RingBuffer) posOf(off uint64) (pos uint64, ok bool) {
+	var shift uint64
+	for _, g := range this.gaps {
+		// 偏移 [g.at+shift, g.at+shift+g.n) 被删掉了
+		if off < g.at+shift {
+			break
+		}
+		if off < g.at+shift+g.n {
+			return g.at, false
+		}
+		shift += g.n
+	}
+	return off - shift, true
+}
+
+// posRange 返回偏移 [off, off+n) 的第一个字节的位置；其中有被删掉的偏移时返回 ErrOffsetRemoved。
+// called by inside;  non lock
+func (this *RingBuffer) posRange(off uint64, n int) (uint64, error) {
+	pos, ok := this.posOf(off)
+	if !ok {
+		return 0, ErrOffsetRemoved
+	}
+	if n > 0 {
+		if last, ok := this.posOf(off + uint64(n) - 1); !ok || last-pos != uint64(n-1) {
+			return 0, ErrOffsetRemoved
+		}
+	}
+	return pos, nil
+}
+
+// removeOffsets 在末尾的 n 个字节被删掉以后记录空洞，写指针的位置后退 n，WriteOffset() 不变。
+// called by inside;  non lock
+func (this *RingBuffer) removeOffsets(n int) {
+	at := this.wPos - uint64(n)
+	merged := uint64(n)
+	// 被删掉的字节中的空洞与新的空洞合并
+	i := len(this.gaps)
+	for i > 0 && this.gaps[i-1].at >= at {
+		i--
+		merged += this.gaps[i].n
+	}
+	this.gaps = append(this.gaps[:i], offsetGap{at: at, n: merged})
+	this.wPos = at
+	this.pruneGaps()
+}
+
+// pruneGaps 去掉读指针(以及历史数据)之前的空洞：把之后的位置整体后移它们的长度，偏移不变。
+// called by inside;  non lock
+func (this *RingBuffer) pruneGaps() {
+	if len(this.gaps) == 0 {
+		return
+	}
+	floor := this.headPos() - uint64(this.hist)
+	var shift uint64
+	i := 0
+	for ; i < len(this.gaps) && this.gaps[i].at <= floor; i++ {
+		shift += this.gaps[i].n
+	}
+	if i == 0 {
+		return
+	}
+	this.wPos += shift
+	n := copy(this.gaps, this.gaps[i:])
+	this.gaps = this.gaps[:n]
+	for j := range this.gaps {
+		this.gaps[j].at += shift
+	}
+}
+
+/*
+PeekAbs 返回偏移 off 处的 n 个字节，不消费；跨越缓存尾部时分成两段，first 在前、end 在后。
+保留历史数据(NewWithHistory)时也可以访问 ReadOffset() 之前的 HistorySize() 个字节。
+off 已经被消费(并且不在历史数据中)时返回 ErrOffsetConsumed，还没有写入 n 个字节时返回 ErrNotEnoughData，
+其中有从末尾删掉的偏移时返回 ErrOffsetRemoved。
+返回的切片直接引用缓存的内存，只在下一次写入之前有效。
+*/
+// READ LOCK
+func (this *RingBuffer) PeekAbs(off uint64, n int) (first []byte, end []byte, err error) {
+	this.m.RLock()
+	defer this.m.RUnlock()
+
+	if n < 0 {
+		return nil, nil, ErrNegativeCount
+	}
+	head := this.headPos()
+	if off < this.offsetOf(head-uint64(this.hist)) {
+		return nil, nil, ErrOffsetConsumed
+	}
+	if wOff := this.offsetOf(this.wPos); off > wOff || wOff-off < uint64(n) {
+		return nil, nil, ErrNotEnoughData
+	}
+	pos, err := this.posRange(off, n)
+	if err != nil {
+		return nil, nil, err
+	}
+	first, end = this.peekAt(int(int64(pos)-int64(head)), n)
+	return first, end, nil
+}
+
+/*
+DiscardTo 消费偏移 off 之前的所有数据，之后 ReadOffset() >= off(off 之后的偏移被删掉时是空洞之后的第一个偏移)。
+off 已经被消费时返回 ErrOffsetConsumed，超过 WriteOffset() 时返回 ErrNotEnoughData，都不消费任何数据。
+*/
+// CONSUME LOCK
+func (this *RingBuffer) DiscardTo(off uint64) error {
+	this.m.ConsumeLock()
+	defer this.m.ConsumeUnlock()
+
+	if off < this.readOffset() {
+		return ErrOffsetConsumed
+	}
+	if off > this.offsetOf(this.wPos) {
+		return ErrNotEnoughData
+	}
+	// 被删掉的偏移对应空洞之后的第一个位置
+	pos, _ := this.posOf(off)
+	_, err := this.discard(int(pos - this.headPos()))
+	return err
+}
@@ -0,0 +1,163 @@
+package ringbuffer
+
+import (
+	"testing"
+)
+
+func TestOffset(t *testing.T) {
+	rb := New(4)
+	check := func(r, w uint64) {
+		t.Helper()
+		if rb.ReadOffset() != r || rb.WriteOffset() != w {
+			t.Fatalf("expect offsets %d/%d but got %d/%d", r, w, rb.ReadOffset(), rb.WriteOffset())
+		}
+	}
+	check(0, 0)
+
+	_, _ = rb.WriteString("abc")
+	_, _ = rb.Read(make([]byte, 2))
+	check(2, 3)
+	// 环绕
+	_, _ = rb.WriteString("def")
+	_ = rb.WriteByte('g')
+	check(2, 7)
+	// 扩容
+	_, _ = rb.WriteString("hijkl")
+	check(2, 12)
+	_, _ = rb.ReadByte()
+	_, _ = rb.Discard(2)
+	check(5, 12)
+
+	rb.ExploreBegin()
+	_, _ = rb.ExploreRead(make([]byte, 2))
+	rb.ExploreCommit()
+	check(7, 12)
+
+	c := rb.NewCursor()
+	_ = c.Skip(1)
+	_ = c.Commit()
+	check(8, 12)
+
+	rb.Reset()
+	check(12, 12)
+	_, _ = rb.WriteString("mn")
+	check(12, 14)
+
+	rb = NewWithData([]byte("full"))
+	check(0, 4)
+}
+
+// TestOffset_Stable 确认双端操作与 Rewind 不改变缓存中其他字节的偏移。
+func TestOffset_Stable(t *testing.T) {
+	rb := NewWithHistory(4, 8)
+	check := func(r, w uint64) {
+		t.Helper()
+		if rb.ReadOffset() != r || rb.WriteOffset() != w {
+			t.Fatalf("expect offsets %d/%d but got %d/%d", r, w, rb.ReadOffset(), rb.WriteOffset())
+		}
+	}
+	at := func(off uint64, expect string) {
+		t.Helper()
+		first, end, err := rb.PeekAbs(off, len(expect))
+		if err != nil || string(first)+string(end) != expect {
+			t.Fatalf("expect %q at %d but got %q %q %v", expect, off, first, end, err)
+		}
+	}
+
+	_, _ = rb.WriteString("abcdefgh")
+	_, _ = rb.Read(make([]byte, 5))
+	check(5, 8)
+
+	// Rewind 把字节按原来的偏移退回
+	_ = rb.Rewind(2)
+	check(3, 8)
+	at(3, "defgh")
+
+	// ReadBack/TruncateTail 删掉的偏移不会再使用
+	_, _ = rb.ReadBack(make([]byte, 1))
+	_ = rb.TruncateTail(1)
+	check(3, 8)
+	at(3, "def")
+	if _, _, err := rb.PeekAbs(6, 1); err != ErrOffsetRemoved {
+		t.Fatalf("expect ErrOffsetRemoved but got %v", err)
+	}
+	_, _ = rb.WriteString("xy")
+	check(3, 10)
+	at(5, "f")
+	at(8, "xy")
+	if _, _, err := rb.PeekAbs(5, 4); err != ErrOffsetRemoved {
+		t.Fatalf("expect ErrOffsetRemoved but got %v", err)
+	}
+
+	// WriteFront 使用 ReadOffset 之前的偏移
+	_, _ = rb.WriteFront([]byte("12"))
+	check(1, 10)
+	at(1, "12def")
+
+	// 偏移不能小于 0
+	if _, err := rb.WriteFront([]byte("ABC")); err != ErrOffsetUnderflow {
+		t.Fatalf("expect ErrOffsetUnderflow but got %v", err)
+	}
+	check(1, 10)
+
+	// DiscardTo 删掉的偏移时跳到空洞之后
+	if err := rb.DiscardTo(7); err != nil {
+		t.Fatal(err)
+	}
+	check(8, 10)
+	at(8, "xy")
+	_, _ = rb.WriteString("z")
+	_, _ = rb.Read(make([]byte, 3))
+	check(11, 11)
+}
+
+func TestPeekAbs(t *testing.T) {
+	rb := New(4)
+	_, _ = rb.WriteString("abc")
+	_, _ = rb.Read(make([]byte, 3))
+	_, _ = rb.WriteString("defg")
+
+	first, end, err := rb.PeekAbs(3, 3)
+	if err != nil || string(first)+string(end) != "def" || len(end) == 0 {
+		t.Fatalf("unexpected peek %q %q %v", first, end, err)
+	}
+	if first, end, err = rb.PeekAbs(7, 0); err != nil || len(first)+len(end) != 0 {
+		t.Fatalf("unexpected peek %q %q %v", first, end, err)
+	}
+	if _, _, err = rb.PeekAbs(2, 1); err != ErrOffsetConsumed {
+		t.Fatalf("expect ErrOffsetConsumed but got %v", err)
+	}
+	if _, _, err = rb.PeekAbs(5, 3); err != ErrNotEnoughData {
+		t.Fatalf("expect ErrNotEnoughData but got %v", err)
+	}
+	if _, _, err = rb.PeekAbs(8, 0); err != ErrNotEnoughData {
+		t.Fatalf("expect ErrNotEnoughData but got %v", err)
+	}
+	if _, _, err = rb.PeekAbs(3, -1); err != ErrNegativeCount {
+		t.Fatalf("expect ErrNegativeCount but got %v", err)
+	}
+}
+
+func TestDiscardTo(t *testing.T) {
+	rb := New(4)
+	_, _ = rb.WriteString("abcdef")
+
+	if err := rb.DiscardTo(7); err != ErrNotEnoughData || rb.ReadOffset() != 0 {
+		t.Fatalf("expect ErrNotEnoughData but got %v at %d", err, rb.ReadOffset())
+	}
+	if err := rb.DiscardTo(2); err != nil || rb.ReadOffset() != 2 {
+		t.Fatalf("unexpected discard %v at %d", err, rb.ReadOffset())
+	}
+	if b, _ := rb.PeekByte(false); b != 'c' {
+		t.Fatalf("expect c but got %c", b)
+	}
+	if err := rb.DiscardTo(2); err != nil {
+		t.Fatal(err)
+	}
+	if err := rb.DiscardTo(1); err != ErrOffsetConsumed {
+		t.Fatalf("expect ErrOffsetConsumed but got %v", err)
+	}
+	if err := rb.DiscardTo(6); err != nil || !rb.IsEmpty() || rb.ReadOffset() != 6 {
+		t.Fatalf("unexpected discard %v at %d", err, rb.ReadOffset())
+	}
+}
@@ -0,0 +1,116 @@
+package ringbuffer
+
+import "encoding/binary"
+
+/*
+WriteMark 是 MarkWrite 记录的写入位置，用来回填已经写入的字节，比如长度前缀：
+
+	mark := rb.MarkWrite()
+	_, _ = rb.Write(make([]byte, 4)) // 预留长度字段
+	_, _ = rb.Write(body1)
+	_, _ = rb.Write(body2)
+	err := rb.PatchUint32BE(mark, uint32(rb.WrittenSince(mark)-4))
+
+回填已经提交的数据时，并发的读者可能已经看到了回填之前的字节；配合写事务(WriteBegin)使用可以避免这个问题。
+WriteMark 基于写偏移：WriteFront 之后 mark 仍然指向原来的字节，mark 的字节已经被消费时返回 ErrOffsetConsumed，
+即使 WriteFront 重新使用了这个偏移；TruncateTail/ReadBack 删掉 mark 处的字节以后，PatchAt 返回 ErrOffsetRemoved，
+不会改到之后重新写入的字节。
+*/
+type WriteMark struct {
+	off uint64
+}
+
+// Offset 返回 mark 的写偏移，与 WriteOffset()/PeekAbs 使用同一个偏移。
+func (this WriteMark) Offset() uint64 {
+	return this.off
+}
+
+// MarkWrite 返回下一个写入的字节的位置；写事务中包括未提交的字节。
+// READ LOCK
+func (this *RingBuffer) MarkWrite() WriteMark {
+	this.m.RLock()
+	defer this.m.RUnlock()
+
+	return WriteMark{off: this.offsetOf(this.wPos) + uint64(this.pend)}
+}
+
+// WrittenSince 返回 mark 之后写入的字节数(包括未提交的字节)。
+// READ LOCK
+func (this *RingBuffer) WrittenSince(mark WriteMark) int {
+	this.m.RLock()
+	defer this.m.RUnlock()
+
+	// 被删掉的偏移对应空洞之后的第一个位置
+	pos, _ := this.posOf(mark.off)
+	return int(int64(this.wPos+uint64(this.pend)) - int64(pos))
+}
+
+/*
+PatchAt 用 p 覆盖 mark 处已经写入的 len(p) 个字节，跨越缓存尾部也可以；不改变读写指针。
+其中有字节已经被消费时返回 ErrOffsetConsumed，有字节还没有写入时返回 ErrNotEnoughData，
+有字节已经被 TruncateTail/ReadBack 删掉时返回 ErrOffsetRemoved(删掉以后再写入的字节使用新的偏移，不会被误改)，都不修改缓存。
+*/
+// READ/WRITE LOCK
+func (this *RingBuffer) PatchAt(mark WriteMark, p []byte) error {
+	this.m.Lock()
+	defer this.m.Unlock()
+
+	// mark 之后 WriteFront 重新使用了这个偏移时，mark 原来的字节已经被消费
+	if mark.off < this.readOffset() || mark.off < this.frontEnd {
+		return ErrOffsetConsumed
+	}
+	if end := this.offsetOf(this.wPos) + uint64(this.pend); mark.off > end || end-mark.off < uint64(len(p)) {
+		return ErrNotEnoughData
+	}
+	pos, err := this.posRange(mark.off, len(p))
+	if err != nil {
+		return err
+	}
+	// 未提交的字节紧跟在已经提交的数据之后，也可以用 peekAt 定位
+	first, end := this.peekAt(int(pos-this.headPos()), len(p))
+	copy(first, p)
+	copy(end, p[len(first):])
+	return nil
+}
+
+// call PatchAt; 大端序
+func (this *RingBuffer) PatchUint16BE(mark WriteMark, v uint16) error {
+	var b [2]byte
+	binary.BigEndian.PutUint16(b[:], v)
+	return this.PatchAt(mark, b[:])
+}
+
+// call PatchAt; 小端序
+func (this *RingBuffer) PatchUint16LE(mark WriteMark, v uint16) error {
+	var b [2]byte
+	binary.LittleEndian.PutUint16(b[:], v)
+	return this.PatchAt(mark, b[:])
+}
+
+// call PatchAt; 大端序
+func (this *RingBuffer) PatchUint32BE(mark WriteMark, v uint32) error {
+	var b [4]byte
+	binary.BigEndian.PutUint32(b[:], v)
+	return this.PatchAt(mark, b[:])
+}
+
+// call PatchAt; 小端序
+func (this *RingBuffer) PatchUint32LE(mark WriteMark, v uint32) error {
+	var b [4]byte
+	binary.LittleEndian.PutUint32(b[:], v)
+	return this.PatchAt(mark, b[:])
+}
+
+// call PatchAt; 大端序
+func (this *RingBuffer) PatchUint64BE(mark WriteMark, v uint64) error {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], v)
+	return this.PatchAt(mark, b[:])
+}
+
+// call PatchAt; 小端序
+func (this *RingBuffer) PatchUint64LE(mark WriteMark, v uint64) error {
+	var b [8]byte
+	binary.LittleEndian.PutUint64(b[:], v)
+	return this.PatchAt(mark, b[:])
+}
@@ -0,0 +1,80 @@
+package ringbuffer
+
+import (
+	"testing"
+)
+
+func TestPatch_LengthPrefix(t *testing.T) {
+	rb := New(8)
+	_, _ = rb.Write(make([]byte, 6))
+	_, _ = rb.Read(make([]byte, 6))
+
+	// 长度字段跨越缓存尾部
+	mark := rb.MarkWrite()
+	_, _ = rb.Write(make([]byte, 4))
+	_, _ = rb.WriteString("body")
+	if n := rb.WrittenSince(mark); n != 8 {
+		t.Fatalf("expect 8 bytes written but got %d", n)
+	}
+	if err := rb.PatchUint32BE(mark, uint32(rb.WrittenSince(mark)-4)); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := rb.PeekUint32BE(false); v != 4 || err != nil {
+		t.Fatalf("expect length 4 but got %d %v", v, err)
+	}
+	if err := rb.PatchUint16LE(mark, 0x0102); err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := rb.PeekUint16BE(false); v != 0x0201 {
+		t.Fatalf("unexpected patched value %x", v)
+	}
+	if rb.Size() != 8 || rb.WriteOffset() != 14 {
+		t.Fatalf("patch should not move pointers; got %d %d", rb.Size(), rb.WriteOffset())
+	}
+}
+
+func TestPatch_Range(t *testing.T) {
+	rb := New(8)
+	_, _ = rb.WriteString("ab")
+	mark := rb.MarkWrite()
+	_, _ = rb.WriteString("cd")
+
+	if err := rb.PatchUint32LE(mark, 1); err != ErrNotEnoughData {
+		t.Fatalf("expect ErrNotEnoughData but got %v", err)
+	}
+	if err := rb.PatchUint64BE(WriteMark{off: 10}, 1); err != ErrNotEnoughData {
+		t.Fatalf("expect ErrNotEnoughData but got %v", err)
+	}
+	if err := rb.PatchAt(mark, []byte("CD")); err != nil {
+		t.Fatal(err)
+	}
+	_, _ = rb.Read(make([]byte, 3))
+	if err := rb.PatchAt(mark, []byte("x")); err != ErrOffsetConsumed {
+		t.Fatalf("expect ErrOffsetConsumed but got %v", err)
+	}
+	if got := string(rb.ReadAll2NewByteSlice()); got != "D" {
+		t.Fatalf("expect D but got %q", got)
+	}
+	if mark.Offset() != 2 {
+		t.Fatalf("expect offset 2 but got %d", mark.Offset())
+	}
+}
+
+func TestPatch_WriteTx(t *testing.T) {
+	rb := New(4)
+	rb.WriteBegin()
+	mark := rb.MarkWrite()
+	_, _ = rb.Write(make([]byte, 8))
+	_, _ = rb.WriteString("payload")
+	// 未提交的字节也可以回填，扩容不影响 mark
+	if err := rb.PatchUint64LE(mark, uint64(rb.WrittenSince(mark)-8)); err != nil {
+		t.Fatal(err)
+	}
+	if rb.Size() != 0 {
+		t.Fatalf("pending bytes should be invisible; got size %d", rb.Size())
+	}
+	_ = rb.WriteCommit()
+	if v, err := rb.PeekUint64LE(false); v != 7 || err != nil {
+		t.Fatalf("expect length 7 but got %d %v", v, err)
+	}
+}
@@ -7,6 +7,11 @@ func (this *RingBuffer) Peek(len int, isUsingExplore bool) (first []byte, end []
 	this.m.RLock()
 	defer this.m.RUnlock()
 
+	return this.peek(len, isUsingExplore)
+}
+
+// called by inside;  non lock
+func (this *RingBuffer) peek(len int, isUsingExplore bool) (first []byte, end []byte) {
 	var (
 		readPosition int
 	)
@@ -51,6 +56,11 @@ func (this *RingBuffer) PeekAll(isUsingExplore bool) (first []byte, end []byte)
 	this.m.RLock()
 	defer this.m.RUnlock()
 
+	return this.peekAll(isUsingExplore)
+}
+
+// called by inside;  non lock
+func (this *RingBuffer) peekAll(isUsingExplore bool) (first []byte, end []byte) {
 	var (
 		readPosition int
 	)
@@ -77,94 +87,139 @@ func (this *RingBuffer) PeekAll(isUsingExplore bool) (first []byte, end []byte)
 	return
 }
 
-// READ LOCK
-func (this *RingBuffer) PeekUint8(isUsingExplore bool) uint8 {
-	this.m.RLock()
-	defer this.m.RUnlock()
-
+// peekCopy 把 len(p) 个字节拷贝到 p 中；数据不够时返回 ErrNotEnoughData。
+// called by inside;  non lock
+func (this *RingBuffer) peekCopy(p []byte, isUsingExplore bool) error {
 	if isUsingExplore == true {
-		if this.ExploreSize() < 1 {
-			return 0
+		if this.exploreSize() < len(p) {
+			return ErrNotEnoughData
 		}
 	}else{
-		if this.size() < 1 {
-			return 0
+		if this.size() < len(p) {
+			return ErrNotEnoughData
 		}
 	}
 
-	f, e := this.Peek(1, isUsingExplore)
-	if len(e) > 0 {
-		return e[0]
-	} else {
-		return f[0]
-	}
+	f, e := this.peek(len(p), isUsingExplore)
+	copy(p, f)
+	copy(p[len(f):], e)
+	return nil
 }
 
+/*
+	PeekByte/PeekUintXXBE/PeekUintXXLE 返回读指针(isUsingExplore 时是探索指针)处的值，不移动指针；
+	数据不够时返回 ErrNotEnoughData。
+*/
 // READ LOCK
-func (this *RingBuffer) PeekUint16(isUsingExplore bool) uint16 {
+func (this *RingBuffer) PeekByte(isUsingExplore bool) (byte, error) {
 	this.m.RLock()
 	defer this.m.RUnlock()
 
-	if isUsingExplore == true {
-		if this.ExploreSize() < 2 {
-			return 0
-		}
-	}else{
-		if this.size() < 2 {
-			return 0
-		}
+	var b [1]byte
+	err := this.peekCopy(b[:], isUsingExplore)
+	return b[0], err
+}
+
+// READ LOCK
+func (this *RingBuffer) PeekUint16BE(isUsingExplore bool) (uint16, error) {
+	this.m.RLock()
+	defer this.m.RUnlock()
+
+	var b [2]byte
+	if err := this.peekCopy(b[:], isUsingExplore); err != nil {
+		return 0, err
 	}
+	return binary.BigEndian.Uint16(b[:]), nil
+}
 
-	f, e := this.Peek(2, isUsingExplore)
-	if len(e) > 0 {
-		return binary.BigEndian.Uint16(bytesJoin2NewByteSlice(f, e))
-	} else {
-		return binary.BigEndian.Uint16(f)
+// READ LOCK
+func (this *RingBuffer) PeekUint16LE(isUsingExplore bool) (uint16, error) {
+	this.m.RLock()
+	defer this.m.RUnlock()
+
+	var b [2]byte
+	if err := this.peekCopy(b[:], isUsingExplore); err != nil {
+		return 0, err
 	}
+	return binary.LittleEndian.Uint16(b[:]), nil
 }
 
 // READ LOCK
-func (this *RingBuffer) PeekUint32(isUsingExplore bool) uint32 {
+func (this *RingBuffer) PeekUint32BE(isUsingExplore bool) (uint32, error) {
 	this.m.RLock()
 	defer this.m.RUnlock()
 
-	if isUsingExplore == true {
-		if this.ExploreSize() < 4 {
-			return 0
-		}
-	}else{
-		if this.size() < 4 {
-			return 0
-		}
+	var b [4]byte
+	if err := this.peekCopy(b[:], isUsingExplore); err != nil {
+		return 0, err
 	}
+	return binary.BigEndian.Uint32(b[:]), nil
+}
 
-	f, e := this.Peek(4, isUsingExplore)
-	if len(e) > 0 {
-		return binary.BigEndian.Uint32(bytesJoin2NewByteSlice(f, e))
-	} else {
-		return binary.BigEndian.Uint32(f)
+// READ LOCK
+func (this *RingBuffer) PeekUint32LE(isUsingExplore bool) (uint32, error) {
+	this.m.RLock()
+	defer this.m.RUnlock()
+
+	var b [4]byte
+	if err := this.peekCopy(b[:], isUsingExplore); err != nil {
+		return 0, err
 	}
+	return binary.LittleEndian.Uint32(b[:]), nil
 }
 
 // READ LOCK
-func (this *RingBuffer) PeekUint64(isUsingExplore bool) uint64 {
+func (this *RingBuffer) PeekUint64BE(isUsingExplore bool) (uint64, error) {
 	this.m.RLock()
 	defer this.m.RUnlock()
 
-	if isUsingExplore == true {
-		if this.ExploreSize() < 8 {
-			return 0
-		}
-	}else{
-		if this.size() < 8 {
-			return 0
-		}
+	var b [8]byte
+	if err := this.peekCopy(b[:], isUsingExplore); err != nil {
+		return 0, err
 	}
+	return binary.BigEndian.Uint64(b[:]), nil
+}
 
-	f, e := this.Peek(8, isUsingExplore)
-	if len(e) > 0 {
-		return binary.BigEndian.Uint64(bytesJoin2NewByteSlice(f, e))
-	} else {
-		return binary.BigEndian.Uint64(f)
+// READ LOCK
+func (this *RingBuffer) PeekUint64LE(isUsingExplore bool) (uint64, error) {
+	this.m.RLock()
+	defer this.m.RUnlock()
+
+	var b [8]byte
+	if err := this.peekCopy(b[:], isUsingExplore); err != nil {
+		return 0, err
 	}
+	return binary.LittleEndian.Uint64(b[:]), nil
+}
+
+// call PeekByte; 数据不够时返回 0
+//
+// Deprecated: 使用 PeekByte，数据不够时它返回 ErrNotEnoughData。
+func (this *RingBuffer) PeekUint8(isUsingExplore bool) uint8 {
+	v, _ := this.PeekByte(isUsingExplore)
+	return v
+}
+
+// call PeekUint16BE; 数据不够时返回 0
+//
+// Deprecated: 使用 PeekUint16BE，数据不够时它返回 ErrNotEnoughData。
+func (this *RingBuffer) PeekUint16(isUsingExplore bool) uint16 {
+	v, _ := this.PeekUint16BE(isUsingExplore)
+	return v
+}
+
+// call PeekUint32BE; 数据不够时返回 0
+//
+// Deprecated: 使用 PeekUint32BE，数据不够时它返回 ErrNotEnoughData。
+func (this *RingBuffer) PeekUint32(isUsingExplore bool) uint32 {
+	v, _ := this.PeekUint32BE(isUsingExplore)
+	return v
+}
+
+// call PeekUint64BE; 数据不够时返回 0
+//
+// Deprecated: 使用 PeekUint64BE，数据不够时它返回 ErrNotEnoughData。
+func (this *RingBuffer) PeekUint64(isUsingExplore bool) uint64 {
+	v, _ := this.PeekUint64BE(isUsingExplore)
+	return v
 }
@@ -0,0 +1,136 @@
+// Package proxyproto 检测并解析输入缓存开头的 PROXY 协议头(v1 文本格式与 v2 二进制格式)，
+// 见 https://www.haproxy.org/download/2.8/doc/proxy-protocol.txt 。
+package proxyproto
+
+import (
+	"bytes"
+	"errors"
+	"net"
+
+	"github.com/zput/ringbuffer"
+	"github.com/zput/ringbuffer/codec"
+)
+
+var (
+	sigV1 = []byte("PROXY ")
+	sigV2 = []byte("\r\n\r\n\x00\r\nQUIT\n")
+)
+
+// 缓存开头不是 PROXY 协议头；没有消费任何数据，可以把连接当作没有 PROXY 协议头处理。
+var ErrNoProxyHeader = errors.New("no proxy protocol header; proxyproto")
+
+var ErrInvalidHeader = errors.New("proxy protocol header is malformed; proxyproto")
+var ErrUnsupportedVersion = errors.New("proxy protocol version is not supported; proxyproto")
+var ErrChecksumMismatch = errors.New("crc32c checksum of the header does not match; proxyproto")
+
+// Command 表示连接是被代理的(PROXY)，还是代理自己发起的(LOCAL，例如健康检查)。
+type Command byte
+
+const (
+	LOCAL Command = 0x0
+	PROXY Command = 0x1
+)
+
+// TransportProtocol 是 v2 中的地址族与传输协议，v1 只有 TCP4/TCP6/UNSPEC。
+type TransportProtocol byte
+
+const (
+	UNSPEC       TransportProtocol = 0x00
+	TCPv4        TransportProtocol = 0x11
+	UDPv4        TransportProtocol = 0x12
+	TCPv6        TransportProtocol = 0x21
+	UDPv6        TransportProtocol = 0x22
+	UnixStream   TransportProtocol = 0x31
+	UnixDatagram TransportProtocol = 0x32
+)
+
+// v2 中的 TLV 类型。
+const (
+	TLVTypeALPN      byte = 0x01
+	TLVTypeAuthority byte = 0x02
+	TLVTypeCRC32C    byte = 0x03
+	TLVTypeNoop      byte = 0x04
+	TLVTypeUniqueID  byte = 0x05
+	TLVTypeSSL       byte = 0x20
+	TLVTypeNetNS     byte = 0x30
+)
+
+// TLV 是 v2 中地址之后的扩展字段。
+type TLV struct {
+	Type  byte
+	Value []byte
+}
+
+// Header 是解析后的 PROXY 协议头；所有的切片都是拷贝出来的，不引用缓存的内存。
+type Header struct {
+	Version           int // 1 或者 2
+	Command           Command
+	TransportProtocol TransportProtocol
+	// 客户端与代理所连接的地址；LOCAL 或者 UNSPEC(v1 的 UNKNOWN)时为 nil
+	Source      net.Addr
+	Destination net.Addr
+	TLVs        []TLV
+}
+
+// TLV 返回第一个类型为 typ 的 TLV 的值，不存在时 ok 为 false。
+func (h *Header) TLV(typ byte) (value []byte, ok bool) {
+	for _, tlv := range h.TLVs {
+		if tlv.Type == typ {
+			return tlv.Value, true
+		}
+	}
+	return nil, false
+}
+
+/*
+Parse 检测并解析 rb 开头的 PROXY 协议头，成功时恰好消费协议头的字节，之后就是应用层的数据。
+
+  - 开头不是 PROXY 协议头时返回 ErrNoProxyHeader；
+  - 协议头不完整(包括签名只到达了一部分)时返回 codec.ErrNeedMoreData；
+
+出错时都不消费任何数据。
+no thread safety guarantees
+*/
+func Parse(rb *ringbuffer.RingBuffer) (*Header, error) {
+	first, end := rb.Peek(len(sigV2), false)
+	prefix := append(append(make([]byte, 0, len(sigV2)), first...), end...)
+
+	var (
+		h   *Header
+		n   int
+		err error
+	)
+	switch {
+	case hasPrefix(prefix, sigV2):
+		h, n, err = parseV2(rb)
+	case hasPrefix(prefix, sigV1):
+		h, n, err = parseV1(rb)
+	default:
+		return nil, ErrNoProxyHeader
+	}
+	if err != nil {
+		return nil, err
+	}
+	_, _ = rb.Discard(n)
+	return h, nil
+}
+
+// hasPrefix 返回 b 是否以 sig 开头；b 比 sig 短并且是 sig 的前缀时同样返回 true，这时还需要等待更多数据。
+func hasPrefix(b, sig []byte) bool {
+	if len(b) > len(sig) {
+		b = b[:len(sig)]
+	}
+	return len(b) > 0 && bytes.Equal(b, sig[:len(b)])
+}
+
+// peekBytes 返回读指针处的 n 个字节(拷贝)；不足 n 个字节时返回 codec.ErrNeedMoreData。
+func peekBytes(rb *ringbuffer.RingBuffer, n int) ([]byte, error) {
+	if rb.Size() < n {
+		return nil, codec.ErrNeedMoreData
+	}
+	first, end := rb.Peek(n, false)
+	buf := make([]byte, n)
+	copy(buf, first)
+	copy(buf[len(first):], end)
+	return buf, nil
+}
@@ -0,0 +1,184 @@
+package proxyproto
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+	"net"
+	"testing"
+
+	"github.com/zput/ringbuffer"
+	"github.com/zput/ringbuffer/codec"
+)
+
+// buildV2 拼出一个 v2 协议头；withCRC 为 true 时在最后加上 CRC32C 的 TLV。
+func buildV2(verCmd, fam byte, addrs []byte, tlvs []TLV, withCRC bool) []byte {
+	b := append([]byte(nil), sigV2...)
+	b = append(b, verCmd, fam, 0, 0)
+	b = append(b, addrs...)
+	for _, tlv := range tlvs {
+		b = append(b, tlv.Type, byte(len(tlv.Value)>>8), byte(len(tlv.Value)))
+		b = append(b, tlv.Value...)
+	}
+	if withCRC {
+		b = append(b, TLVTypeCRC32C, 0, 4, 0, 0, 0, 0)
+	}
+	binary.BigEndian.PutUint16(b[14:], uint16(len(b)-v2FixedLength))
+	if withCRC {
+		binary.BigEndian.PutUint32(b[len(b)-4:], crc32.Checksum(b, castagnoli))
+	}
+	return b
+}
+
+func TestParse_V1(t *testing.T) {
+	cases := []struct {
+		raw   string
+		proto TransportProtocol
+		src   string
+		dst   string
+	}{
+		{"PROXY TCP4 192.168.0.1 192.168.0.11 56324 443\r\n", TCPv4, "192.168.0.1:56324", "192.168.0.11:443"},
+		{"PROXY TCP6 2001:db8::1 ::1 65535 0\r\n", TCPv6, "[2001:db8::1]:65535", "[::1]:0"},
+		{"PROXY UNKNOWN ffff::1 ffff::2 1 2\r\n", UNSPEC, "", ""},
+		{"PROXY UNKNOWN\r\n", UNSPEC, "", ""},
+	}
+	for _, c := range cases {
+		rb := ringbuffer.New(8)
+		_, _ = rb.WriteString(c.raw + "GET /")
+		h, err := Parse(rb)
+		if err != nil {
+			t.Fatalf("%q: %v", c.raw, err)
+		}
+		if h.Version != 1 || h.Command != PROXY || h.TransportProtocol != c.proto {
+			t.Fatalf("%q: unexpected header %+v", c.raw, h)
+		}
+		if c.src != "" && (h.Source.String() != c.src || h.Destination.String() != c.dst) {
+			t.Fatalf("%q: unexpected addresses %v %v", c.raw, h.Source, h.Destination)
+		}
+		if c.src == "" && (h.Source != nil || h.Destination != nil) {
+			t.Fatalf("%q: expect no addresses", c.raw)
+		}
+		if got := string(rb.ReadAll2NewByteSlice()); got != "GET /" {
+			t.Fatalf("%q: expect exactly the header consumed but left %q", c.raw, got)
+		}
+	}
+}
+
+func TestParse_V2(t *testing.T) {
+	addrs := []byte{
+		10, 0, 0, 1, // src
+		10, 0, 0, 2, // dst
+		0x1f, 0x90, // 8080
+		0x01, 0xbb, // 443
+	}
+	raw := buildV2(0x21, byte(TCPv4), addrs, []TLV{
+		{Type: TLVTypeALPN, Value: []byte("h2")},
+		{Type: TLVTypeAuthority, Value: []byte("example.com")},
+	}, true)
+
+	// 一个字节一个字节地到达，协议头不完整时不消费数据
+	rb := ringbuffer.New(4)
+	for i := 0; i < len(raw); i++ {
+		_ = rb.WriteOneByte(raw[i])
+		if i == len(raw)-1 {
+			_, _ = rb.WriteString("payload")
+			break
+		}
+		if _, err := Parse(rb); err != codec.ErrNeedMoreData {
+			t.Fatalf("at %d: expect ErrNeedMoreData but got %v", i, err)
+		}
+		if rb.Size() != i+1 {
+			t.Fatalf("at %d: nothing should be consumed", i)
+		}
+	}
+	h, err := Parse(rb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.Version != 2 || h.Command != PROXY || h.TransportProtocol != TCPv4 {
+		t.Fatalf("unexpected header %+v", h)
+	}
+	if h.Source.String() != "10.0.0.1:8080" || h.Destination.String() != "10.0.0.2:443" {
+		t.Fatalf("unexpected addresses %v %v", h.Source, h.Destination)
+	}
+	if alpn, ok := h.TLV(TLVTypeALPN); !ok || string(alpn) != "h2" {
+		t.Fatalf("unexpected alpn %q", alpn)
+	}
+	if authority, _ := h.TLV(TLVTypeAuthority); string(authority) != "example.com" {
+		t.Fatalf("unexpected authority %q", authority)
+	}
+	if got := string(rb.ReadAll2NewByteSlice()); got != "payload" {
+		t.Fatalf("expect exactly the header consumed but left %q", got)
+	}
+
+	// IPv6/UDP
+	addrs6 := make([]byte, v2AddrLengthInet6)
+	copy(addrs6, net.ParseIP("2001:db8::1"))
+	copy(addrs6[16:], net.ParseIP("2001:db8::2"))
+	binary.BigEndian.PutUint16(addrs6[32:], 53)
+	binary.BigEndian.PutUint16(addrs6[34:], 5353)
+	h, err = Parse(ringbuffer.NewWithData(buildV2(0x21, byte(UDPv6), addrs6, nil, false)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := h.Source.(*net.UDPAddr); !ok || h.Source.String() != "[2001:db8::1]:53" || h.Destination.String() != "[2001:db8::2]:5353" {
+		t.Fatalf("unexpected addresses %v %v", h.Source, h.Destination)
+	}
+
+	// unix
+	addrsUnix := make([]byte, v2AddrLengthUnix)
+	copy(addrsUnix, "/var/run/src.sock")
+	copy(addrsUnix[108:], "/var/run/dst.sock")
+	h, err = Parse(ringbuffer.NewWithData(buildV2(0x21, byte(UnixStream), addrsUnix, nil, false)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.Source.String() != "/var/run/src.sock" || h.Destination.Network() != "unix" {
+		t.Fatalf("unexpected addresses %v %v", h.Source, h.Destination)
+	}
+
+	// LOCAL 忽略地址
+	h, err = Parse(ringbuffer.NewWithData(buildV2(0x20, byte(TCPv4), addrs, nil, false)))
+	if err != nil || h.Command != LOCAL || h.Source != nil {
+		t.Fatalf("unexpected header %+v %v", h, err)
+	}
+}
+
+func TestParse_Errors(t *testing.T) {
+	addrs := make([]byte, v2AddrLengthInet)
+	badCRC := buildV2(0x21, byte(TCPv4), addrs, nil, true)
+	badCRC[len(badCRC)-1]++
+	truncatedTLV := buildV2(0x21, byte(TCPv4), addrs, []TLV{{Type: TLVTypeNoop, Value: []byte{1, 2}}}, false)
+	binary.BigEndian.PutUint16(truncatedTLV[len(truncatedTLV)-4:], 3)
+
+	cases := []struct {
+		raw    []byte
+		expect error
+	}{
+		{[]byte("GET / HTTP/1.1\r\n"), ErrNoProxyHeader},
+		{[]byte("\r\n\r\nX"), ErrNoProxyHeader},
+		{[]byte("PROX"), codec.ErrNeedMoreData},
+		{[]byte("\r\n\r\n\x00\r\nQU"), codec.ErrNeedMoreData},
+		{[]byte("PROXY TCP4 1.2.3.4 5.6.7.8 1 2"), codec.ErrNeedMoreData},
+		{[]byte("PROXY TCP4 1.2.3.4 5.6.7.8 1 2\n"), ErrInvalidHeader},
+		{[]byte("PROXY TCP4 ::1 5.6.7.8 1 2\r\n"), ErrInvalidHeader},
+		{[]byte("PROXY TCP4 1.2.3.4 5.6.7.8 01 2\r\n"), ErrInvalidHeader},
+		{[]byte("PROXY TCP4 1.2.3.4 5.6.7.8 1 65536\r\n"), ErrInvalidHeader},
+		{[]byte("PROXY UDP4 1.2.3.4 5.6.7.8 1 2\r\n"), ErrInvalidHeader},
+		{append([]byte("PROXY UNKNOWN "), make([]byte, 100)...), ErrInvalidHeader},
+		{buildV2(0x11, byte(TCPv4), addrs, nil, false), ErrUnsupportedVersion},
+		{buildV2(0x22, byte(TCPv4), addrs, nil, false), ErrInvalidHeader},
+		{buildV2(0x21, 0x13, addrs, nil, false), ErrInvalidHeader},
+		{buildV2(0x21, byte(TCPv6), addrs, nil, false), ErrInvalidHeader},
+		{truncatedTLV, ErrInvalidHeader},
+		{badCRC, ErrChecksumMismatch},
+	}
+	for _, c := range cases {
+		rb := ringbuffer.NewWithData(c.raw)
+		if _, err := Parse(rb); err != c.expect {
+			t.Fatalf("%q: expect %v but got %v", c.raw, c.expect, err)
+		}
+		if rb.Size() != len(c.raw) {
+			t.Fatalf("%q: nothing should be consumed", c.raw)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package proxyproto
+
+import (
+	"bytes"
+	"net"
+	"strconv"
+
+	"github.com/zput/ringbuffer"
+	"github.com/zput/ringbuffer/codec"
+)
+
+// v1 协议头(包括 "\r\n")的最大长度。
+const maxV1Length = 107
+
+/*
+parseV1 解析文本格式的协议头：
+
+	PROXY TCP4 192.168.0.1 192.168.0.11 56324 443\r\n
+	PROXY TCP6 ffff:f...f:ffff ffff:f...f:ffff 65535 65535\r\n
+	PROXY UNKNOWN ...\r\n
+*/
+func parseV1(rb *ringbuffer.RingBuffer) (*Header, int, error) {
+	n := rb.Size()
+	if n > maxV1Length {
+		n = maxV1Length
+	}
+	first, end := rb.Peek(n, false)
+	line := append(append(make([]byte, 0, n), first...), end...)
+	idx := bytes.IndexByte(line, '\n')
+	if idx < 0 {
+		if len(line) >= maxV1Length {
+			return nil, 0, ErrInvalidHeader
+		}
+		return nil, 0, codec.ErrNeedMoreData
+	}
+	if idx == 0 || line[idx-1] != '\r' {
+		return nil, 0, ErrInvalidHeader
+	}
+	n = idx + 1
+
+	fields := bytes.Split(line[len(sigV1):idx-1], []byte{' '})
+	h := &Header{Version: 1, Command: PROXY}
+	switch string(fields[0]) {
+	case "UNKNOWN":
+		// 之后的内容可以忽略
+		h.TransportProtocol = UNSPEC
+		return h, n, nil
+	case "TCP4":
+		h.TransportProtocol = TCPv4
+	case "TCP6":
+		h.TransportProtocol = TCPv6
+	default:
+		return nil, 0, ErrInvalidHeader
+	}
+	if len(fields) != 5 {
+		return nil, 0, ErrInvalidHeader
+	}
+
+	srcIP, dstIP := parseIP(fields[1], h.TransportProtocol), parseIP(fields[2], h.TransportProtocol)
+	srcPort, ok1 := parsePort(fields[3])
+	dstPort, ok2 := parsePort(fields[4])
+	if srcIP == nil || dstIP == nil || !ok1 || !ok2 {
+		return nil, 0, ErrInvalidHeader
+	}
+	h.Source = &net.TCPAddr{IP: srcIP, Port: srcPort}
+	h.Destination = &net.TCPAddr{IP: dstIP, Port: dstPort}
+	return h, n, nil
+}
+
+func parseIP(b []byte, proto TransportProtocol) net.IP {
+	ip := net.ParseIP(string(b))
+	if ip == nil {
+		return nil
+	}
+	isV4 := bytes.IndexByte(b, ':') < 0
+	if isV4 != (proto == TCPv4) {
+		return nil
+	}
+	if isV4 {
+		return ip.To4()
+	}
+	return ip
+}
+
+// parsePort 解析 0 到 65535 之间的十进制端口，不允许前导的 0。
+func parsePort(b []byte) (int, bool) {
+	if len(b) == 0 || len(b) > 5 || (len(b) > 1 && b[0] == '0') {
+		return 0, false
+	}
+	for _, c := range b {
+		if c < '0' || c > '9' {
+			return 0, false
+		}
+	}
+	port, err := strconv.Atoi(string(b))
+	if err != nil || port > 65535 {
+		return 0, false
+	}
+	return port, true
+}
@@ -0,0 +1,153 @@
+package proxyproto
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"net"
+
+	"github.com/zput/ringbuffer"
+)
+
+// v2 固定部分的长度：12 个字节的签名 + ver_cmd + fam + 2 个字节的长度。
+const v2FixedLength = 16
+
+// 各地址族的地址部分的长度。
+const (
+	v2AddrLengthInet  = 12
+	v2AddrLengthInet6 = 36
+	v2AddrLengthUnix  = 216
+)
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+/*
+parseV2 解析二进制格式的协议头：
+
+	+--------------+---------+-----+--------+-----------+------+
+	| signature 12 | ver_cmd | fam | len 2  | addresses | TLVs |
+	+--------------+---------+-----+--------+-----------+------+
+*/
+func parseV2(rb *ringbuffer.RingBuffer) (*Header, int, error) {
+	fixed, err := peekBytes(rb, v2FixedLength)
+	if err != nil {
+		return nil, 0, err
+	}
+	if fixed[12]>>4 != 2 {
+		return nil, 0, ErrUnsupportedVersion
+	}
+	h := &Header{
+		Version:           2,
+		Command:           Command(fixed[12] & 0x0f),
+		TransportProtocol: TransportProtocol(fixed[13]),
+	}
+	if h.Command != LOCAL && h.Command != PROXY {
+		return nil, 0, ErrInvalidHeader
+	}
+
+	n := v2FixedLength + int(binary.BigEndian.Uint16(fixed[14:]))
+	raw, err := peekBytes(rb, n)
+	if err != nil {
+		return nil, 0, err
+	}
+	body := raw[v2FixedLength:]
+
+	var addrLength int
+	switch h.TransportProtocol {
+	case UNSPEC:
+	case TCPv4, UDPv4:
+		addrLength = v2AddrLengthInet
+	case TCPv6, UDPv6:
+		addrLength = v2AddrLengthInet6
+	case UnixStream, UnixDatagram:
+		addrLength = v2AddrLengthUnix
+	default:
+		return nil, 0, ErrInvalidHeader
+	}
+	if len(body) < addrLength {
+		return nil, 0, ErrInvalidHeader
+	}
+	// LOCAL 连接的地址需要忽略
+	if h.Command == PROXY {
+		h.Source, h.Destination = parseV2Addrs(h.TransportProtocol, body[:addrLength])
+	}
+
+	var crcOffset int
+	if h.TLVs, crcOffset, err = parseTLVs(body[addrLength:]); err != nil {
+		return nil, 0, err
+	}
+	if crcOffset >= 0 {
+		if err = verifyChecksum(raw, v2FixedLength+addrLength+crcOffset); err != nil {
+			return nil, 0, err
+		}
+	}
+	return h, n, nil
+}
+
+func parseV2Addrs(proto TransportProtocol, b []byte) (src, dst net.Addr) {
+	switch proto {
+	case TCPv4, UDPv4, TCPv6, UDPv6:
+		ipLength := net.IPv4len
+		if proto == TCPv6 || proto == UDPv6 {
+			ipLength = net.IPv6len
+		}
+		srcIP := net.IP(b[:ipLength])
+		dstIP := net.IP(b[ipLength : 2*ipLength])
+		srcPort := int(binary.BigEndian.Uint16(b[2*ipLength:]))
+		dstPort := int(binary.BigEndian.Uint16(b[2*ipLength+2:]))
+		if proto == TCPv4 || proto == TCPv6 {
+			return &net.TCPAddr{IP: srcIP, Port: srcPort}, &net.TCPAddr{IP: dstIP, Port: dstPort}
+		}
+		return &net.UDPAddr{IP: srcIP, Port: srcPort}, &net.UDPAddr{IP: dstIP, Port: dstPort}
+	case UnixStream, UnixDatagram:
+		network := "unix"
+		if proto == UnixDatagram {
+			network = "unixgram"
+		}
+		return &net.UnixAddr{Name: unixPath(b[:108]), Net: network}, &net.UnixAddr{Name: unixPath(b[108:]), Net: network}
+	}
+	return nil, nil
+}
+
+func unixPath(b []byte) string {
+	if idx := bytes.IndexByte(b, 0); idx >= 0 {
+		b = b[:idx]
+	}
+	return string(b)
+}
+
+// parseTLVs 解析 TLV 列表，同时返回 CRC32C 的值在 b 中的位置(不存在时为 -1)。
+func parseTLVs(b []byte) (tlvs []TLV, crcOffset int, err error) {
+	crcOffset = -1
+	for offset := 0; offset < len(b); {
+		if len(b)-offset < 3 {
+			return nil, 0, ErrInvalidHeader
+		}
+		typ := b[offset]
+		length := int(binary.BigEndian.Uint16(b[offset+1:]))
+		offset += 3
+		if len(b)-offset < length {
+			return nil, 0, ErrInvalidHeader
+		}
+		if typ == TLVTypeCRC32C {
+			if length != 4 {
+				return nil, 0, ErrInvalidHeader
+			}
+			crcOffset = offset
+		}
+		tlvs = append(tlvs, TLV{Type: typ, Value: b[offset : offset+length]})
+		offset += length
+	}
+	return tlvs, crcOffset, nil
+}
+
+// verifyChecksum 校验把 CRC32C 的值置 0 之后整个协议头的校验和。
+func verifyChecksum(raw []byte, crcOffset int) error {
+	expect := binary.BigEndian.Uint32(raw[crcOffset:])
+	zeroed := append([]byte(nil), raw...)
+	binary.BigEndian.PutUint32(zeroed[crcOffset:], 0)
+	if crc32.Checksum(zeroed, castagnoli) != expect {
+		return ErrChecksumMismatch
+	}
+	return nil
+}
@@ -0,0 +1,334 @@
+package resp
+
+import (
+	"bytes"
+	"strconv"
+
+	"github.com/zput/ringbuffer"
+	"github.com/zput/ringbuffer/codec"
+)
+
+const (
+	DefaultMaxBulkLength = 512 * 1024 * 1024
+	DefaultMaxElements   = 1024 * 1024
+	DefaultMaxLineLength = 64 * 1024
+	DefaultMaxDepth      = 32
+)
+
+/*
+Parser 从 RingBuffer 中解析 RESP 值；各项限制用来防止恶意的客户端耗尽内存。
+
+值不完整时 Parser 记住已经确认完整的元素的结尾，以及还没有结束的 aggregate 各自还差多少个元素，
+数据到达后从这里继续扫描，一个字节一个字节地收到一个大的 array 也只扫描一遍；
+扫描到一个完整的值以后才真正解析。换了缓存，或者 explore 游标的偏移变了时从头扫描。
+保存着扫描的状态，每个连接一个，不是线程安全的。
+*/
+type Parser struct {
+	MaxBulkLength int // bulk string/bulk error/verbatim string 的最大长度
+	MaxElements   int // array/map/set/push/attribute 的最大元素个数(map 按键值对计算)
+	MaxLineLength int // simple string/error 等单行值的最大长度
+	MaxDepth      int // 最大嵌套深度
+
+	scanned   int                    // explore 游标之后已经确认完整的字节数
+	searched  int                    // scanned 之后的这一行已经查找到这里，还没有 "\n"
+	pending   []int64                // 还没有结束的 aggregate 还差的元素个数，最外层在前
+	scannedRB *ringbuffer.RingBuffer // 扫描状态所属的缓存
+	scannedAt uint64                 // 扫描时 explore 游标的偏移
+}
+
+// NewParser 返回使用默认限制的 Parser。
+func NewParser() *Parser {
+	return &Parser{
+		MaxBulkLength: DefaultMaxBulkLength,
+		MaxElements:   DefaultMaxElements,
+		MaxLineLength: DefaultMaxLineLength,
+		MaxDepth:      DefaultMaxDepth,
+	}
+}
+
+// Reset 丢弃扫描的状态，下一次从头扫描。
+func (p *Parser) Reset() {
+	_ = p.resetScan()
+}
+
+// Parse 从 rb 中解析一个完整的 RESP 值。
+// 值不完整时返回 codec.ErrNeedMoreData，不消费任何数据；出错时同样不消费数据。
+// no thread safety guarantees; 内部使用 rb 的 explore 游标
+func (p *Parser) Parse(rb *ringbuffer.RingBuffer) (Value, error) {
+	rb.ExploreBegin()
+	v, err := p.ExploreParse(rb)
+	if err != nil {
+		rb.ExploreBreak()
+		return Value{}, err
+	}
+	rb.ExploreCommit()
+	return v, nil
+}
+
+// ExploreParse 与 Parse 相同，但是只移动 explore 游标，由调用者决定 ExploreCommit 还是 ExploreBreak。
+func (p *Parser) ExploreParse(rb *ringbuffer.RingBuffer) (Value, error) {
+	if err := p.scan(rb); err != nil {
+		return Value{}, err
+	}
+	return p.parse(rb, 0)
+}
+
+/*
+scan 从上次停下的地方继续检查 explore 游标之后是不是已经有一个完整的值：
+还不完整时返回 codec.ErrNeedMoreData 并保存进度；完整时清空进度，返回 nil。
+遇到格式错误或者超过限制时同样返回 nil，由 parse 报告具体的错误。
+*/
+func (p *Parser) scan(rb *ringbuffer.RingBuffer) error {
+	first, end := rb.PeekAll(true)
+	total := len(first) + len(end)
+	at := rb.WriteOffset() - uint64(total)
+	if rb != p.scannedRB || at != p.scannedAt || p.scanned > total {
+		p.scanned = 0
+		p.searched = 0
+		p.pending = p.pending[:0]
+	}
+	p.scannedRB, p.scannedAt = rb, at
+	byteAt := func(i int) byte {
+		if i < len(first) {
+			return first[i]
+		}
+		return end[i-len(first)]
+	}
+
+	for {
+		// 找到一行，不包括 "\r\n"
+		lineEnd := -1
+		from := p.scanned
+		if p.searched > from {
+			from = p.searched
+		}
+		for i := from; i < total; i++ {
+			if byteAt(i) == '\n' {
+				lineEnd = i
+				break
+			}
+		}
+		if lineEnd < 0 {
+			p.searched = total
+			if total-p.scanned > p.MaxLineLength+1 {
+				break
+			}
+			return codec.ErrNeedMoreData
+		}
+		if lineEnd-p.scanned < 2 || byteAt(lineEnd-1) != '\r' {
+			break
+		}
+		typ := Type(byteAt(p.scanned))
+		next := lineEnd + 1
+		// length 解析 bulk/aggregate 声明的长度，它一定是一个不超过 20 个字符的整数
+		length := func() (int64, bool) {
+			var buf [20]byte
+			n := lineEnd - 1 - (p.scanned + 1)
+			if n > len(buf) {
+				return 0, false
+			}
+			for i := range buf[:n] {
+				buf[i] = byteAt(p.scanned + 1 + i)
+			}
+			v, err := parseInt(buf[:n])
+			return v, err == nil
+		}
+
+		switch typ {
+		case BulkString, BulkError, VerbatimString:
+			n, ok := length()
+			if !ok || n < -1 || n > int64(p.MaxBulkLength) {
+				return p.resetScan()
+			}
+			if n >= 0 {
+				if int64(total-next) < n+2 {
+					return codec.ErrNeedMoreData
+				}
+				next += int(n) + 2
+			}
+		case Array, Set, Push, Map, Attribute:
+			n, ok := length()
+			if !ok || n < -1 || n > int64(p.MaxElements) || (n > 0 && len(p.pending) >= p.MaxDepth) {
+				return p.resetScan()
+			}
+			if typ == Map || typ == Attribute {
+				n *= 2
+			}
+			if n > 0 {
+				p.scanned = next
+				p.pending = append(p.pending, n)
+				continue
+			}
+		}
+
+		// 一个元素结束，可能也结束了外面的 aggregate
+		p.scanned = next
+		for len(p.pending) > 0 {
+			top := len(p.pending) - 1
+			if p.pending[top]--; p.pending[top] > 0 {
+				break
+			}
+			p.pending = p.pending[:top]
+		}
+		if len(p.pending) == 0 {
+			return p.resetScan()
+		}
+	}
+	return p.resetScan()
+}
+
+// resetScan 清空扫描的进度，下一次从头扫描。
+func (p *Parser) resetScan() error {
+	p.scanned = 0
+	p.searched = 0
+	p.pending = p.pending[:0]
+	p.scannedRB = nil
+	return nil
+}
+
+func (p *Parser) parse(rb *ringbuffer.RingBuffer, depth int) (v Value, err error) {
+	if depth > p.MaxDepth {
+		return v, ErrTooDeep
+	}
+	line, err := p.readLine(rb)
+	if err != nil {
+		return v, err
+	}
+	if len(line) == 0 {
+		return v, ErrProtocol
+	}
+	v.Type = Type(line[0])
+	line = line[1:]
+
+	switch v.Type {
+	case SimpleString, Error, BigNumber:
+		v.Str = line
+	case Integer:
+		v.Int, err = parseInt(line)
+	case Null:
+		if len(line) != 0 {
+			return v, ErrProtocol
+		}
+		v.IsNull = true
+	case Boolean:
+		switch string(line) {
+		case "t":
+			v.Int = 1
+		case "f":
+		default:
+			return v, ErrProtocol
+		}
+	case Double:
+		v.Str = line
+		v.Float, err = strconv.ParseFloat(string(line), 64)
+		if err != nil {
+			err = ErrProtocol
+		}
+	case BulkString, BulkError, VerbatimString:
+		err = p.readBulk(rb, line, &v)
+	case Array, Set, Push, Map, Attribute:
+		err = p.readAggregate(rb, line, depth, &v)
+	default:
+		return v, ErrProtocol
+	}
+	return v, err
+}
+
+func (p *Parser) readBulk(rb *ringbuffer.RingBuffer, line []byte, v *Value) error {
+	n, err := parseInt(line)
+	if err != nil {
+		return err
+	}
+	if n == -1 && v.Type == BulkString {
+		v.IsNull = true
+		return nil
+	}
+	if n < 0 {
+		return ErrProtocol
+	}
+	if n > int64(p.MaxBulkLength) {
+		return ErrBulkTooLong
+	}
+	data, err := codec.ExploreNext(rb, int(n)+2)
+	if err != nil {
+		return err
+	}
+	if data[n] != '\r' || data[n+1] != '\n' {
+		return ErrProtocol
+	}
+	v.Str = data[:n]
+	if v.Type == VerbatimString && (n < 4 || v.Str[3] != ':') {
+		return ErrProtocol
+	}
+	return nil
+}
+
+func (p *Parser) readAggregate(rb *ringbuffer.RingBuffer, line []byte, depth int, v *Value) error {
+	n, err := parseInt(line)
+	if err != nil {
+		return err
+	}
+	if n == -1 && v.Type == Array {
+		v.IsNull = true
+		return nil
+	}
+	if n < 0 {
+		return ErrProtocol
+	}
+	if n > int64(p.MaxElements) {
+		return ErrTooManyElements
+	}
+	if v.Type == Map || v.Type == Attribute {
+		n *= 2
+	}
+	// 每个元素至少 3 个字节，避免按照声明的长度预先分配过多的内存
+	capacity := n
+	if max := int64(rb.ExploreSize() / 3); capacity > max {
+		capacity = max
+	}
+	v.Elems = make([]Value, 0, capacity)
+	for i := int64(0); i < n; i++ {
+		elem, err := p.parse(rb, depth+1)
+		if err != nil {
+			return err
+		}
+		v.Elems = append(v.Elems, elem)
+	}
+	return nil
+}
+
+// readLine 读出 explore 游标之后的一行(不包括 "\r\n")。
+func (p *Parser) readLine(rb *ringbuffer.RingBuffer) ([]byte, error) {
+	first, end := rb.PeekAll(true)
+	idx := bytes.IndexByte(first, '\n')
+	if idx < 0 {
+		if idx = bytes.IndexByte(end, '\n'); idx >= 0 {
+			idx += len(first)
+		}
+	}
+	if idx < 0 {
+		if len(first)+len(end) > p.MaxLineLength+1 {
+			return nil, ErrLineTooLong
+		}
+		return nil, codec.ErrNeedMoreData
+	}
+	if idx > p.MaxLineLength+1 {
+		return nil, ErrLineTooLong
+	}
+	line, err := codec.ExploreNext(rb, idx+1)
+	if err != nil {
+		return nil, err
+	}
+	if idx == 0 || line[idx-1] != '\r' {
+		return nil, ErrProtocol
+	}
+	return line[:idx-1], nil
+}
+
+func parseInt(b []byte) (int64, error) {
+	n, err := strconv.ParseInt(string(b), 10, 64)
+	if err != nil {
+		return 0, ErrProtocol
+	}
+	return n, nil
+}
@@ -0,0 +1,89 @@
+// Package resp 直接从 RingBuffer 中增量地解析 Redis 协议(RESP2/RESP3)，并把回复编码到输出缓存中。
+package resp
+
+import (
+	"errors"
+)
+
+// Type 是 RESP 值的类型，取值就是协议中的类型前缀。
+type Type byte
+
+const (
+	SimpleString Type = '+'
+	Error        Type = '-'
+	Integer      Type = ':'
+	BulkString   Type = '$'
+	Array        Type = '*'
+
+	// RESP3
+	Null           Type = '_'
+	Boolean        Type = '#'
+	Double         Type = ','
+	BigNumber      Type = '('
+	BulkError      Type = '!'
+	VerbatimString Type = '='
+	Map            Type = '%'
+	Set            Type = '~'
+	Push           Type = '>'
+	Attribute      Type = '|'
+)
+
+func (t Type) String() string {
+	switch t {
+	case SimpleString:
+		return "simple string"
+	case Error:
+		return "error"
+	case Integer:
+		return "integer"
+	case BulkString:
+		return "bulk string"
+	case Array:
+		return "array"
+	case Null:
+		return "null"
+	case Boolean:
+		return "boolean"
+	case Double:
+		return "double"
+	case BigNumber:
+		return "big number"
+	case BulkError:
+		return "bulk error"
+	case VerbatimString:
+		return "verbatim string"
+	case Map:
+		return "map"
+	case Set:
+		return "set"
+	case Push:
+		return "push"
+	case Attribute:
+		return "attribute"
+	}
+	return "unknown"
+}
+
+/*
+Value 是一个 RESP 值：
+
+  - SimpleString/Error/BulkString/BulkError/VerbatimString/BigNumber/Double: 内容在 Str 中；
+    VerbatimString 的 Str 包含 "txt:" 这样的格式前缀；
+  - Integer: Int；Boolean: Int 为 1 或者 0；Double: 同时解析到 Float；
+  - Array/Set/Push: 元素在 Elems 中；Map/Attribute: Elems 中依次是 key1, value1, key2, value2 ...；
+  - RESP2 的 "$-1" 与 "*-1" 以及 RESP3 的 "_" 的 IsNull 为 true。
+*/
+type Value struct {
+	Type   Type
+	Str    []byte
+	Int    int64
+	Float  float64
+	Elems  []Value
+	IsNull bool
+}
+
+var ErrProtocol = errors.New("protocol error; resp")
+var ErrBulkTooLong = errors.New("bulk length exceeds the limit; resp")
+var ErrTooManyElements = errors.New("aggregate length exceeds the limit; resp")
+var ErrLineTooLong = errors.New("line length exceeds the limit; resp")
+var ErrTooDeep = errors.New("nesting depth exceeds the limit; resp")
@@ -0,0 +1,236 @@
+package resp
+
+import (
+	"bytes"
+	"math"
+	"testing"
+
+	"github.com/zput/ringbuffer"
+	"github.com/zput/ringbuffer/codec"
+)
+
+func parseString(t *testing.T, p *Parser, s string) Value {
+	rb := ringbuffer.New(4)
+	_, _ = rb.WriteString(s)
+	v, err := p.Parse(rb)
+	if err != nil {
+		t.Fatalf("%q: %v", s, err)
+	}
+	if !rb.IsEmpty() {
+		t.Fatalf("%q: expect all data consumed but %d bytes left", s, rb.Size())
+	}
+	return v
+}
+
+func TestParser_Types(t *testing.T) {
+	p := NewParser()
+
+	if v := parseString(t, p, "+OK\r\n"); v.Type != SimpleString || string(v.Str) != "OK" {
+		t.Fatalf("unexpected %+v", v)
+	}
+	if v := parseString(t, p, "-ERR bad\r\n"); v.Type != Error || string(v.Str) != "ERR bad" {
+		t.Fatalf("unexpected %+v", v)
+	}
+	if v := parseString(t, p, ":-42\r\n"); v.Type != Integer || v.Int != -42 {
+		t.Fatalf("unexpected %+v", v)
+	}
+	if v := parseString(t, p, "$5\r\nhe\r\no\r\n"); v.Type != BulkString || string(v.Str) != "he\r\no" {
+		t.Fatalf("unexpected %+v", v)
+	}
+	if v := parseString(t, p, "$-1\r\n"); v.Type != BulkString || !v.IsNull {
+		t.Fatalf("unexpected %+v", v)
+	}
+	if v := parseString(t, p, "*-1\r\n"); v.Type != Array || !v.IsNull {
+		t.Fatalf("unexpected %+v", v)
+	}
+	if v := parseString(t, p, "_\r\n"); v.Type != Null || !v.IsNull {
+		t.Fatalf("unexpected %+v", v)
+	}
+	if v := parseString(t, p, "#t\r\n"); v.Type != Boolean || v.Int != 1 {
+		t.Fatalf("unexpected %+v", v)
+	}
+	if v := parseString(t, p, ",-inf\r\n"); v.Type != Double || !math.IsInf(v.Float, -1) {
+		t.Fatalf("unexpected %+v", v)
+	}
+	if v := parseString(t, p, "(3492890328409238509324850943850943825024385\r\n"); v.Type != BigNumber {
+		t.Fatalf("unexpected %+v", v)
+	}
+	if v := parseString(t, p, "!21\r\nSYNTAX invalid syntax\r\n"); v.Type != BulkError || string(v.Str) != "SYNTAX invalid syntax" {
+		t.Fatalf("unexpected %+v", v)
+	}
+	if v := parseString(t, p, "=15\r\ntxt:Some string\r\n"); v.Type != VerbatimString || string(v.Str) != "txt:Some string" {
+		t.Fatalf("unexpected %+v", v)
+	}
+
+	v := parseString(t, p, "*3\r\n$3\r\nSET\r\n$1\r\nk\r\n*2\r\n:1\r\n+x\r\n")
+	if v.Type != Array || len(v.Elems) != 3 || string(v.Elems[0].Str) != "SET" || v.Elems[2].Elems[1].Type != SimpleString {
+		t.Fatalf("unexpected %+v", v)
+	}
+	v = parseString(t, p, "%2\r\n+first\r\n:1\r\n+second\r\n:2\r\n")
+	if v.Type != Map || len(v.Elems) != 4 || v.Elems[3].Int != 2 {
+		t.Fatalf("unexpected %+v", v)
+	}
+	v = parseString(t, p, "~2\r\n+a\r\n+b\r\n")
+	if v.Type != Set || len(v.Elems) != 2 {
+		t.Fatalf("unexpected %+v", v)
+	}
+	v = parseString(t, p, ">3\r\n+message\r\n+channel\r\n$5\r\nhello\r\n")
+	if v.Type != Push || len(v.Elems) != 3 || string(v.Elems[2].Str) != "hello" {
+		t.Fatalf("unexpected %+v", v)
+	}
+}
+
+func TestParser_Incremental(t *testing.T) {
+	p := NewParser()
+	msg := "*2\r\n$4\r\nECHO\r\n%1\r\n+k\r\n$5\r\nvalue\r\n"
+
+	rb := ringbuffer.New(8)
+	for i := 0; i < len(msg)-1; i++ {
+		_ = rb.WriteOneByte(msg[i])
+		if _, err := p.Parse(rb); err != codec.ErrNeedMoreData {
+			t.Fatalf("at %d: expect ErrNeedMoreData but got %v", i, err)
+		}
+		if rb.Size() != i+1 {
+			t.Fatalf("incomplete value should not be consumed; expect %d but got %d", i+1, rb.Size())
+		}
+	}
+	_ = rb.WriteOneByte(msg[len(msg)-1])
+	v, err := p.Parse(rb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(v.Elems) != 2 || string(v.Elems[1].Elems[1].Str) != "value" {
+		t.Fatalf("unexpected %+v", v)
+	}
+}
+
+// TestParser_IncrementalLarge 一个字节一个字节地收到一个大的 array：每次只扫描上次停下之后的字节，而不是从头解析。
+func TestParser_IncrementalLarge(t *testing.T) {
+	const n = 2000
+	const elem = "$3\r\nabc\r\n"
+	var msg bytes.Buffer
+	msg.WriteString("*2000\r\n")
+	for i := 0; i < n; i++ {
+		msg.WriteString(elem)
+	}
+	// 后面紧跟着下一个值
+	msg.WriteString("*1\r\n*0\r\n")
+
+	p := NewParser()
+	rb := ringbuffer.New(64)
+	raw := msg.Bytes()
+	var v Value
+	var err error
+	for i := 0; ; i++ {
+		_ = rb.WriteOneByte(raw[i])
+		if v, err = p.Parse(rb); err != codec.ErrNeedMoreData {
+			break
+		}
+		// 还没有确认完整的字节不超过一个元素，下一次只从这里开始扫描
+		if rb.Size()-p.scanned > len(elem) {
+			t.Fatalf("at %d: expect resuming from near the end but scanned %d of %d", i, p.scanned, rb.Size())
+		}
+	}
+	if err != nil || len(v.Elems) != n || string(v.Elems[n-1].Str) != "abc" {
+		t.Fatalf("unexpected %d elements %v", len(v.Elems), err)
+	}
+	if !rb.IsEmpty() || p.scanned != 0 || len(p.pending) != 0 {
+		t.Fatal("expect the array consumed and the parser reset")
+	}
+
+	for _, c := range raw[msg.Len()-len("*1\r\n*0\r\n"):] {
+		_ = rb.WriteOneByte(c)
+		v, err = p.Parse(rb)
+	}
+	if err != nil || v.Type != Array || len(v.Elems) != 1 || len(v.Elems[0].Elems) != 0 {
+		t.Fatalf("unexpected %+v %v", v, err)
+	}
+}
+
+func TestParser_Limits(t *testing.T) {
+	p := NewParser()
+	p.MaxBulkLength = 4
+	p.MaxDepth = 2
+	p.MaxElements = 3
+	p.MaxLineLength = 8
+
+	cases := []struct {
+		input  string
+		expect error
+	}{
+		{"$5\r\n", ErrBulkTooLong},
+		{"*4\r\n", ErrTooManyElements},
+		{"*1\r\n*1\r\n*1\r\n*1\r\n:1\r\n", ErrTooDeep},
+		{"+123456789", ErrLineTooLong},
+		{"+123456789\r\n", ErrLineTooLong},
+		{"?x\r\n", ErrProtocol},
+		{"$2\r\nabcd", ErrProtocol},
+		{":12a\r\n", ErrProtocol},
+		{"+ok\n", ErrProtocol},
+	}
+	for _, c := range cases {
+		rb := ringbuffer.New(16)
+		_, _ = rb.WriteString(c.input)
+		if _, err := p.Parse(rb); err != c.expect {
+			t.Fatalf("%q: expect %v but got %v", c.input, c.expect, err)
+		}
+		if rb.Size() != len(c.input) {
+			t.Fatalf("%q: nothing should be consumed", c.input)
+		}
+	}
+
+	// 刚好等于限制时可以解析
+	parseString(t, p, "*1\r\n*1\r\n:1\r\n")
+	parseString(t, p, "+1234567\r\n")
+	parseString(t, p, "$4\r\nabcd\r\n")
+}
+
+func TestWriter_RoundTrip(t *testing.T) {
+	out := ringbuffer.New(4)
+	w := NewWriter(out)
+
+	_ = w.WriteSimpleString("OK")
+	_ = w.WriteError("ERR x")
+	_ = w.WriteInteger(1234)
+	_ = w.WriteBulkString([]byte("bulk"))
+	_ = w.WriteNullBulkString()
+	_ = w.WriteNullArray()
+	_ = w.WriteNull()
+	_ = w.WriteBoolean(false)
+	_ = w.WriteDouble(1.5)
+	_ = w.WriteBigNumber("12345678901234567890")
+	_ = w.WriteBulkError([]byte("ERR y"))
+	_ = w.WriteVerbatimString("txt", []byte("hi"))
+	_ = w.WriteArrayHeader(2)
+	_ = w.WriteBulkString([]byte("GET"))
+	_ = w.WriteBulkString([]byte("k"))
+	_ = w.WriteValue(Value{Type: Map, Elems: []Value{
+		{Type: SimpleString, Str: []byte("k")},
+		{Type: Set, Elems: []Value{{Type: Integer, Int: 1}}},
+	}})
+	_ = w.WritePushHeader(1)
+	_ = w.WriteSimpleString("pong")
+
+	expect := "+OK\r\n-ERR x\r\n:1234\r\n$4\r\nbulk\r\n$-1\r\n*-1\r\n_\r\n#f\r\n,1.5\r\n" +
+		"(12345678901234567890\r\n!5\r\nERR y\r\n=6\r\ntxt:hi\r\n*2\r\n$3\r\nGET\r\n$1\r\nk\r\n" +
+		"%1\r\n+k\r\n~1\r\n:1\r\n>1\r\n+pong\r\n"
+	if got := out.ReadAll2NewByteSlice(); !bytes.Equal(got, []byte(expect)) {
+		t.Fatalf("expect %q but got %q", expect, got)
+	}
+
+	// 写出去的数据可以被 Parser 原样解析回来
+	p := NewParser()
+	in := ringbuffer.New(8)
+	for i := 0; i < 15; i++ {
+		v, err := p.Parse(out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = NewWriter(in).WriteValue(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := in.ReadAll2NewByteSlice(); !bytes.Equal(got, []byte(expect)) {
+		t.Fatalf("expect %q but got %q", expect, got)
+	}
+}
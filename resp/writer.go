@@ -0,0 +1,198 @@
+package resp
+
+import (
+	"math"
+	"strconv"
+
+	"github.com/zput/ringbuffer"
+)
+
+// Writer 把 RESP 值编码到输出缓存中；内部有一个临时的缓冲区，不是线程安全的。
+type Writer struct {
+	out     *ringbuffer.RingBuffer
+	scratch []byte
+}
+
+// NewWriter 返回一个写入 out 的 Writer。
+func NewWriter(out *ringbuffer.RingBuffer) *Writer {
+	return &Writer{
+		out:     out,
+		scratch: make([]byte, 0, 32),
+	}
+}
+
+// writeLine 写入 prefix + s + "\r\n"；s 可以是 w.scratch。
+func (w *Writer) writeLine(prefix Type, s []byte) error {
+	if err := w.out.WriteOneByte(byte(prefix)); err != nil {
+		return err
+	}
+	if _, err := w.out.Write(s); err != nil {
+		return err
+	}
+	_, err := w.out.WriteString("\r\n")
+	return err
+}
+
+// writeHeader 写入 prefix + n + "\r\n"，例如 "*3\r\n"。
+func (w *Writer) writeHeader(prefix Type, n int64) error {
+	w.scratch = append(w.scratch[:0], byte(prefix))
+	w.scratch = strconv.AppendInt(w.scratch, n, 10)
+	w.scratch = append(w.scratch, '\r', '\n')
+	_, err := w.out.Write(w.scratch)
+	return err
+}
+
+func (w *Writer) WriteSimpleString(s string) error {
+	return w.writeLine(SimpleString, []byte(s))
+}
+
+func (w *Writer) WriteError(s string) error {
+	return w.writeLine(Error, []byte(s))
+}
+
+func (w *Writer) WriteInteger(n int64) error {
+	return w.writeHeader(Integer, n)
+}
+
+func (w *Writer) WriteBulkString(b []byte) error {
+	return w.writeBulk(BulkString, b)
+}
+
+// WriteNullBulkString 写入 RESP2 的空值 "$-1\r\n"。
+func (w *Writer) WriteNullBulkString() error {
+	return w.writeHeader(BulkString, -1)
+}
+
+// WriteNullArray 写入 RESP2 的空数组 "*-1\r\n"。
+func (w *Writer) WriteNullArray() error {
+	return w.writeHeader(Array, -1)
+}
+
+// WriteNull 写入 RESP3 的空值 "_\r\n"。
+func (w *Writer) WriteNull() error {
+	return w.writeLine(Null, nil)
+}
+
+func (w *Writer) WriteBoolean(b bool) error {
+	if b {
+		return w.writeLine(Boolean, []byte{'t'})
+	}
+	return w.writeLine(Boolean, []byte{'f'})
+}
+
+func (w *Writer) WriteDouble(f float64) error {
+	w.scratch = w.scratch[:0]
+	switch {
+	case math.IsInf(f, 1):
+		w.scratch = append(w.scratch, "inf"...)
+	case math.IsInf(f, -1):
+		w.scratch = append(w.scratch, "-inf"...)
+	case math.IsNaN(f):
+		w.scratch = append(w.scratch, "nan"...)
+	default:
+		w.scratch = strconv.AppendFloat(w.scratch, f, 'g', -1, 64)
+	}
+	return w.writeLine(Double, w.scratch)
+}
+
+func (w *Writer) WriteBigNumber(s string) error {
+	return w.writeLine(BigNumber, []byte(s))
+}
+
+func (w *Writer) WriteBulkError(b []byte) error {
+	return w.writeBulk(BulkError, b)
+}
+
+// WriteVerbatimString 写入格式为 format(3 个字节，例如 "txt")的 verbatim string。
+func (w *Writer) WriteVerbatimString(format string, b []byte) error {
+	if len(format) != 3 {
+		return ErrProtocol
+	}
+	if err := w.writeHeader(VerbatimString, int64(len(b)+4)); err != nil {
+		return err
+	}
+	if _, err := w.out.WriteString(format + ":"); err != nil {
+		return err
+	}
+	if _, err := w.out.Write(b); err != nil {
+		return err
+	}
+	_, err := w.out.WriteString("\r\n")
+	return err
+}
+
+// 聚合类型只写入头部，之后需要依次写入 n 个元素(Map 是 n 个键值对)。
+func (w *Writer) WriteArrayHeader(n int) error {
+	return w.writeHeader(Array, int64(n))
+}
+
+func (w *Writer) WriteMapHeader(n int) error {
+	return w.writeHeader(Map, int64(n))
+}
+
+func (w *Writer) WriteSetHeader(n int) error {
+	return w.writeHeader(Set, int64(n))
+}
+
+func (w *Writer) WritePushHeader(n int) error {
+	return w.writeHeader(Push, int64(n))
+}
+
+func (w *Writer) WriteAttributeHeader(n int) error {
+	return w.writeHeader(Attribute, int64(n))
+}
+
+func (w *Writer) writeBulk(t Type, b []byte) error {
+	if err := w.writeHeader(t, int64(len(b))); err != nil {
+		return err
+	}
+	if _, err := w.out.Write(b); err != nil {
+		return err
+	}
+	_, err := w.out.WriteString("\r\n")
+	return err
+}
+
+// WriteValue 按照 v.Type 写入任意一个 Value，包括嵌套的元素。
+func (w *Writer) WriteValue(v Value) error {
+	switch v.Type {
+	case SimpleString, Error, BigNumber:
+		return w.writeLine(v.Type, v.Str)
+	case Integer:
+		return w.WriteInteger(v.Int)
+	case Null:
+		return w.WriteNull()
+	case Boolean:
+		return w.WriteBoolean(v.Int != 0)
+	case Double:
+		return w.WriteDouble(v.Float)
+	case BulkString:
+		if v.IsNull {
+			return w.WriteNullBulkString()
+		}
+		return w.writeBulk(v.Type, v.Str)
+	case BulkError, VerbatimString:
+		return w.writeBulk(v.Type, v.Str)
+	case Array, Set, Push, Map, Attribute:
+		if v.Type == Array && v.IsNull {
+			return w.WriteNullArray()
+		}
+		n := len(v.Elems)
+		if v.Type == Map || v.Type == Attribute {
+			if n%2 != 0 {
+				return ErrProtocol
+			}
+			n /= 2
+		}
+		if err := w.writeHeader(v.Type, int64(n)); err != nil {
+			return err
+		}
+		for _, elem := range v.Elems {
+			if err := w.WriteValue(elem); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return ErrProtocol
+}
@@ -13,6 +13,9 @@ const GrowthFactor float32 = 1.5
 type innerLock struct {
 	sync.RWMutex
 	IsOpen bool
+	// ExploreTx 在整个生命周期中持有 reader，同一时间只有一个探索事务；
+	// 消费数据或者修改读指针一端的操作(CONSUME LOCK)也要先取 reader，事务期间阻塞到事务结束；写入不需要 reader
+	reader sync.Mutex
 }
 
 func (this *innerLock) RLock() {
@@ -35,6 +38,26 @@ func (this *innerLock) Unlock() {
 		this.RWMutex.Unlock()
 	}
 }
+func (this *innerLock) ReaderLock() {
+	if this.IsOpen {
+		this.reader.Lock()
+	}
+}
+func (this *innerLock) ReaderUnlock() {
+	if this.IsOpen {
+		this.reader.Unlock()
+	}
+}
+
+// ConsumeLock 先取 reader 再取写锁，顺序与 ExploreTx 相同
+func (this *innerLock) ConsumeLock() {
+	this.ReaderLock()
+	this.Lock()
+}
+func (this *innerLock) ConsumeUnlock() {
+	this.Unlock()
+	this.ReaderUnlock()
+}
 
 // 缓冲区中没有数据：ErrIsEmpty
 var ErrIsEmpty = errors.New("ring buffer is empty")
@@ -44,6 +67,11 @@ var ErrExploreRetrievingCrossTheLine = errors.New("retrieving cross the line in
 
 var ErrInitRingBufferParameter = errors.New("parameter is not right; when initializing ring buffer")
 
+// 缓存(或者 Cursor、探索指针之后)的数据不够请求的字节数
+var ErrNotEnoughData = errors.New("not enough data; ring buffer")
+
+var ErrNegativeCount = errors.New("negative count; ring buffer")
+
 /*
 	 _ _ _ _ _
 	|_|_|_|_|_|
@@ -69,6 +97,20 @@ type RingBuffer struct {
 	rIdx      int // next position to read
 	wIdx      int // next position to write
 	isEmpty   bool
+	// rIdx 每次被消费移动(不包括扩容时的搬移)、或者缓存两端被修改时都加一，Cursor 用它判断自己是否已经失效
+	readGen uint64
+	// 写指针在整个流中的位置：一共写入过的字节数减去从末尾删掉的字节数；偏移见 offsetOf
+	wPos uint64
+	// 从末尾删掉的字节留下的偏移空洞，按 at 升序
+	gaps []offsetGap
+	// WriteFront 重新使用过的最大偏移(不含)：这之前的偏移原来的字节都已经被消费，指向它们的 WriteMark 不能再回填
+	frontEnd uint64
+	// 读指针之前最多保留多少个已经读过的字节(NewWithHistory)，hist 是现在保留的字节数
+	history int
+	hist    int
+	// 写事务(WriteBegin)中写入、还没有提交的字节数，它们紧跟在 wIdx 之后
+	pend    int
+	inWrite bool
 
 	m innerLock
 }
@@ -102,6 +144,7 @@ func NewWithData(data []byte, isOpenLock ...bool) *RingBuffer {
 		buf: data,
 		cap: len(data),
 		isEmpty:   false,
+		wPos: uint64(len(data)),
 		m:   innerLock{IsOpen: isOpen},
 	}
 }
@@ -126,52 +169,75 @@ func NewWithDataAndPointer(data []byte, beginPointer, endPointer int, isEmpty bo
 	if len(isOpenLock) > 0 {
 		isOpen = isOpenLock[0]
 	}
-	return &RingBuffer{
+	rb := &RingBuffer{
 		buf: data,
 		cap: len(data),
 		rIdx:beginPointer,
 		wIdx:endPointer,
 		isEmpty:isEmpty,
 		m:   innerLock{IsOpen: isOpen},
-	}, nil
+	}
+	// 已有的数据当作从偏移 0 开始写入的
+	rb.wPos = uint64(rb.size())
+	return rb, nil
 }
 
 // 注意，这个array[wIdx]是没有保存数据的，所以计算剩余空间和已占有空间的时候要注意。
 // READ LOCK
 // called by inside;  non lock
 func (this *RingBuffer) free() int {
+	// 读指针之前保留的历史数据、写指针之后未提交的数据都不能被覆盖
 	if this.wIdx == this.rIdx {
 		if this.isEmpty {
-			return this.cap
+			return this.cap - this.hist - this.pend
 		}
 		return 0
 	}
 
 	if this.wIdx < this.rIdx {
-		return this.rIdx - this.wIdx
+		return this.rIdx - this.wIdx - this.hist - this.pend
 	}
 
-	return this.cap - this.wIdx + this.rIdx
+	return this.cap - this.wIdx + this.rIdx - this.hist - this.pend
 }
 
+/*
+	appendSpace 扩容 len 个字节，扩容会搬移数据、改变 rIdx/wIdx:
+	  - 缓存为空时直接把读写指针移动到 0;
+	  - 底层数组还有空间时原地扩容，数据分成两段时把能放进新空间的那一段搬过去;
+	  - 否则申请新的数组，把数据拷贝到新数组的开头。
+	探索指针在扩容前换算成相对读指针的偏移，扩容后再换算回来，所以扩容不影响正在进行的探索。
+	以后其他会搬移数据的操作(缩容、整理)也要这样调用 exploreOffset/rebaseExplore。
+*/
 // called by inside;  non lock
 func (this *RingBuffer) appendSpace(len int) {
+	eprOff := this.exploreOffset()
+	// 历史数据、未提交的数据也要一起搬移：先把读写指针扩展到它们的两端，搬移以后再恢复
+	hist, pend, isEmpty := this.hist, this.pend, this.isEmpty
+	if hist > 0 || pend > 0 {
+		this.rIdx = (this.rIdx - hist + this.cap) % this.cap
+		this.wIdx = (this.wIdx + pend) % this.cap
+		this.isEmpty = false
+	}
+
 	if cap(this.buf) >= this.cap+len{
 		reflect.ValueOf(&this.buf).Elem().SetLen(this.cap+len)
 
-		if this.wIdx <= this.rIdx{
-			if this.wIdx > (this.cap - this.rIdx) {
-				// move from rIdx ->rightIndex
-				for i := this.cap - 1; i >= this.rIdx; i-- {
-					this.buf[i+len] = this.buf[i]
-				}
-				this.rIdx += len
-			}else{
+		if this.isEmpty {
+			this.rIdx = 0
+			this.wIdx = 0
+		}else if this.wIdx <= this.rIdx{
+			if this.wIdx <= len && this.wIdx <= this.cap - this.rIdx {
 				// move from 0 -> wIdx
-				for i:= 0; i<this.wIdx; i++{
-					this.buf[this.cap+i] = this.buf[i]
-				}
+				copy(this.buf[this.cap:], this.buf[:this.wIdx])
 				this.wIdx = this.cap + this.wIdx
+				if this.wIdx == this.cap + len {
+					this.wIdx = 0
+				}
+			}else{
+				// move from rIdx ->rightIndex
+				copy(this.buf[this.rIdx+len:], this.buf[this.rIdx:this.cap])
+				this.rIdx += len
 			}
 		}
 		this.cap += len
@@ -185,9 +251,47 @@ func (this *RingBuffer) appendSpace(len int) {
 
 		this.wIdx = oldLen
 		this.rIdx = 0
+		this.isEmpty = oldLen == 0
 		this.cap = newSize
 		this.buf = newBuf
 	}
+
+	if hist > 0 || pend > 0 {
+		this.rIdx = (this.rIdx + hist) % this.cap
+		this.wIdx = (this.wIdx - pend + this.cap) % this.cap
+		this.isEmpty = isEmpty
+	}
+	this.rebaseExplore(eprOff)
+}
+
+// exploreOffset 返回探索指针相对读指针的偏移；没有在探索时返回 -1。
+// called by inside;  non lock
+func (this *RingBuffer) exploreOffset() int {
+	if !this.inExplore {
+		return -1
+	}
+	off := this.size() - this.exploreSize()
+	if off < 0 {
+		// 探索期间读指针越过了探索指针
+		off = 0
+	}
+	return off
+}
+
+// rebaseExplore 在读写指针被搬移以后，按照 exploreOffset 返回的偏移重新设置探索指针。
+// called by inside;  non lock
+func (this *RingBuffer) rebaseExplore(off int) {
+	if off < 0 {
+		this.eprIdx = this.rIdx
+		this.episEmpty = this.isEmpty
+		return
+	}
+	size := this.size()
+	if off > size {
+		off = size
+	}
+	this.eprIdx = (this.rIdx + off) % this.cap
+	this.episEmpty = off == size
 }
 
 // called by inside;  non lock
@@ -270,6 +374,7 @@ func (this *RingBuffer) read(p []byte) (n int, err error) {
 	return
 }
 
+// READ LOCK
 func (this *RingBuffer) Capacity() int {
 	this.m.RLock()
 	defer this.m.RUnlock()
@@ -294,40 +399,49 @@ func (this *RingBuffer) WriteOneByte(c byte) error {
 		this.appendSpace(1)
 	}
 
-	this.buf[this.wIdx] = c
-	this.wIdx++
-
-	if this.wIdx == this.cap {
-		this.wIdx = 0
+	// 写事务中写到未提交数据的后面
+	pos := this.wIdx + this.pend
+	if pos >= this.cap {
+		pos -= this.cap
 	}
-
-	this.isEmpty = false
+	this.buf[pos] = c
+	if this.inWrite {
+		this.pend++
+		return nil
+	}
+	this.publish(1)
 	return nil
 }
 
-// READ/WRITE LOCK
+// CONSUME LOCK
 func (this *RingBuffer) Read(p []byte) (n int, err error) {
 	if len(p) == 0 {
 		return 0, nil
 	}
 
-	this.m.Lock()
+	this.m.ConsumeLock()
 	n, err = this.read(p)
-	this.m.Unlock()
+	if n > 0 {
+		this.readGen++
+		this.keepHistory(n)
+	}
+	this.m.ConsumeUnlock()
 
 	return
 }
 
-// READ/WRITE LOCK
+// CONSUME LOCK
 func (this *RingBuffer) ReadOneByte() (b byte, err error) {
-	this.m.Lock()
-	defer this.m.Unlock()
+	this.m.ConsumeLock()
+	defer this.m.ConsumeUnlock()
 
 	if this.isEmpty {
 		return 0, ErrIsEmpty
 	}
 	b = this.buf[this.rIdx]
 	this.rIdx++
+	this.readGen++
+	this.keepHistory(1)
 	if this.rIdx == this.cap {
 		this.rIdx = 0
 	}
@@ -353,29 +467,32 @@ func (this *RingBuffer) Write(p []byte) (n int, err error) {
 	if free < n {
 		this.appendSpace(n - free)
 	}
-	if this.wIdx >= this.rIdx {
-		if this.cap-this.wIdx >= n {
-			copy(this.buf[this.wIdx:], p)
-			this.wIdx += n
-		} else {
-			copy(this.buf[this.wIdx:], p[:this.cap-this.wIdx])
-			copy(this.buf[0:], p[this.cap-this.wIdx:])
-			this.wIdx += n - this.cap
-		}
-	} else {
-		copy(this.buf[this.wIdx:], p)
-		this.wIdx += n
+	// 写事务中写到未提交数据的后面；空闲空间从这里开始，可能绕到缓存开头
+	pos := (this.wIdx + this.pend) % this.cap
+	if k := copy(this.buf[pos:this.cap], p); k < n {
+		copy(this.buf[0:], p[k:])
 	}
 
-	if this.wIdx == this.cap {
-		this.wIdx = 0
+	if this.inWrite {
+		this.pend += n
+	} else {
+		this.publish(n)
 	}
-	this.isEmpty = false
 
 	this.m.Unlock()
 	return
 }
 
+// publish 把写指针之后已经拷贝好的 n 个字节变成可以读取的数据；调用者保证 n > 0。
+// called by inside;  non lock
+func (this *RingBuffer) publish(n int) {
+	this.wIdx = (this.wIdx + n) % this.cap
+	this.wPos += uint64(n)
+	this.isEmpty = false
+	// 探索到末尾以后写入的数据可以继续探索
+	this.episEmpty = false
+}
+
 // non lock; this function calls Write
 func (this *RingBuffer) WriteString(s string) (n int, err error) {
 	/*	type = struct string {
@@ -404,25 +521,16 @@ func (this *RingBuffer) ReadAll2NewByteSlice() (buf []byte) {
 	this.m.RLock()
 	defer this.m.RUnlock()
 
-	if this.wIdx == this.rIdx {
-		if !this.isEmpty {
-			buf := make([]byte, this.cap)
-			copy(buf, this.buf)
-			return buf
-		}
-		return
-	}
+	return this.readAll2NewByteSlice()
+}
 
-	if this.wIdx > this.rIdx {
-		buf = make([]byte, this.wIdx-this.rIdx)
-		copy(buf, this.buf[this.rIdx:this.wIdx])
+// called by inside;  non lock
+func (this *RingBuffer) readAll2NewByteSlice() (buf []byte) {
+	if this.isEmpty {
 		return
 	}
-
-	buf = make([]byte, this.cap-this.rIdx+this.wIdx)
-	copy(buf, this.buf[this.rIdx:this.cap])
-	copy(buf[this.cap-this.rIdx:], this.buf[0:this.wIdx])
-	return
+	// 缓存满的时候 rIdx 不一定是 0，也要从 rIdx 开始拷贝
+	return bytesJoin2NewByteSlice(this.peekAll(false))
 }
 
 // READ LOCK
@@ -446,44 +554,104 @@ func (this *RingBuffer) Reset() {
 	this.RetrieveAll()
 }
 
-// READ/WRITE LOCK
+// called by inside;  non lock
 func (this *RingBuffer) retrieveAll() {
-	this.rIdx = 0
-	this.wIdx = 0
+	if this.pend > 0 {
+		// 未提交的数据留在原处
+		this.rIdx = this.wIdx
+	} else {
+		this.rIdx = 0
+		this.wIdx = 0
+	}
 	this.isEmpty = true
-	this.eprIdx = 0
+	this.eprIdx = this.rIdx
 	this.episEmpty = true
 	this.inExplore = false
+	this.readGen++
+	this.hist = 0
+	this.pruneGaps()
 }
 
-// READ/WRITE LOCK
+// 清空缓存，历史数据也一起清空
+// CONSUME LOCK
 func (this *RingBuffer) RetrieveAll() {
-	this.m.Lock()
-	defer this.m.Unlock()
+	this.m.ConsumeLock()
+	defer this.m.ConsumeUnlock()
 
 	this.retrieveAll()
 }
 
+// call Discard; len 大于缓存中的数据时消费全部数据
+//
+// Deprecated: 使用 Discard，它返回实际消费的字节数与 ErrNotEnoughData。
 func (this *RingBuffer) Retrieve(len int) {
-	this.m.Lock()
+	_, _ = this.Discard(len)
+}
 
-	if this.isEmpty || len <= 0 {
-		return
+/*
+	Discard 消费缓存开头的 n 个字节:
+	  - 数据不够 n 个字节时消费全部数据，返回实际消费的字节数与 ErrNotEnoughData;
+	  - n 是负数时不消费，返回 ErrNegativeCount。
+*/
+// CONSUME LOCK
+func (this *RingBuffer) Discard(n int) (discarded int, err error) {
+	this.m.ConsumeLock()
+	defer this.m.ConsumeUnlock()
+
+	return this.discard(n)
+}
+
+// called by inside;  non lock
+func (this *RingBuffer) discard(n int) (discarded int, err error) {
+	if n < 0 {
+		return 0, ErrNegativeCount
+	}
+	size := this.size()
+	if n > size {
+		n, err = size, ErrNotEnoughData
+	}
+	if n == 0 {
+		return 0, err
 	}
 
-	if len < this.size() {
-		this.rIdx = (this.rIdx + len) % this.cap
-		if this.wIdx == this.rIdx {
+	this.advanceRead(n)
+	return n, err
+}
+
+// advanceRead 消费读指针之后的 n 个字节；调用者保证 0 < n <= size()。
+// 保留历史数据时只移动读指针，否则读完以后把读写指针都移动到 0。
+// called by inside;  non lock
+func (this *RingBuffer) advanceRead(n int) {
+	if n < this.size() || this.history > 0 {
+		this.rIdx = (this.rIdx + n) % this.cap
+		if this.rIdx == this.wIdx {
 			this.isEmpty = true
 		}
+		this.readGen++
+		this.keepHistory(n)
 	} else {
 		this.retrieveAll()
 	}
-	this.m.Unlock()
 }
 
+// keepHistory 把刚刚消费的 n 个字节记作历史数据，最多保留 history 个字节。
+// called by inside;  non lock
+func (this *RingBuffer) keepHistory(n int) {
+	if this.history == 0 || n <= 0 {
+		return
+	}
+	this.hist += n
+	if this.hist > this.history {
+		this.hist = this.history
+	}
+}
+
+// READ LOCK
 func (this *RingBuffer) PrintRingBufferInfo() string {
-	return fmt.Sprintf("\n\tRing Buffer: \n\t\tCap: %d\n\t\tsize(can read): %d\n\t\tFreeSpace: %d\n\t\tContent: %s\n", this.cap, this.size(), this.free(), this.ReadAll2NewByteSlice())
+	this.m.RLock()
+	defer this.m.RUnlock()
+
+	return fmt.Sprintf("\n\tRing Buffer: \n\t\tCap: %d\n\t\tsize(can read): %d\n\t\tFreeSpace: %d\n\t\tContent: %s\n", this.cap, this.size(), this.free(), this.readAll2NewByteSlice())
 }
 
 // call ReadOneByte
@@ -504,49 +672,129 @@ func (this *RingBuffer) WriteByte(c byte) error {
 	...
 	ExploreSize
 	ExploreCommit/ExploreBreak
+
+	每个函数单独加锁，但是整个探索过程不是原子的；多个 goroutine 共享缓存时使用 BeginExplore。
 */
-// no thread safety guarantees
+// READ/WRITE LOCK
 func (this *RingBuffer) ExploreBegin() {
+	this.m.Lock()
+	defer this.m.Unlock()
+
+	this.exploreBegin()
+}
+
+// called by inside;  non lock
+func (this *RingBuffer) exploreBegin() {
 	this.eprIdx = this.rIdx
 	this.episEmpty = this.isEmpty
 	this.inExplore = true
 }
 
+// CONSUME LOCK
 func (this *RingBuffer) ExploreCommit() {
+	this.m.ConsumeLock()
+	defer this.m.ConsumeUnlock()
+
+	this.exploreCommit()
+}
+
+// called by inside;  non lock
+func (this *RingBuffer) exploreCommit() {
+	if this.rIdx != this.eprIdx || this.isEmpty != this.episEmpty {
+		this.readGen++
+		this.keepHistory(this.size() - this.exploreSize())
+	}
 	this.rIdx = this.eprIdx
-	if this.rIdx == this.wIdx {
+	// rIdx == wIdx 时可能是读完了，也可能是一个字节都没有探索的满缓存
+	if this.rIdx == this.wIdx && this.episEmpty {
 		this.isEmpty = true
 	}
 	this.inExplore = false
 }
 
+// READ/WRITE LOCK
 func (this *RingBuffer) ExploreBreak() {
+	this.m.Lock()
+	defer this.m.Unlock()
+
+	this.exploreBreak()
+}
+
+// called by inside;  non lock
+func (this *RingBuffer) exploreBreak() {
 	this.eprIdx = this.rIdx
 	this.episEmpty = this.isEmpty
 	this.inExplore = false
 }
 
+// 跳过超过剩下的数据时返回 ErrExploreRetrievingCrossTheLine，探索指针不动；跳过恰好全部剩下的数据是可以的。
+//
+// Deprecated: 使用 ExploreDiscard，它返回实际跳过的字节数与 ErrNotEnoughData。
+// READ/WRITE LOCK
 func (this *RingBuffer) ExploreRetrieve(len int)(err error) {
+	this.m.Lock()
+	defer this.m.Unlock()
+
 	if this.inExplore == false {
 		return ErrIsNotInExplore
 	}
+	if len <= 0 {
+		return nil
+	}
+	if len > this.exploreSize() {
+		return ErrExploreRetrievingCrossTheLine
+	}
+	_, err = this.exploreDiscard(len)
+	return
+}
 
-	if this.episEmpty || len <= 0 {
-		return
+/*
+	ExploreDiscard 把探索指针向后移动 n 个字节:
+	  - 没有 ExploreBegin 时返回 ErrIsNotInExplore;
+	  - 数据不够 n 个字节时移动到末尾，返回实际移动的字节数与 ErrNotEnoughData;
+	  - n 是负数时不移动，返回 ErrNegativeCount。
+*/
+// READ/WRITE LOCK
+func (this *RingBuffer) ExploreDiscard(n int) (discarded int, err error) {
+	this.m.Lock()
+	defer this.m.Unlock()
+
+	return this.exploreDiscard(n)
+}
+
+// called by inside;  non lock
+func (this *RingBuffer) exploreDiscard(n int) (discarded int, err error) {
+	if this.inExplore == false {
+		return 0, ErrIsNotInExplore
+	}
+	if n < 0 {
+		return 0, ErrNegativeCount
+	}
+	size := this.exploreSize()
+	if n > size {
+		n, err = size, ErrNotEnoughData
+	}
+	if n == 0 {
+		return 0, err
 	}
 
-	if len < this.ExploreSize() {
-		this.eprIdx = (this.eprIdx + len) % this.cap
-		if this.wIdx == this.eprIdx {
-			this.episEmpty = true
-		}
-	} else {
-		return ErrExploreRetrievingCrossTheLine
+	this.eprIdx = (this.eprIdx + n) % this.cap
+	if n == size {
+		this.episEmpty = true
 	}
-	return nil
+	return n, err
 }
 
+// READ/WRITE LOCK
 func (this *RingBuffer) ExploreRead(p []byte) (n int, err error) {
+	this.m.Lock()
+	defer this.m.Unlock()
+
+	return this.exploreRead(p)
+}
+
+// called by inside;  non lock
+func (this *RingBuffer) exploreRead(p []byte) (n int, err error) {
 	if this.inExplore == false {
 		return 0, ErrIsNotInExplore
 	}
@@ -590,7 +838,16 @@ func (this *RingBuffer) ExploreRead(p []byte) (n int, err error) {
 	return
 }
 
+// READ LOCK
 func (this *RingBuffer) ExploreSize() int {
+	this.m.RLock()
+	defer this.m.RUnlock()
+
+	return this.exploreSize()
+}
+
+// called by inside;  non lock
+func (this *RingBuffer) exploreSize() int {
 	if this.wIdx == this.eprIdx {
 		if this.episEmpty {
 			return 0
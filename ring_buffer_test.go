@@ -3,7 +3,9 @@ package ringbuffer
 import (
 	"bytes"
 	"encoding/binary"
+	"fmt"
 	"io"
+	"math/rand"
 	"strings"
 	"testing"
 )
@@ -603,6 +605,25 @@ func TestRingBuffer_ExploreXXX(t *testing.T) {
 
 }
 
+func TestRingBuffer_ExploreCommitFull(t *testing.T) {
+	rb := NewWithData([]byte("full"))
+
+	// 满缓存上什么都没有探索就提交，缓存应该还是满的
+	rb.ExploreBegin()
+	rb.ExploreCommit()
+	if !rb.IsFull() {
+		t.Fatalf("expect IsFull is true but got false. size=%d", rb.Size())
+	}
+
+	buf := make([]byte, 4)
+	rb.ExploreBegin()
+	_, _ = rb.ExploreRead(buf)
+	rb.ExploreCommit()
+	if !rb.IsEmpty() {
+		t.Fatalf("expect IsEmpty is true but got false. size=%d", rb.Size())
+	}
+}
+
 func TestRingBuffer_PeekUintXX(t *testing.T) {
 
 	var isUsingExplore = false
@@ -709,3 +730,295 @@ func TestAppendSpace(t *testing.T) {
 		t.Fatal(r1.buf)
 	}
 }
+
+func TestAppendSpace_Wrapped(t *testing.T) {
+	// 数据分成两段，开头的一段比扩容的空间大，只能搬移后面的一段
+	data := make([]byte, 8, 16)
+	copy(data, "cd____ab")
+	rb, err := NewWithDataAndPointer(data, 6, 2, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rb.ExploreBegin()
+	buf := make([]byte, 3)
+	_, _ = rb.ExploreRead(buf)
+
+	_, _ = rb.WriteString("efghi")
+	if rb.Capacity() != 9 || !rb.IsFull() {
+		t.Fatalf("unexpected capacity %d and size %d", rb.Capacity(), rb.Size())
+	}
+	if first, end := rb.PeekAll(false); string(first)+string(end) != "abcdefghi" {
+		t.Fatalf("unexpected content %q %q", first, end)
+	}
+	if first, end := rb.PeekAll(true); string(first)+string(end) != "defghi" {
+		t.Fatalf("unexpected explore content %q %q", first, end)
+	}
+
+	// 缓存为空时扩容，从头开始写
+	rb.RetrieveAll()
+	_, _ = rb.Write(make([]byte, 3))
+	_, _ = rb.Read(make([]byte, 3))
+	_, _ = rb.WriteString("0123456789ab")
+	if first, end := rb.PeekAll(false); string(first)+string(end) != "0123456789ab" {
+		t.Fatalf("unexpected content %q %q", first, end)
+	}
+}
+
+func TestRingBuffer_ExploreWriteAfterEnd(t *testing.T) {
+	rb := New(8)
+	_, _ = rb.WriteString("ab")
+	rb.ExploreBegin()
+	buf := make([]byte, 4)
+	_, _ = rb.ExploreRead(buf)
+	if _, err := rb.ExploreRead(buf); err != ErrIsEmpty {
+		t.Fatalf("expect ErrIsEmpty but got %v", err)
+	}
+
+	// 探索到末尾以后写入的数据可以继续探索，扩容也一样
+	_ = rb.WriteByte('c')
+	_, _ = rb.WriteString("defghijk")
+	if n, err := rb.ExploreRead(buf); n != 4 || err != nil || string(buf) != "cdef" {
+		t.Fatalf("unexpected explore read %q %v", buf[:n], err)
+	}
+	rb.ExploreCommit()
+	if first, end := rb.PeekAll(false); string(first)+string(end) != "ghijk" {
+		t.Fatalf("unexpected content %q %q", first, end)
+	}
+}
+
+// TestRingBuffer_ExploreModel 随机交替地写入、读取、探索，与一个简单的模型对比；
+// 底层数组有余量的缓存会走原地扩容，没有余量的缓存会申请新的数组。
+func TestRingBuffer_ExploreModel(t *testing.T) {
+	for seed := int64(0); seed < 200; seed++ {
+		r := rand.New(rand.NewSource(seed))
+		var rb *RingBuffer
+		if size := 1 + r.Intn(8); seed%2 == 0 {
+			rb = New(size)
+		} else {
+			rb, _ = NewWithDataAndPointer(make([]byte, size, 64), 0, 0, true)
+		}
+
+		var (
+			model []byte
+			// 探索指针相对读指针的偏移；-1 表示没有在探索
+			eoff    = -1
+			counter byte
+			ops     []string
+			// 模型中一共写入、消费过的字节数
+			written, consumed uint64
+		)
+		fail := func(format string, args ...interface{}) {
+			t.Fatalf("seed %d after %v: %s", seed, ops, fmt.Sprintf(format, args...))
+		}
+
+		for step := 0; step < 200; step++ {
+			switch op := r.Intn(6); {
+			case op <= 1:
+				n := r.Intn(12)
+				p := make([]byte, n)
+				for i := range p {
+					counter++
+					p[i] = counter
+				}
+				_, _ = rb.Write(p)
+				model = append(model, p...)
+				written += uint64(n)
+				ops = append(ops, fmt.Sprintf("write(%d)", n))
+			case eoff < 0 && op == 2:
+				n := r.Intn(8)
+				p := make([]byte, n)
+				k, _ := rb.Read(p)
+				if !bytes.Equal(p[:k], model[:k]) || (k < n && k != len(model)) {
+					fail("read %v but expect prefix of %v", p[:k], model)
+				}
+				model = model[k:]
+				consumed += uint64(k)
+				ops = append(ops, fmt.Sprintf("read(%d)", n))
+			case eoff < 0:
+				rb.ExploreBegin()
+				eoff = 0
+				ops = append(ops, "begin")
+			case op == 2:
+				n := r.Intn(8)
+				p := make([]byte, n)
+				k, _ := rb.ExploreRead(p)
+				if !bytes.Equal(p[:k], model[eoff:eoff+k]) || (k < n && eoff+k != len(model)) {
+					fail("explore read %v but expect prefix of %v", p[:k], model[eoff:])
+				}
+				eoff += k
+				ops = append(ops, fmt.Sprintf("exploreRead(%d)", n))
+			case op == 3:
+				n := r.Intn(8)
+				k, err := rb.ExploreDiscard(n)
+				if rest := len(model) - eoff; (n <= rest && (k != n || err != nil)) || (n > rest && (k != rest || err != ErrNotEnoughData)) {
+					fail("explore discard %d: %d %v", n, k, err)
+				}
+				eoff += k
+				ops = append(ops, fmt.Sprintf("exploreDiscard(%d)", n))
+			case op == 4:
+				rb.ExploreCommit()
+				model = model[eoff:]
+				consumed += uint64(eoff)
+				eoff = -1
+				ops = append(ops, "commit")
+			default:
+				rb.ExploreBreak()
+				eoff = -1
+				ops = append(ops, "break")
+			}
+
+			if rb.Size() != len(model) {
+				fail("size %d but expect %d", rb.Size(), len(model))
+			}
+			if rb.ReadOffset() != consumed || rb.WriteOffset() != written {
+				fail("offsets %d/%d but expect %d/%d", rb.ReadOffset(), rb.WriteOffset(), consumed, written)
+			}
+			if first, end := rb.PeekAll(false); !bytes.Equal(bytesJoin2NewByteSlice(first, end), model) {
+				fail("content %v %v but expect %v", first, end, model)
+			}
+			if eoff >= 0 {
+				if rb.ExploreSize() != len(model)-eoff {
+					fail("explore size %d but expect %d", rb.ExploreSize(), len(model)-eoff)
+				}
+				if first, end := rb.PeekAll(true); !bytes.Equal(bytesJoin2NewByteSlice(first, end), model[eoff:]) {
+					fail("explore content %v %v but expect %v", first, end, model[eoff:])
+				}
+			}
+		}
+	}
+}
+
+func TestRingBuffer_Discard(t *testing.T) {
+	rb := New(4)
+	_, _ = rb.Write(make([]byte, 3))
+	_, _ = rb.Read(make([]byte, 3))
+	_, _ = rb.WriteString("abcd")
+
+	if n, err := rb.Discard(-1); n != 0 || err != ErrNegativeCount {
+		t.Fatalf("expect ErrNegativeCount but got %d %v", n, err)
+	}
+	if n, err := rb.Discard(2); n != 2 || err != nil {
+		t.Fatalf("unexpected discard %d %v", n, err)
+	}
+	if b, _ := rb.ReadByte(); b != 'c' {
+		t.Fatalf("expect c but got %c", b)
+	}
+	if n, err := rb.Discard(5); n != 1 || err != ErrNotEnoughData || !rb.IsEmpty() {
+		t.Fatalf("expect all discarded with ErrNotEnoughData but got %d %v", n, err)
+	}
+	if n, err := rb.Discard(1); n != 0 || err != ErrNotEnoughData {
+		t.Fatalf("expect ErrNotEnoughData but got %d %v", n, err)
+	}
+	if n, err := rb.Discard(0); n != 0 || err != nil {
+		t.Fatalf("unexpected discard %d %v", n, err)
+	}
+
+	// 旧的 Retrieve 消费全部数据，不返回错误
+	_, _ = rb.WriteString("ab")
+	rb.Retrieve(3)
+	if !rb.IsEmpty() {
+		t.Fatalf("expect empty but got size %d", rb.Size())
+	}
+}
+
+func TestRingBuffer_ExploreDiscard(t *testing.T) {
+	rb := New(8)
+	if _, err := rb.ExploreDiscard(1); err != ErrIsNotInExplore {
+		t.Fatalf("expect ErrIsNotInExplore but got %v", err)
+	}
+	_, _ = rb.WriteString("abcd")
+
+	// 恰好跳过剩下的全部数据
+	rb.ExploreBegin()
+	if err := rb.ExploreRetrieve(4); err != nil || rb.ExploreSize() != 0 {
+		t.Fatalf("unexpected explore retrieve %v %d", err, rb.ExploreSize())
+	}
+	rb.ExploreCommit()
+	if !rb.IsEmpty() {
+		t.Fatalf("expect empty but got size %d", rb.Size())
+	}
+
+	_, _ = rb.WriteString("abcd")
+	rb.ExploreBegin()
+	if err := rb.ExploreRetrieve(5); err != ErrExploreRetrievingCrossTheLine || rb.ExploreSize() != 4 {
+		t.Fatalf("expect ErrExploreRetrievingCrossTheLine but got %v %d", err, rb.ExploreSize())
+	}
+	if n, err := rb.ExploreDiscard(-1); n != 0 || err != ErrNegativeCount {
+		t.Fatalf("expect ErrNegativeCount but got %d %v", n, err)
+	}
+	if n, err := rb.ExploreDiscard(1); n != 1 || err != nil {
+		t.Fatalf("unexpected explore discard %d %v", n, err)
+	}
+	if n, err := rb.ExploreDiscard(5); n != 3 || err != ErrNotEnoughData {
+		t.Fatalf("expect ErrNotEnoughData but got %d %v", n, err)
+	}
+	rb.ExploreBreak()
+	if rb.Size() != 4 {
+		t.Fatalf("break should not consume; got size %d", rb.Size())
+	}
+}
+
+func TestRingBuffer_PeekTyped(t *testing.T) {
+	rb := New(8)
+	_, _ = rb.Write(make([]byte, 5))
+	_, _ = rb.Read(make([]byte, 5))
+	// 数据跨越缓存的尾部
+	_, _ = rb.Write([]byte{1, 2, 3, 4, 5, 6, 7, 8})
+
+	if v, err := rb.PeekByte(false); v != 1 || err != nil {
+		t.Fatalf("unexpected %d %v", v, err)
+	}
+	if v, err := rb.PeekUint16BE(false); v != 0x0102 || err != nil {
+		t.Fatalf("unexpected %x %v", v, err)
+	}
+	if v, err := rb.PeekUint16LE(false); v != 0x0201 || err != nil {
+		t.Fatalf("unexpected %x %v", v, err)
+	}
+	if v, err := rb.PeekUint32BE(false); v != 0x01020304 || err != nil {
+		t.Fatalf("unexpected %x %v", v, err)
+	}
+	if v, err := rb.PeekUint32LE(false); v != 0x04030201 || err != nil {
+		t.Fatalf("unexpected %x %v", v, err)
+	}
+	if v, err := rb.PeekUint64BE(false); v != 0x0102030405060708 || err != nil {
+		t.Fatalf("unexpected %x %v", v, err)
+	}
+	if v, err := rb.PeekUint64LE(false); v != 0x0807060504030201 || err != nil {
+		t.Fatalf("unexpected %x %v", v, err)
+	}
+
+	rb.ExploreBegin()
+	_, _ = rb.ExploreDiscard(5)
+	if v, err := rb.PeekUint16BE(true); v != 0x0607 || err != nil {
+		t.Fatalf("unexpected %x %v", v, err)
+	}
+	if v, err := rb.PeekUint32LE(true); v != 0 || err != ErrNotEnoughData {
+		t.Fatalf("expect ErrNotEnoughData but got %x %v", v, err)
+	}
+	// 旧的函数数据不够时返回 0
+	if rb.PeekUint32(true) != 0 || rb.PeekUint16(true) != 0x0607 {
+		t.Fatal("unexpected deprecated peek")
+	}
+	rb.ExploreBreak()
+
+	rb.RetrieveAll()
+	if v, err := rb.PeekByte(false); v != 0 || err != ErrNotEnoughData {
+		t.Fatalf("expect ErrNotEnoughData but got %d %v", v, err)
+	}
+}
+
+func TestRingBuffer_ReadAll2NewByteSliceFull(t *testing.T) {
+	rb := New(4)
+	_, _ = rb.Write(make([]byte, 3))
+	_, _ = rb.Read(make([]byte, 3))
+	_, _ = rb.WriteString("abcd")
+	if !rb.IsFull() {
+		t.Fatal("should full")
+	}
+	if got := string(rb.ReadAll2NewByteSlice()); got != "abcd" {
+		t.Fatalf("expect abcd but got %q", got)
+	}
+	if rb.Size() != 4 {
+		t.Fatalf("should not consume; got size %d", rb.Size())
+	}
+}
@@ -0,0 +1,147 @@
+package sniff
+
+import (
+	"strings"
+
+	"github.com/zput/ringbuffer"
+	"github.com/zput/ringbuffer/codec"
+	"github.com/zput/ringbuffer/tlsframe"
+)
+
+// Result 是 Matcher 的判断结果。
+type Result int
+
+const (
+	// NoMatch 已经确定不是这个协议。
+	NoMatch Result = iota
+	// Match 已经确定是这个协议。
+	Match
+	// NeedMore 已有的数据还不能确定，需要等待更多数据。
+	NeedMore
+)
+
+func (r Result) String() string {
+	switch r {
+	case NoMatch:
+		return "NoMatch"
+	case Match:
+		return "Match"
+	case NeedMore:
+		return "NeedMore"
+	}
+	return "Unknown"
+}
+
+// Matcher 通过 Peek 检查连接开头的数据；不能消费缓存中的数据，也不能修改它们。
+type Matcher func(rb *ringbuffer.RingBuffer) Result
+
+// Any 匹配所有的连接，通常注册在最后作为默认的处理。
+func Any() Matcher {
+	return func(rb *ringbuffer.RingBuffer) Result {
+		return Match
+	}
+}
+
+// Prefix 匹配以 prefixes 中任意一个开头的连接。
+func Prefix(prefixes ...string) Matcher {
+	maxLength := 0
+	for _, p := range prefixes {
+		if len(p) > maxLength {
+			maxLength = len(p)
+		}
+	}
+	return func(rb *ringbuffer.RingBuffer) Result {
+		data := peek(rb, maxLength)
+		result := NoMatch
+		for _, p := range prefixes {
+			if len(data) >= len(p) {
+				if string(data[:len(p)]) == p {
+					return Match
+				}
+			} else if string(data) == p[:len(data)] {
+				result = NeedMore
+			}
+		}
+		return result
+	}
+}
+
+// http1Methods 是 RFC 7231 与 RFC 5789 中定义的方法。
+var http1Methods = []string{
+	"GET ", "HEAD ", "POST ", "PUT ", "DELETE ", "CONNECT ", "OPTIONS ", "TRACE ", "PATCH ",
+}
+
+// HTTP1 匹配以常见的 HTTP/1.x 方法开头的连接。
+func HTTP1() Matcher {
+	return Prefix(http1Methods...)
+}
+
+// http2Preface 是 HTTP/2 prior knowledge 连接的前言，见 RFC 7540 3.5。
+const http2Preface = "PRI * HTTP/2.0\r\n\r\nSM\r\n\r\n"
+
+// HTTP2 匹配以 HTTP/2 连接前言开头的连接(不经过 Upgrade 的 h2c)。
+func HTTP2() Matcher {
+	return Prefix(http2Preface)
+}
+
+// TLS 匹配以 ClientHello 开头的连接：handshake 记录，版本 3.x，第一个握手消息是 ClientHello。
+// 只检查前 6 个字节，不等待整个 ClientHello。
+func TLS() Matcher {
+	return func(rb *ringbuffer.RingBuffer) Result {
+		data := peek(rb, tlsframe.RecordHeaderLength+1)
+		expect := [...]struct {
+			off int
+			b   byte
+		}{{0, byte(tlsframe.Handshake)}, {1, 3}, {tlsframe.RecordHeaderLength, 1}}
+		for _, e := range expect {
+			if len(data) <= e.off {
+				return NeedMore
+			}
+			if data[e.off] != e.b {
+				return NoMatch
+			}
+		}
+		return Match
+	}
+}
+
+// TLSServerName 匹配 ClientHello 中的 SNI 是 names 之一的 TLS 连接(不区分大小写)；
+// "*.example.com" 匹配 example.com 的一级子域名。需要等待整个 ClientHello 到达。
+func TLSServerName(names ...string) Matcher {
+	return func(rb *ringbuffer.RingBuffer) Result {
+		hello, err := tlsframe.SniffClientHello(rb)
+		if err == codec.ErrNeedMoreData {
+			return NeedMore
+		}
+		if err != nil {
+			return NoMatch
+		}
+		for _, name := range names {
+			if matchServerName(name, hello.ServerName) {
+				return Match
+			}
+		}
+		return NoMatch
+	}
+}
+
+func matchServerName(pattern, serverName string) bool {
+	if serverName == "" {
+		return false
+	}
+	if !strings.HasPrefix(pattern, "*.") {
+		return strings.EqualFold(pattern, serverName)
+	}
+	suffix := pattern[1:]
+	label := len(serverName) - len(suffix)
+	return label > 0 && strings.EqualFold(serverName[label:], suffix) && !strings.Contains(serverName[:label], ".")
+}
+
+// peek 返回 rb 开头最多 n 个字节；跨越缓存尾部时拷贝到一个新的切片中。
+func peek(rb *ringbuffer.RingBuffer, n int) []byte {
+	first, end := rb.Peek(n, false)
+	if len(end) == 0 {
+		return first
+	}
+	return append(append(make([]byte, 0, len(first)+len(end)), first...), end...)
+}
@@ -0,0 +1,221 @@
+/*
+Package sniff 在同一个端口上服务多种协议(类似 cmux)：
+
+	m := sniff.New(l)
+	h2 := m.Match(sniff.HTTP2())
+	h1 := m.Match(sniff.HTTP1())
+	tls := m.Match(sniff.TLS())
+	other := m.Match(sniff.Any())
+	go m.Serve()
+
+每个新连接读到的数据先保存在 ringbuffer.Conn 的输入缓存中，Matcher 通过 Peek 检查开头的字节，
+数据不够时继续从 socket 读取；连接交给第一个匹配的 Listener，已经读到的数据原样保留，
+之后的 Read 先返回这些数据。
+*/
+package sniff
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/zput/ringbuffer"
+)
+
+const (
+	// DefaultReadTimeout 是嗅探阶段的默认超时：超过这个时间还不能确定协议的连接会被关闭。
+	DefaultReadTimeout = 10 * time.Second
+	// DefaultMaxSniffBytes 是嗅探阶段默认最多缓存的字节数，足够容纳一个 ClientHello 记录。
+	DefaultMaxSniffBytes = 16*1024 + 5
+)
+
+// 所有的 Matcher 都不匹配；连接已经被关闭。
+var ErrNoMatch = errors.New("no matcher matched the connection; sniff")
+
+// 缓存的数据超过了 MaxSniffBytes 还不能确定协议；连接已经被关闭。
+var ErrSniffTooLarge = errors.New("sniffed data exceeds the limit; sniff")
+
+var ErrListenerClosed = errors.New("listener is closed; sniff")
+
+// Conn 是交给 Listener 的连接：Read 先返回嗅探时缓存的数据，Write 直接写到 socket。
+// 可以通过 Inbound 直接解析缓存中的数据。
+type Conn struct {
+	*ringbuffer.Conn
+}
+
+// Write 不经过输出缓存，直接写到 socket。
+func (c *Conn) Write(p []byte) (int, error) {
+	return c.Conn.Conn.Write(p)
+}
+
+// Mux 接受 root 上的连接，按照注册的顺序把连接分发给第一个匹配的 Listener。
+type Mux struct {
+	// 嗅探阶段的总超时，<= 0 时不超时；连接分发以后会清除 read deadline
+	ReadTimeout time.Duration
+	// 嗅探阶段最多缓存的字节数
+	MaxSniffBytes int
+	// ringbuffer.Conn 的 bufferSize，<= 0 时使用 ringbuffer.DefaultConnBufferSize
+	BufferSize int
+	// 嗅探失败(超时、不匹配等)时调用，此时连接已经被关闭；可以为 nil
+	ErrorHandler func(conn net.Conn, err error)
+
+	root      net.Listener
+	routes    []route
+	donec     chan struct{}
+	closeOnce sync.Once
+}
+
+type route struct {
+	matchers []Matcher
+	l        *listener
+}
+
+// New 返回一个使用默认限制的 Mux。
+func New(root net.Listener) *Mux {
+	return &Mux{
+		ReadTimeout:   DefaultReadTimeout,
+		MaxSniffBytes: DefaultMaxSniffBytes,
+		root:          root,
+		donec:         make(chan struct{}),
+	}
+}
+
+// Match 注册一组 Matcher，返回接收匹配连接的 Listener；任意一个 Matcher 匹配即可。
+// 必须在 Serve 之前调用。
+func (m *Mux) Match(matchers ...Matcher) net.Listener {
+	l := &listener{
+		addr:   m.root.Addr(),
+		connc:  make(chan net.Conn),
+		closec: make(chan struct{}),
+		donec:  m.donec,
+	}
+	m.routes = append(m.routes, route{matchers: matchers, l: l})
+	return l
+}
+
+// Serve 不断接受 root 上的连接，每个连接在单独的 goroutine 中嗅探；
+// root.Accept 出错时(例如调用了 Close)关闭所有的 Listener 并返回这个错误。
+func (m *Mux) Serve() error {
+	defer m.closeListeners()
+	for {
+		c, err := m.root.Accept()
+		if err != nil {
+			return err
+		}
+		go m.serve(c)
+	}
+}
+
+// Close 关闭 root 以及所有的 Listener。
+func (m *Mux) Close() error {
+	m.closeListeners()
+	return m.root.Close()
+}
+
+func (m *Mux) closeListeners() {
+	m.closeOnce.Do(func() {
+		close(m.donec)
+	})
+}
+
+func (m *Mux) serve(c net.Conn) {
+	conn := &Conn{ringbuffer.NewConn(c, m.BufferSize, 0)}
+	if m.ReadTimeout > 0 {
+		_ = c.SetReadDeadline(time.Now().Add(m.ReadTimeout))
+	}
+	l, err := m.sniff(conn)
+	if err != nil {
+		_ = c.Close()
+		if m.ErrorHandler != nil {
+			m.ErrorHandler(c, err)
+		}
+		return
+	}
+	if m.ReadTimeout > 0 {
+		_ = c.SetReadDeadline(time.Time{})
+	}
+	l.deliver(conn)
+}
+
+// sniff 不断从 socket 读取数据，直到可以确定连接属于哪一个 Listener。
+func (m *Mux) sniff(conn *Conn) (*listener, error) {
+	inbound := conn.Inbound()
+	for {
+		l, result := m.match(inbound)
+		switch result {
+		case Match:
+			return l, nil
+		case NoMatch:
+			return nil, ErrNoMatch
+		}
+		if m.MaxSniffBytes > 0 && inbound.Size() >= m.MaxSniffBytes {
+			return nil, ErrSniffTooLarge
+		}
+		if _, err := conn.Fill(); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// match 按照注册的顺序检查：前面的规则还需要更多数据时，即使后面的规则已经匹配也要等待，
+// 这样分发的结果与数据分几次到达无关。
+func (m *Mux) match(rb *ringbuffer.RingBuffer) (*listener, Result) {
+	for _, r := range m.routes {
+		result := NoMatch
+		for _, matcher := range r.matchers {
+			switch matcher(rb) {
+			case Match:
+				return r.l, Match
+			case NeedMore:
+				result = NeedMore
+			}
+		}
+		if result == NeedMore {
+			return nil, NeedMore
+		}
+	}
+	return nil, NoMatch
+}
+
+// listener 是 Match 返回的 net.Listener；关闭它不会影响 root 以及其他的 Listener。
+type listener struct {
+	addr      net.Addr
+	connc     chan net.Conn
+	closec    chan struct{}
+	donec     <-chan struct{}
+	closeOnce sync.Once
+}
+
+func (l *listener) Accept() (net.Conn, error) {
+	select {
+	case c := <-l.connc:
+		return c, nil
+	case <-l.closec:
+		return nil, ErrListenerClosed
+	case <-l.donec:
+		return nil, ErrListenerClosed
+	}
+}
+
+func (l *listener) Close() error {
+	l.closeOnce.Do(func() {
+		close(l.closec)
+	})
+	return nil
+}
+
+func (l *listener) Addr() net.Addr {
+	return l.addr
+}
+
+// deliver 等待 Accept 取走连接；Listener 已经关闭时关闭连接。
+func (l *listener) deliver(c net.Conn) {
+	select {
+	case l.connc <- c:
+	case <-l.closec:
+		_ = c.Close()
+	case <-l.donec:
+		_ = c.Close()
+	}
+}
@@ -0,0 +1,258 @@
+package sniff
+
+import (
+	"crypto/tls"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/zput/ringbuffer"
+)
+
+// feed 一个字节一个字节地写入(经过缓存的尾部)，返回每一步 Matcher 的结果。
+func feed(m Matcher, data string) []Result {
+	rb := ringbuffer.New(16)
+	_, _ = rb.Write(make([]byte, 12))
+	_, _ = rb.Read(make([]byte, 12))
+
+	results := []Result{m(rb)}
+	for i := 0; i < len(data); i++ {
+		_ = rb.WriteOneByte(data[i])
+		results = append(results, m(rb))
+	}
+	if rb.Size() != len(data) {
+		panic("matcher consumed data")
+	}
+	return results
+}
+
+func TestMatchers(t *testing.T) {
+	cases := []struct {
+		name    string
+		matcher Matcher
+		data    string
+		expect  Result
+		decided int // 在第几个字节确定结果
+	}{
+		{"http1", HTTP1(), "GET / HTTP/1.1\r\n", Match, 4},
+		{"http1 options", HTTP1(), "OPTIONS * HTTP/1.1\r\n", Match, 8},
+		{"http1 lower case", HTTP1(), "get / HTTP/1.1\r\n", NoMatch, 1},
+		{"http1 h2 preface", HTTP1(), http2Preface, NoMatch, 2},
+		{"http2", HTTP2(), http2Preface + "\x00\x00", Match, len(http2Preface)},
+		{"http2 http1", HTTP2(), "PUT / HTTP/1.1\r\n", NoMatch, 2},
+		{"tls", TLS(), "\x16\x03\x01\x02\x00\x01\x00", Match, 6},
+		{"tls alert", TLS(), "\x15\x03\x01\x00\x02", NoMatch, 1},
+		{"tls ssl2", TLS(), "\x16\x02\x00", NoMatch, 2},
+		{"tls server hello", TLS(), "\x16\x03\x03\x00\x40\x02", NoMatch, 6},
+		{"prefix", Prefix("\x00BIN", "\x00BOX"), "\x00BOXdata", Match, 4},
+		{"prefix mismatch", Prefix("\x00BIN", "\x00BOX"), "\x00BAD", NoMatch, 3},
+		{"any", Any(), "", Match, 0},
+	}
+	for _, c := range cases {
+		results := feed(c.matcher, c.data)
+		for i, r := range results {
+			expect := NeedMore
+			if i >= c.decided {
+				expect = c.expect
+			}
+			if r != expect {
+				t.Fatalf("%s: at %d expect %v but got %v", c.name, i, expect, r)
+			}
+		}
+	}
+}
+
+func TestTLSServerName(t *testing.T) {
+	client, server := net.Pipe()
+	defer server.Close()
+	go func() {
+		_ = tls.Client(client, &tls.Config{ServerName: "api.example.com", InsecureSkipVerify: true}).Handshake()
+		_ = client.Close()
+	}()
+	conn := ringbuffer.NewConn(server, 0, 0)
+
+	m := TLSServerName("www.example.com", "*.EXAMPLE.com")
+	other := TLSServerName("example.com", "*.api.example.com")
+	for {
+		if _, err := conn.Fill(); err != nil {
+			t.Fatal(err)
+		}
+		r := m(conn.Inbound())
+		if r == NeedMore {
+			continue
+		}
+		if r != Match {
+			t.Fatalf("expect Match but got %v", r)
+		}
+		break
+	}
+	if r := other(conn.Inbound()); r != NoMatch {
+		t.Fatalf("expect NoMatch but got %v", r)
+	}
+	if r := m(ringbuffer.NewWithData([]byte("GET / HTTP/1.1\r\n"))); r != NoMatch {
+		t.Fatalf("expect NoMatch but got %v", r)
+	}
+}
+
+// startMux 在 127.0.0.1 上启动一个 Mux；每个 Listener 收到的连接回复 tag 以及读到的前 n 个字节。
+func startMux(t *testing.T, m func(l net.Listener) *Mux, routes map[string][]Matcher, order []string, n int) (*Mux, string) {
+	root, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mux := m(root)
+	for _, tag := range order {
+		go func(tag string, l net.Listener) {
+			for {
+				c, err := l.Accept()
+				if err != nil {
+					return
+				}
+				go func() {
+					defer c.Close()
+					buf := make([]byte, n)
+					if _, err := io.ReadFull(c, buf); err != nil {
+						return
+					}
+					_, _ = c.Write(append([]byte(tag+":"), buf...))
+				}()
+			}
+		}(tag, mux.Match(routes[tag]...))
+	}
+	go func() {
+		_ = mux.Serve()
+	}()
+	return mux, root.Addr().String()
+}
+
+// roundTrip 分成多次发送 parts，返回收到的全部回复。
+func roundTrip(t *testing.T, addr string, parts ...string) string {
+	c, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	for _, p := range parts {
+		if _, err := c.Write([]byte(p)); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	_ = c.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var reply []byte
+	buf := make([]byte, 256)
+	for {
+		n, err := c.Read(buf)
+		reply = append(reply, buf[:n]...)
+		if err != nil {
+			return string(reply)
+		}
+	}
+}
+
+func TestMux(t *testing.T) {
+	const n = 24
+	routes := map[string][]Matcher{
+		"h2":   {HTTP2()},
+		"h1":   {HTTP1()},
+		"tls":  {TLS()},
+		"bin":  {Prefix("\x00BIN")},
+		"long": {Prefix("LONGER")},
+		"lo":   {Prefix("LO")},
+	}
+	errc := make(chan error, 1)
+	mux, addr := startMux(t, func(l net.Listener) *Mux {
+		m := New(l)
+		m.ErrorHandler = func(conn net.Conn, err error) {
+			errc <- err
+		}
+		return m
+	}, routes, []string{"h2", "h1", "tls", "bin", "long", "lo"}, n)
+	defer mux.Close()
+
+	pad := func(s string) string {
+		for len(s) < n {
+			s += "."
+		}
+		return s
+	}
+	cases := []struct {
+		parts  []string
+		expect string
+	}{
+		{[]string{"PRI * HTTP/2", pad(".0\r\n\r\nSM\r\n\r\n")}, "h2"},
+		{[]string{"P", "O", pad("ST /upload HTTP/1.1\r\n")}, "h1"},
+		{[]string{"\x16\x03", pad("\x01\x00\xc8\x01")}, "tls"},
+		{[]string{pad("\x00BIN")}, "bin"},
+		// 前面的规则还需要更多数据时等待，不会被后面的规则抢走
+		{[]string{"LO", pad("NGER")}, "long"},
+		{[]string{"LO", pad("NG")}, "lo"},
+	}
+	for _, c := range cases {
+		data := ""
+		for _, p := range c.parts {
+			data += p
+		}
+		if got, expect := roundTrip(t, addr, c.parts...), c.expect+":"+data[:n]; got != expect {
+			t.Fatalf("expect %q but got %q", expect, got)
+		}
+	}
+
+	if got := roundTrip(t, addr, "SSH-2.0-OpenSSH\r\n"); got != "" {
+		t.Fatalf("expect connection closed but got %q", got)
+	}
+	if err := <-errc; err != ErrNoMatch {
+		t.Fatalf("expect ErrNoMatch but got %v", err)
+	}
+}
+
+func TestMux_Timeout(t *testing.T) {
+	errc := make(chan error, 1)
+	mux, addr := startMux(t, func(l net.Listener) *Mux {
+		m := New(l)
+		m.ReadTimeout = 50 * time.Millisecond
+		m.MaxSniffBytes = 8
+		m.ErrorHandler = func(conn net.Conn, err error) {
+			errc <- err
+		}
+		return m
+	}, map[string][]Matcher{"h2": {HTTP2()}}, []string{"h2"}, 1)
+	defer mux.Close()
+
+	// 对端一直不发送足够的数据
+	if got := roundTrip(t, addr, "PRI"); got != "" {
+		t.Fatalf("expect connection closed but got %q", got)
+	}
+	err := <-errc
+	if ne, ok := err.(net.Error); !ok || !ne.Timeout() {
+		t.Fatalf("expect timeout but got %v", err)
+	}
+
+	if got := roundTrip(t, addr, "PRI * HTTP/2.0"); got != "" {
+		t.Fatalf("expect connection closed but got %q", got)
+	}
+	if err = <-errc; err != ErrSniffTooLarge {
+		t.Fatalf("expect ErrSniffTooLarge but got %v", err)
+	}
+}
+
+func TestMux_Close(t *testing.T) {
+	root, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mux := New(root)
+	l := mux.Match(Any())
+	served := make(chan error, 1)
+	go func() {
+		served <- mux.Serve()
+	}()
+	_ = mux.Close()
+	if err := <-served; err == nil {
+		t.Fatal("expect Serve to return the accept error")
+	}
+	if _, err := l.Accept(); err != ErrListenerClosed {
+		t.Fatalf("expect ErrListenerClosed but got %v", err)
+	}
+}
@@ -0,0 +1,317 @@
+/*
+Package sse 从 RingBuffer 中逐个取出 Server-Sent Events 事件，
+解析规则见 https://html.spec.whatwg.org/multipage/server-sent-events.html#event-stream-interpretation ：
+
+  - 行以 "\r\n"、"\n" 或者单独的 "\r" 结尾，空行表示一个事件结束；
+  - 以 ":" 开头的行是注释；
+  - "field: value" 中冒号后面的第一个空格会被去掉，没有冒号时整行都是字段名，值为空；
+  - 多个 data 字段用 "\n" 连接；没有 data 字段的事件不会被分发，但是其中的 id/retry 仍然生效。
+*/
+package sse
+
+import (
+	"errors"
+	"time"
+
+	"github.com/zput/ringbuffer"
+	"github.com/zput/ringbuffer/codec"
+)
+
+const bom = "\xef\xbb\xbf"
+
+// DefaultMaxEventSize 是一个事件(包括所有的行与结尾的空行)默认的最大长度。
+const DefaultMaxEventSize = 1 << 20
+
+// 事件超过了 MaxEventSize；这个事件已经被丢弃，之后继续正常解码。
+var ErrEventTooLarge = errors.New("event exceeds the limit; sse")
+
+// Event 是一个分发的事件。
+type Event struct {
+	// event 字段，没有时为 "message"
+	Type string
+	// 所有 data 字段用 "\n" 连接的结果；连续的内存，可以直接交给 json.Unmarshal，
+	// 只在下一次调用 Next 之前有效
+	Data []byte
+	// 分发时的 last event ID
+	ID string
+}
+
+/*
+Decoder 保存了 last event ID、retry 与扫描状态，一个 Decoder 只能用于一个事件流。
+no thread safety guarantees; 内部使用 rb 的 explore 游标
+*/
+type Decoder struct {
+	MaxEventSize int
+
+	// LastEventID 是最近一个 id 字段的值，重连时放在 Last-Event-ID 请求头中
+	LastEventID string
+	// Retry 是最近一个 retry 字段指定的重连时间，没有收到时为 0
+	Retry time.Duration
+
+	started    bool // 已经处理过流开头的 BOM
+	skipLF     bool // 上一行以单独的 "\r" 结尾，下一个字节如果是 "\n" 需要跳过
+	discarding bool // 正在丢弃过长的事件
+	lineEmpty  bool // 丢弃时，当前行还没有任何字符
+	scanned    int  // explore 游标之后已经扫描过的完整行的长度
+	raw        []byte
+	data       []byte
+
+	scannedRB *ringbuffer.RingBuffer // scanned 所属的缓存
+	scannedAt uint64                 // 扫描时缓存的 ReadOffset()，explore 游标就在读指针处
+}
+
+// NewDecoder 返回一个 Decoder；maxEventSize <= 0 时使用 DefaultMaxEventSize。
+func NewDecoder(maxEventSize int) *Decoder {
+	if maxEventSize <= 0 {
+		maxEventSize = DefaultMaxEventSize
+	}
+	return &Decoder{MaxEventSize: maxEventSize}
+}
+
+/*
+Next 取出下一个需要分发的事件，并消费它以及它之前没有 data 的事件。
+
+事件不完整时返回 codec.ErrNeedMoreData，不完整的事件原样留在缓存中；
+返回 ErrEventTooLarge 时过长的数据已经被丢弃(还没有到达的部分会在之后的调用中丢弃)。
+*/
+func (d *Decoder) Next(rb *ringbuffer.RingBuffer) (*Event, error) {
+	for {
+		if err := d.skip(rb); err != nil {
+			return nil, err
+		}
+
+		rb.ExploreBegin()
+		n, cr, err := d.scan(rb)
+		if err == codec.ErrNeedMoreData && rb.ExploreSize() > d.MaxEventSize {
+			err = ErrEventTooLarge
+			d.discarding = true
+			d.lineEmpty = true
+		}
+		if err == nil && n > d.MaxEventSize {
+			err = ErrEventTooLarge
+			rb.ExploreBreak()
+			_, _ = rb.Discard(n)
+			d.scanned = 0
+			d.skipLF = cr
+			return nil, err
+		}
+		if err != nil {
+			rb.ExploreBreak()
+			if err == ErrEventTooLarge {
+				d.scanned = 0
+				d.discard(rb)
+			}
+			return nil, err
+		}
+
+		if cap(d.raw) < n {
+			d.raw = make([]byte, n)
+		}
+		d.raw = d.raw[:n]
+		if _, err = rb.ExploreRead(d.raw); err != nil {
+			rb.ExploreBreak()
+			return nil, err
+		}
+		rb.ExploreCommit()
+		d.scanned = 0
+		d.skipLF = cr
+
+		if event := d.parse(d.raw); event != nil {
+			return event, nil
+		}
+	}
+}
+
+// skip 处理流开头的 BOM、上一个事件结尾的 "\r\n" 以及丢弃过长的事件，直接消费数据。
+func (d *Decoder) skip(rb *ringbuffer.RingBuffer) error {
+	if !d.started {
+		first, end := rb.Peek(len(bom), false)
+		b := append(append([]byte(nil), first...), end...)
+		for i := range b {
+			if b[i] != bom[i] {
+				d.started = true
+				break
+			}
+		}
+		if !d.started {
+			if len(b) < len(bom) {
+				return codec.ErrNeedMoreData
+			}
+			_, _ = rb.Discard(len(bom))
+			d.started = true
+		}
+	}
+	if d.discarding && !d.discard(rb) {
+		return codec.ErrNeedMoreData
+	}
+	if d.skipLF {
+		first, _ := rb.Peek(1, false)
+		if len(first) == 0 {
+			return codec.ErrNeedMoreData
+		}
+		if first[0] == '\n' {
+			_, _ = rb.Discard(1)
+		}
+		d.skipLF = false
+	}
+	return nil
+}
+
+// discard 逐个字节地丢弃过长的事件，直到事件结尾的空行；返回是否已经丢弃完。
+func (d *Decoder) discard(rb *ringbuffer.RingBuffer) bool {
+	first, end := rb.PeekAll(false)
+	n := 0
+	for _, segment := range [][]byte{first, end} {
+		for _, c := range segment {
+			n++
+			if d.skipLF {
+				d.skipLF = false
+				if c == '\n' {
+					continue
+				}
+			}
+			if c != '\r' && c != '\n' {
+				d.lineEmpty = false
+				continue
+			}
+			d.skipLF = c == '\r'
+			if d.lineEmpty {
+				d.discarding = false
+				_, _ = rb.Discard(n)
+				return true
+			}
+			d.lineEmpty = true
+		}
+	}
+	_, _ = rb.Discard(n)
+	return false
+}
+
+// scan 从 explore 游标开始查找事件结尾的空行，返回事件的长度(包括空行)；
+// cr 表示空行是缓存末尾单独的 "\r"，后面可能还有属于它的 "\n"。
+func (d *Decoder) scan(rb *ringbuffer.RingBuffer) (n int, cr bool, err error) {
+	first, end := rb.PeekAll(true)
+	total := len(first) + len(end)
+	at := func(i int) byte {
+		if i < len(first) {
+			return first[i]
+		}
+		return end[i-len(first)]
+	}
+	if rb != d.scannedRB || rb.ReadOffset() != d.scannedAt || d.scanned > total {
+		// 换了缓存，或者数据被其他地方消费了，之前的扫描结果已经无效
+		d.scanned = 0
+	}
+	d.scannedRB, d.scannedAt = rb, rb.ReadOffset()
+
+	lineStart := d.scanned
+	for i := lineStart; i < total; i++ {
+		c := at(i)
+		if c != '\r' && c != '\n' {
+			continue
+		}
+		next := i + 1
+		if c == '\r' {
+			if next == total {
+				// 单独的 "\r" 结尾的空行已经可以分发；其他的行需要更多数据才能判断是 "\r" 还是 "\r\n"
+				if i == lineStart {
+					return next, true, nil
+				}
+				break
+			}
+			if at(next) == '\n' {
+				next++
+			}
+		}
+		if i == lineStart {
+			return next, false, nil
+		}
+		lineStart = next
+		i = next - 1
+	}
+	d.scanned = lineStart
+	return 0, false, codec.ErrNeedMoreData
+}
+
+// parse 解析一个完整的事件，没有 data 字段时返回 nil。
+func (d *Decoder) parse(raw []byte) *Event {
+	d.data = d.data[:0]
+	hasData := false
+	eventType := ""
+
+	for len(raw) > 0 {
+		i := 0
+		for i < len(raw) && raw[i] != '\r' && raw[i] != '\n' {
+			i++
+		}
+		line := raw[:i]
+		if i < len(raw) && raw[i] == '\r' && i+1 < len(raw) && raw[i+1] == '\n' {
+			i++
+		}
+		raw = raw[i+1:]
+
+		if len(line) == 0 || line[0] == ':' {
+			continue
+		}
+		field, value := line, []byte(nil)
+		for j, c := range line {
+			if c == ':' {
+				field, value = line[:j], line[j+1:]
+				if len(value) > 0 && value[0] == ' ' {
+					value = value[1:]
+				}
+				break
+			}
+		}
+
+		switch string(field) {
+		case "event":
+			eventType = string(value)
+		case "data":
+			if hasData {
+				d.data = append(d.data, '\n')
+			}
+			d.data = append(d.data, value...)
+			hasData = true
+		case "id":
+			if !containsNUL(value) {
+				d.LastEventID = string(value)
+			}
+		case "retry":
+			if ms, ok := parseDigits(value); ok {
+				d.Retry = time.Duration(ms) * time.Millisecond
+			}
+		}
+	}
+
+	if !hasData {
+		return nil
+	}
+	if eventType == "" {
+		eventType = "message"
+	}
+	return &Event{Type: eventType, Data: d.data, ID: d.LastEventID}
+}
+
+func containsNUL(b []byte) bool {
+	for _, c := range b {
+		if c == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func parseDigits(b []byte) (int64, bool) {
+	if len(b) == 0 || len(b) > 18 {
+		return 0, false
+	}
+	var v int64
+	for _, c := range b {
+		if c < '0' || c > '9' {
+			return 0, false
+		}
+		v = v*10 + int64(c-'0')
+	}
+	return v, true
+}
@@ -0,0 +1,163 @@
+package sse
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/zput/ringbuffer"
+	"github.com/zput/ringbuffer/codec"
+)
+
+type event struct {
+	typ, data, id string
+}
+
+// feed 一个字节一个字节地写入(经过缓存的尾部)，取出所有的事件。
+func feed(t *testing.T, d *Decoder, stream string) []event {
+	rb := ringbuffer.New(16)
+	_, _ = rb.Write(make([]byte, 10))
+	_, _ = rb.Read(make([]byte, 10))
+
+	var events []event
+	for i := 0; i < len(stream); i++ {
+		_ = rb.WriteOneByte(stream[i])
+		for {
+			e, err := d.Next(rb)
+			if err == codec.ErrNeedMoreData {
+				break
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			events = append(events, event{e.Type, string(e.Data), e.ID})
+		}
+	}
+	return events
+}
+
+func expectEvents(t *testing.T, got, expect []event) {
+	if len(got) != len(expect) {
+		t.Fatalf("expect %q but got %q", expect, got)
+	}
+	for i := range expect {
+		if got[i] != expect[i] {
+			t.Fatalf("expect %q but got %q", expect, got)
+		}
+	}
+}
+
+func TestDecoder(t *testing.T) {
+	stream := "\xef\xbb\xbf: comment\n" +
+		"data: first\ndata:  second\n\n" +
+		"event: update\r\nid: 7\r\nretry: 1500\r\ndata: {\"n\":1}\r\n\r\n" +
+		"id: 8\nretry: 1s\n\n" + // 没有 data 的事件不会被分发
+		"data\n\n" +
+		"id: bad\x00\ndata:x\n\n"
+	d := NewDecoder(0)
+	expectEvents(t, feed(t, d, stream), []event{
+		{"message", "first\n second", ""},
+		{"update", "{\"n\":1}", "7"},
+		{"message", "", "8"},
+		{"message", "x", "8"},
+	})
+	if d.LastEventID != "8" || d.Retry != 1500*time.Millisecond {
+		t.Fatalf("unexpected state %q %v", d.LastEventID, d.Retry)
+	}
+}
+
+func TestDecoder_CR(t *testing.T) {
+	// 单独的 "\r" 作为行结尾
+	d := NewDecoder(0)
+	expectEvents(t, feed(t, d, "data: a\rdata: b\r\rdata: c\r\n\r\ndata: d\r\r\n"), []event{
+		{"message", "a\nb", ""},
+		{"message", "c", ""},
+		{"message", "d", ""},
+	})
+
+	// 结尾的 "\r" 之后的 "\n" 不会被当作空行
+	rb := ringbuffer.NewWithData([]byte("data: e\r\r"))
+	e, err := d.Next(rb)
+	if err != nil || string(e.Data) != "e" {
+		t.Fatalf("unexpected event %v %v", e, err)
+	}
+	_, _ = rb.WriteString("\ndata: f\n\n")
+	e, err = d.Next(rb)
+	if err != nil || string(e.Data) != "f" {
+		t.Fatalf("unexpected event %v %v", e, err)
+	}
+}
+
+func TestDecoder_Partial(t *testing.T) {
+	d := NewDecoder(0)
+	rb := ringbuffer.New(8)
+	_, _ = rb.WriteString("data: {\"a\":[1,\ndata: 2]}\n")
+	if _, err := d.Next(rb); err != codec.ErrNeedMoreData {
+		t.Fatalf("expect ErrNeedMoreData but got %v", err)
+	}
+	if rb.Size() != len("data: {\"a\":[1,\ndata: 2]}\n") {
+		t.Fatalf("partial event should be untouched; got size %d", rb.Size())
+	}
+	_ = rb.WriteOneByte('\n')
+	e, err := d.Next(rb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var v struct{ A []int }
+	if err = json.Unmarshal(e.Data, &v); err != nil || len(v.A) != 2 {
+		t.Fatalf("unexpected data %q %v", e.Data, err)
+	}
+}
+
+// TestDecoder_Consumed 扫描状态属于缓存中的数据，换了缓存或者数据被其他人消费以后从头扫描。
+func TestDecoder_Consumed(t *testing.T) {
+	d := NewDecoder(0)
+	rb := ringbuffer.New(64)
+	_, _ = rb.WriteString("data: aaaaaaaaaaaaaaaaaaaaaaaa\n")
+	if _, err := d.Next(rb); err != codec.ErrNeedMoreData {
+		t.Fatalf("expect ErrNeedMoreData but got %v", err)
+	}
+
+	other := ringbuffer.New(64)
+	_, _ = other.WriteString("data: x\n\ndata: yyyyyyyyyyyyyyyyyyyyyyyy\n\n")
+	if e, err := d.Next(other); err != nil || string(e.Data) != "x" {
+		t.Fatalf("expect x but got %v", err)
+	}
+
+	_, _ = rb.Discard(rb.Size())
+	_, _ = rb.WriteString("data: z\n\ndata: yyyyyyyyyyyyyyyyyyyyyyyy\n\n")
+	if e, err := d.Next(rb); err != nil || string(e.Data) != "z" {
+		t.Fatalf("expect z but got %v", err)
+	}
+}
+
+func TestDecoder_TooLarge(t *testing.T) {
+	d := NewDecoder(16)
+	rb := ringbuffer.New(8)
+
+	// 完整到达的过长事件
+	_, _ = rb.WriteString("data: 0123456789abcdef\n\ndata: ok\n\n")
+	if _, err := d.Next(rb); err != ErrEventTooLarge {
+		t.Fatalf("expect ErrEventTooLarge but got %v", err)
+	}
+	if e, err := d.Next(rb); err != nil || string(e.Data) != "ok" {
+		t.Fatalf("unexpected event %v %v", e, err)
+	}
+
+	// 分多次到达的过长事件：已经到达的部分立即丢弃
+	_, _ = rb.WriteString("data: 0123456789abcdef\r")
+	if _, err := d.Next(rb); err != ErrEventTooLarge {
+		t.Fatalf("expect ErrEventTooLarge but got %v", err)
+	}
+	if !rb.IsEmpty() {
+		t.Fatalf("expect discarded but got size %d", rb.Size())
+	}
+	_, _ = rb.WriteString("\ndata: more\r\n")
+	if _, err := d.Next(rb); err != codec.ErrNeedMoreData {
+		t.Fatalf("expect ErrNeedMoreData but got %v", err)
+	}
+	_, _ = rb.WriteString("\r\ndata: ok2\n\n")
+	if e, err := d.Next(rb); err != nil || string(e.Data) != "ok2" {
+		t.Fatalf("unexpected event %v %v", e, err)
+	}
+}
@@ -0,0 +1,243 @@
+package tlsframe
+
+import (
+	"github.com/zput/ringbuffer"
+	"github.com/zput/ringbuffer/codec"
+)
+
+const (
+	handshakeTypeClientHello = 1
+
+	extensionServerName        = 0
+	extensionALPN              = 16
+	extensionSupportedVersions = 43
+
+	// ClientHello 消息的最大长度，超过这个长度的认为是恶意的
+	maxClientHelloLength = 64 * 1024
+)
+
+// ClientHello 是从 ClientHello 中取出的用于路由的信息。
+type ClientHello struct {
+	Version           uint16   // legacy_version
+	ServerName        string   // SNI，没有时为空
+	ALPNProtocols     []string // ALPN，按照客户端的优先级排列
+	SupportedVersions []uint16 // supported_versions 扩展(TLS 1.3)
+}
+
+/*
+SniffClientHello 解析 rb 开头的 ClientHello(可能分布在多个 handshake 记录中)，不消费任何数据，
+之后可以把缓存中的数据原样转发给后端。
+
+  - ClientHello 还没有完整到达时返回 codec.ErrNeedMoreData；
+  - 开头不是 TLS 记录时返回 ErrNotTLS，第一个握手消息不是 ClientHello 时返回 ErrNotClientHello。
+
+no thread safety guarantees
+*/
+func SniffClientHello(rb *ringbuffer.RingBuffer) (*ClientHello, error) {
+	first, end := rb.PeekAll(false)
+	v := view{first, end}
+
+	var handshake []byte
+	for off := 0; ; {
+		length, err := v.recordHeader(off, maxPlaintextLength)
+		if err != nil {
+			if err == ErrNotTLS && off > 0 {
+				err = ErrMalformedClientHello
+			}
+			return nil, err
+		}
+		// ClientHello 完整之前只能是 handshake 记录
+		if ContentType(v.at(off)) != Handshake {
+			if off == 0 {
+				return nil, ErrNotTLS
+			}
+			return nil, ErrMalformedClientHello
+		}
+		if length == 0 {
+			return nil, ErrMalformedClientHello
+		}
+
+		// 不需要等待整个记录，先检查已经到达的握手消息头
+		available := v.len() - off - RecordHeaderLength
+		if available > length {
+			available = length
+		}
+		if available > 0 && len(handshake) == 0 && v.at(off+RecordHeaderLength) != handshakeTypeClientHello {
+			return nil, ErrNotClientHello
+		}
+		if available < length {
+			return nil, codec.ErrNeedMoreData
+		}
+
+		payload := v.bytes(off+RecordHeaderLength, off+RecordHeaderLength+length)
+		handshake = append(handshake, payload...)
+		off += RecordHeaderLength + length
+
+		if len(handshake) < 4 {
+			continue
+		}
+		msgLength := int(handshake[1])<<16 | int(handshake[2])<<8 | int(handshake[3])
+		if msgLength > maxClientHelloLength {
+			return nil, ErrMalformedClientHello
+		}
+		if len(handshake) >= 4+msgLength {
+			return parseClientHello(handshake[4 : 4+msgLength])
+		}
+	}
+}
+
+/*
+parseClientHello 解析 ClientHello 消息体，见 RFC 8446 4.1.2：
+
+	uint16 legacy_version;
+	opaque random[32];
+	opaque legacy_session_id<0..32>;
+	CipherSuite cipher_suites<2..2^16-2>;
+	opaque legacy_compression_methods<1..2^8-1>;
+	Extension extensions<0..2^16-1>;
+*/
+func parseClientHello(b []byte) (*ClientHello, error) {
+	hello := &ClientHello{}
+	r := reader(b)
+
+	var (
+		random, sessionID, cipherSuites, compression, extensions []byte
+		ok                                                       = true
+	)
+	ok = ok && r.readUint16(&hello.Version)
+	ok = ok && r.readBytes(32, &random)
+	ok = ok && r.readUint8Prefixed(&sessionID) && len(sessionID) <= 32
+	ok = ok && r.readUint16Prefixed(&cipherSuites) && len(cipherSuites) >= 2 && len(cipherSuites)%2 == 0
+	ok = ok && r.readUint8Prefixed(&compression) && len(compression) >= 1
+	if !ok {
+		return nil, ErrMalformedClientHello
+	}
+	// 没有扩展的 ClientHello(SSL 3.0 时代的客户端)
+	if len(r) == 0 {
+		return hello, nil
+	}
+	if !r.readUint16Prefixed(&extensions) || len(r) != 0 {
+		return nil, ErrMalformedClientHello
+	}
+
+	for ext := reader(extensions); len(ext) > 0; {
+		var (
+			typ  uint16
+			data []byte
+		)
+		if !ext.readUint16(&typ) || !ext.readUint16Prefixed(&data) {
+			return nil, ErrMalformedClientHello
+		}
+		var err error
+		switch typ {
+		case extensionServerName:
+			hello.ServerName, err = parseServerName(data)
+		case extensionALPN:
+			hello.ALPNProtocols, err = parseALPN(data)
+		case extensionSupportedVersions:
+			hello.SupportedVersions, err = parseSupportedVersions(data)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return hello, nil
+}
+
+// parseServerName 返回 server_name 扩展中的第一个 host_name，见 RFC 6066 3。
+func parseServerName(data []byte) (string, error) {
+	r := reader(data)
+	var list []byte
+	if !r.readUint16Prefixed(&list) || len(r) != 0 {
+		return "", ErrMalformedClientHello
+	}
+	for l := reader(list); len(l) > 0; {
+		var (
+			nameType uint8
+			name     []byte
+		)
+		if !l.readUint8(&nameType) || !l.readUint16Prefixed(&name) {
+			return "", ErrMalformedClientHello
+		}
+		if nameType == 0 {
+			if len(name) == 0 {
+				return "", ErrMalformedClientHello
+			}
+			return string(name), nil
+		}
+	}
+	return "", nil
+}
+
+// parseALPN 解析 application_layer_protocol_negotiation 扩展，见 RFC 7301 3.1。
+func parseALPN(data []byte) ([]string, error) {
+	r := reader(data)
+	var list []byte
+	if !r.readUint16Prefixed(&list) || len(r) != 0 || len(list) == 0 {
+		return nil, ErrMalformedClientHello
+	}
+	var protocols []string
+	for l := reader(list); len(l) > 0; {
+		var proto []byte
+		if !l.readUint8Prefixed(&proto) || len(proto) == 0 {
+			return nil, ErrMalformedClientHello
+		}
+		protocols = append(protocols, string(proto))
+	}
+	return protocols, nil
+}
+
+func parseSupportedVersions(data []byte) ([]uint16, error) {
+	r := reader(data)
+	var list []byte
+	if !r.readUint8Prefixed(&list) || len(r) != 0 || len(list) == 0 || len(list)%2 != 0 {
+		return nil, ErrMalformedClientHello
+	}
+	versions := make([]uint16, 0, len(list)/2)
+	for l := reader(list); len(l) > 0; {
+		var version uint16
+		l.readUint16(&version)
+		versions = append(versions, version)
+	}
+	return versions, nil
+}
+
+// reader 依次读出大端序的整数与带长度前缀的字段，数据不够时返回 false。
+type reader []byte
+
+func (r *reader) readUint8(v *uint8) bool {
+	if len(*r) < 1 {
+		return false
+	}
+	*v = (*r)[0]
+	*r = (*r)[1:]
+	return true
+}
+
+func (r *reader) readUint16(v *uint16) bool {
+	if len(*r) < 2 {
+		return false
+	}
+	*v = uint16((*r)[0])<<8 | uint16((*r)[1])
+	*r = (*r)[2:]
+	return true
+}
+
+func (r *reader) readBytes(n int, v *[]byte) bool {
+	if len(*r) < n {
+		return false
+	}
+	*v = (*r)[:n]
+	*r = (*r)[n:]
+	return true
+}
+
+func (r *reader) readUint8Prefixed(v *[]byte) bool {
+	var n uint8
+	return r.readUint8(&n) && r.readBytes(int(n), v)
+}
+
+func (r *reader) readUint16Prefixed(v *[]byte) bool {
+	var n uint16
+	return r.readUint16(&n) && r.readBytes(int(n), v)
+}
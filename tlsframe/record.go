@@ -0,0 +1,161 @@
+// Package tlsframe 在不终止 TLS 的情况下，从 RingBuffer 中切分 TLS 记录，
+// 并且从 ClientHello 中取出 SNI 与 ALPN，用于按照域名转发的场景。
+package tlsframe
+
+import (
+	"encoding/binary"
+	"errors"
+
+	"github.com/zput/ringbuffer"
+	"github.com/zput/ringbuffer/codec"
+)
+
+// ContentType 是 TLS 记录的类型。
+type ContentType byte
+
+const (
+	ChangeCipherSpec ContentType = 20
+	Alert            ContentType = 21
+	Handshake        ContentType = 22
+	ApplicationData  ContentType = 23
+	Heartbeat        ContentType = 24
+)
+
+const (
+	// RecordHeaderLength 是记录头的长度：类型 1 + 版本 2 + 长度 2。
+	RecordHeaderLength = 5
+	// MaxRecordLength 是 TLSCiphertext 负载的最大长度 2^14 + 2048。
+	MaxRecordLength = 16384 + 2048
+	// maxPlaintextLength 是 TLSPlaintext 负载的最大长度，ClientHello 所在的记录不会被加密。
+	maxPlaintextLength = 16384
+)
+
+// 数据不是 TLS 记录；没有消费任何数据。
+var ErrNotTLS = errors.New("data is not a tls record; tlsframe")
+
+var ErrRecordTooLarge = errors.New("record length exceeds the limit; tlsframe")
+var ErrNotClientHello = errors.New("first handshake message is not a client hello; tlsframe")
+var ErrMalformedClientHello = errors.New("client hello is malformed; tlsframe")
+
+// Record 是一个完整的 TLS 记录。
+type Record struct {
+	Type    ContentType
+	Version uint16
+	// 记录的负载；跨越缓存尾部时分成两段，First 在前、End 在后
+	First []byte
+	End   []byte
+}
+
+// Length 返回负载的长度。
+func (r Record) Length() int {
+	return len(r.First) + len(r.End)
+}
+
+// Bytes 返回负载；只有一段时直接返回，否则拷贝到一个新的切片中。
+func (r Record) Bytes() []byte {
+	if len(r.End) == 0 {
+		return r.First
+	}
+	buf := make([]byte, r.Length())
+	copy(buf, r.First)
+	copy(buf[len(r.First):], r.End)
+	return buf
+}
+
+/*
+NextRecord 从 rb 中取出一个完整的记录，并消费它。
+
+记录不完整时返回 codec.ErrNeedMoreData，不消费任何数据；出错时同样不消费数据。
+Record 中的 First/End 直接引用 rb 的内存，只在下一次写入 rb 之前有效。
+no thread safety guarantees
+*/
+func NextRecord(rb *ringbuffer.RingBuffer) (Record, error) {
+	r, n, err := PeekRecord(rb)
+	if err != nil {
+		return Record{}, err
+	}
+	_, _ = rb.Discard(n)
+	return r, nil
+}
+
+// PeekRecord 与 NextRecord 相同，但是不消费记录；之后用 rb.Discard(n) 消费，n 是记录的总长度。
+func PeekRecord(rb *ringbuffer.RingBuffer) (r Record, n int, err error) {
+	first, end := rb.PeekAll(false)
+	v := view{first, end}
+	length, err := v.recordHeader(0, MaxRecordLength)
+	if err != nil {
+		return Record{}, 0, err
+	}
+	n = RecordHeaderLength + length
+	if v.len() < n {
+		return Record{}, 0, codec.ErrNeedMoreData
+	}
+
+	header := v.bytes(0, RecordHeaderLength)
+	r.Type = ContentType(header[0])
+	r.Version = binary.BigEndian.Uint16(header[1:])
+	if len(first) > RecordHeaderLength {
+		r.First = first[RecordHeaderLength:]
+		if len(r.First) >= length {
+			r.First = r.First[:length]
+		} else {
+			r.End = end[:length-len(r.First)]
+		}
+	} else {
+		// 记录头本身跨越了缓存的尾部
+		r.First = end[RecordHeaderLength-len(first) : n-len(first)]
+	}
+	return r, n, nil
+}
+
+// view 把 PeekAll 返回的两段数据当作一段连续的数据来访问。
+type view struct {
+	first, end []byte
+}
+
+func (v view) len() int {
+	return len(v.first) + len(v.end)
+}
+
+func (v view) at(i int) byte {
+	if i < len(v.first) {
+		return v.first[i]
+	}
+	return v.end[i-len(v.first)]
+}
+
+// bytes 返回 [from, to) 的数据；在同一段中时直接引用，跨越两段时拷贝到一个新的切片中。
+func (v view) bytes(from, to int) []byte {
+	n := len(v.first)
+	switch {
+	case to <= n:
+		return v.first[from:to]
+	case from >= n:
+		return v.end[from-n : to-n]
+	}
+	buf := make([]byte, to-from)
+	copy(buf, v.first[from:])
+	copy(buf[n-from:], v.end[:to-n])
+	return buf
+}
+
+// recordHeader 检查 off 处的记录头，返回负载的长度。
+// 已经到达的字节不像 TLS 记录时立即返回 ErrNotTLS，不必等到 5 个字节都到达。
+func (v view) recordHeader(off, maxLength int) (int, error) {
+	if v.len() > off {
+		if t := ContentType(v.at(off)); t < ChangeCipherSpec || t > Heartbeat {
+			return 0, ErrNotTLS
+		}
+	}
+	if v.len() > off+1 && v.at(off+1) != 3 {
+		return 0, ErrNotTLS
+	}
+	if v.len() < off+RecordHeaderLength {
+		return 0, codec.ErrNeedMoreData
+	}
+	length := int(v.at(off+3))<<8 | int(v.at(off+4))
+	if length > maxLength {
+		return 0, ErrRecordTooLarge
+	}
+	return length, nil
+}
@@ -0,0 +1,161 @@
+package tlsframe
+
+import (
+	"bytes"
+	"crypto/tls"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/zput/ringbuffer"
+	"github.com/zput/ringbuffer/codec"
+)
+
+// captureClientHello 返回 crypto/tls 的客户端发出的第一个握手记录。
+func captureClientHello(t *testing.T, config *tls.Config) []byte {
+	client, server := net.Pipe()
+	defer server.Close()
+	go func() {
+		_ = tls.Client(client, config).Handshake()
+		_ = client.Close()
+	}()
+
+	header := make([]byte, RecordHeaderLength)
+	if _, err := io.ReadFull(server, header); err != nil {
+		t.Fatal(err)
+	}
+	record := make([]byte, RecordHeaderLength+(int(header[3])<<8|int(header[4])))
+	copy(record, header)
+	if _, err := io.ReadFull(server, record[RecordHeaderLength:]); err != nil {
+		t.Fatal(err)
+	}
+	return record
+}
+
+// fragment 把一个 handshake 记录的负载拆分成多个负载不超过 size 的记录。
+func fragment(record []byte, size int) []byte {
+	var out []byte
+	for payload := record[RecordHeaderLength:]; len(payload) > 0; {
+		n := size
+		if n > len(payload) {
+			n = len(payload)
+		}
+		out = append(out, record[0], record[1], record[2], byte(n>>8), byte(n))
+		out = append(out, payload[:n]...)
+		payload = payload[n:]
+	}
+	return out
+}
+
+func TestSniffClientHello(t *testing.T) {
+	record := captureClientHello(t, &tls.Config{
+		ServerName:         "backend.example.com",
+		NextProtos:         []string{"h2", "http/1.1"},
+		InsecureSkipVerify: true,
+	})
+
+	for _, data := range [][]byte{record, fragment(record, 37)} {
+		// 一个字节一个字节地到达，经过缓存的尾部
+		rb := ringbuffer.New(64)
+		_, _ = rb.Write(make([]byte, 50))
+		_, _ = rb.Read(make([]byte, 50))
+
+		var (
+			hello *ClientHello
+			err   error
+		)
+		for i := 0; i < len(data); i++ {
+			_ = rb.WriteOneByte(data[i])
+			hello, err = SniffClientHello(rb)
+			if i < len(data)-1 && err != codec.ErrNeedMoreData {
+				t.Fatalf("at %d: expect ErrNeedMoreData but got %v", i, err)
+			}
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if hello.ServerName != "backend.example.com" {
+			t.Fatalf("unexpected server name %q", hello.ServerName)
+		}
+		if len(hello.ALPNProtocols) != 2 || hello.ALPNProtocols[0] != "h2" || hello.ALPNProtocols[1] != "http/1.1" {
+			t.Fatalf("unexpected alpn %q", hello.ALPNProtocols)
+		}
+		// 数据原样留在缓存中，可以转发给后端
+		if !bytes.Equal(rb.ReadAll2NewByteSlice(), data) {
+			t.Fatal("expect nothing consumed")
+		}
+	}
+}
+
+func TestSniffClientHello_NoSNI(t *testing.T) {
+	record := captureClientHello(t, &tls.Config{InsecureSkipVerify: true})
+	hello, err := SniffClientHello(ringbuffer.NewWithData(record))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hello.ServerName != "" || len(hello.ALPNProtocols) != 0 || hello.Version != tls.VersionTLS12 {
+		t.Fatalf("unexpected client hello %+v", hello)
+	}
+}
+
+func TestSniffClientHello_Errors(t *testing.T) {
+	cases := []struct {
+		input  []byte
+		expect error
+	}{
+		{[]byte("GET / HTTP/1.1\r\n"), ErrNotTLS},
+		{[]byte{0x16, 0x01}, ErrNotTLS},
+		// 只到达一个字节也不是错误
+		{[]byte{0x16}, codec.ErrNeedMoreData},
+		{[]byte{0x17, 0x03, 0x03, 0x00, 0x01, 0x00}, ErrNotTLS},
+		{[]byte{0x16, 0x03, 0x01, 0x00, 0x04, 0x02}, ErrNotClientHello},
+		{[]byte{0x16, 0x03, 0x01, 0x00, 0x00}, ErrMalformedClientHello},
+		{[]byte{0x16, 0x03, 0x01, 0x40, 0x01}, ErrRecordTooLarge},
+		{[]byte{0x16, 0x03, 0x01, 0x00, 0x04, 0x01, 0x00, 0x00, 0x02, 0x17, 0x03, 0x03, 0x00, 0x02, 0, 0}, ErrMalformedClientHello},
+		{[]byte{0x16, 0x03, 0x01, 0x00, 0x06, 0x01, 0x00, 0x00, 0x02, 0x03, 0x03}, ErrMalformedClientHello},
+		{[]byte{0x16, 0x03, 0x01, 0x00, 0x04, 0x01, 0xff, 0xff, 0xff}, ErrMalformedClientHello},
+	}
+	for _, c := range cases {
+		rb := ringbuffer.NewWithData(c.input)
+		if _, err := SniffClientHello(rb); err != c.expect {
+			t.Fatalf("%x: expect %v but got %v", c.input, c.expect, err)
+		}
+		if rb.Size() != len(c.input) {
+			t.Fatalf("%x: nothing should be consumed", c.input)
+		}
+	}
+}
+
+func TestNextRecord(t *testing.T) {
+	data := []byte{
+		0x16, 0x03, 0x01, 0x00, 0x03, 1, 2, 3,
+		0x14, 0x03, 0x03, 0x00, 0x01, 1,
+		0x17, 0x03, 0x03, 0x00, 0x00,
+	}
+	// 记录头跨越缓存的尾部
+	rb := ringbuffer.New(32)
+	_, _ = rb.Write(make([]byte, 29))
+	_, _ = rb.Read(make([]byte, 29))
+	_, _ = rb.Write(data)
+
+	r, err := NextRecord(rb)
+	if err != nil || r.Type != Handshake || r.Version != 0x0301 || !bytes.Equal(r.Bytes(), []byte{1, 2, 3}) {
+		t.Fatalf("unexpected record %+v %v", r, err)
+	}
+	r, err = NextRecord(rb)
+	if err != nil || r.Type != ChangeCipherSpec || r.Length() != 1 {
+		t.Fatalf("unexpected record %+v %v", r, err)
+	}
+	r, err = NextRecord(rb)
+	if err != nil || r.Type != ApplicationData || r.Length() != 0 {
+		t.Fatalf("unexpected record %+v %v", r, err)
+	}
+	if _, err = NextRecord(rb); err != codec.ErrNeedMoreData {
+		t.Fatalf("expect ErrNeedMoreData but got %v", err)
+	}
+
+	_, _ = rb.Write([]byte{0x17, 0x03, 0x03, 0x48, 0x01})
+	if _, err = NextRecord(rb); err != ErrRecordTooLarge {
+		t.Fatalf("expect ErrRecordTooLarge but got %v", err)
+	}
+}
@@ -0,0 +1,230 @@
+package websocket
+
+import (
+	"math"
+	"unicode/utf8"
+
+	"github.com/zput/ringbuffer"
+	"github.com/zput/ringbuffer/codec"
+)
+
+const (
+	DefaultMaxFrameSize   = 16 * 1024 * 1024
+	DefaultMaxMessageSize = 64 * 1024 * 1024
+)
+
+// Decoder 从 RingBuffer 中解码帧，并重组分片的消息；保存着分片的状态，每个连接一个，不是线程安全的。
+// 任何错误之后都应该关闭连接(关闭帧的状态码见 CloseCode)。
+type Decoder struct {
+	MaxFrameSize   int  // 单个帧负载的最大长度
+	MaxMessageSize int  // 重组后消息的最大长度
+	IsServer       bool // 服务端要求帧必须带掩码，客户端要求帧不能带掩码
+	AllowedRsv     byte // 扩展协商的 RSV 位，默认不允许
+
+	fragmenting bool
+	fragOpcode  Opcode
+	fragments   []byte
+}
+
+// NewDecoder 返回使用默认限制的 Decoder；服务端使用时 isServer 为 true。
+func NewDecoder(isServer bool) *Decoder {
+	return &Decoder{
+		MaxFrameSize:   DefaultMaxFrameSize,
+		MaxMessageSize: DefaultMaxMessageSize,
+		IsServer:       isServer,
+	}
+}
+
+/*
+DecodeFrame 从 rb 中取出一个完整的帧，不做分片的重组。
+
+帧不完整时返回 codec.ErrNeedMoreData，不消费任何数据；违反协议时同样不消费数据。
+带掩码的负载在 rb 中原地去掉掩码；负载没有跨越缓存尾部时 Payload 直接引用 rb 的内存，
+只在下一次写入 rb 之前有效，否则拷贝到一个新的切片中。
+no thread safety guarantees; 内部使用 rb 的 explore 游标
+*/
+func (d *Decoder) DecodeFrame(rb *ringbuffer.RingBuffer) (f Frame, err error) {
+	rb.ExploreBegin()
+	headerLength, length, err := d.exploreHeader(rb, &f)
+	if err == nil && rb.ExploreSize() < length {
+		err = codec.ErrNeedMoreData
+	}
+	if err != nil {
+		rb.ExploreBreak()
+		return Frame{}, err
+	}
+
+	first, end := rb.Peek(length, true)
+	if f.Masked {
+		pos := maskBytes(f.MaskKey, 0, first)
+		maskBytes(f.MaskKey, pos, end)
+	}
+	if len(end) == 0 {
+		f.Payload = first
+	} else {
+		f.Payload = make([]byte, length)
+		copy(f.Payload, first)
+		copy(f.Payload[len(first):], end)
+	}
+	// 负载已经通过 Peek 拿到了，直接从读指针处消费整个帧
+	rb.ExploreBreak()
+	_, _ = rb.Discard(headerLength + length)
+	return f, nil
+}
+
+// exploreHeader 解析帧头并检查协议规则，explore 游标移动到负载的开始处。
+func (d *Decoder) exploreHeader(rb *ringbuffer.RingBuffer, f *Frame) (headerLength, length int, err error) {
+	var header [2]byte
+	if rb.ExploreSize() < len(header) {
+		return 0, 0, codec.ErrNeedMoreData
+	}
+	_, _ = rb.ExploreRead(header[:])
+	headerLength = len(header)
+
+	f.Fin = header[0]&0x80 != 0
+	f.Rsv = header[0] & (Rsv1 | Rsv2 | Rsv3)
+	f.Opcode = Opcode(header[0] & 0x0f)
+	f.Masked = header[1]&0x80 != 0
+
+	if f.Rsv&^d.AllowedRsv != 0 {
+		return 0, 0, ErrReservedBits
+	}
+	if !f.Opcode.isValid() {
+		return 0, 0, ErrInvalidOpcode
+	}
+	if d.IsServer && !f.Masked {
+		return 0, 0, ErrUnmaskedFrame
+	}
+	if !d.IsServer && f.Masked {
+		return 0, 0, ErrMaskedFrame
+	}
+
+	var skip [8]byte
+	length = int(header[1] & 0x7f)
+	if f.Opcode.IsControl() {
+		if !f.Fin {
+			return 0, 0, ErrFragmentedControl
+		}
+		if length > MaxControlPayloadLength {
+			return 0, 0, ErrControlTooLong
+		}
+	}
+	switch length {
+	case 126:
+		length16, err := rb.PeekUint16BE(true)
+		if err != nil {
+			return 0, 0, codec.ErrNeedMoreData
+		}
+		length = int(length16)
+		if length < 126 {
+			return 0, 0, ErrInvalidLength
+		}
+		_, _ = rb.ExploreRead(skip[:2])
+		headerLength += 2
+	case 127:
+		length64, err := rb.PeekUint64BE(true)
+		if err != nil {
+			return 0, 0, codec.ErrNeedMoreData
+		}
+		if length64 <= math.MaxUint16 || length64 > math.MaxInt64 {
+			return 0, 0, ErrInvalidLength
+		}
+		if length64 > uint64(d.MaxFrameSize) {
+			return 0, 0, ErrFrameTooLarge
+		}
+		length = int(length64)
+		_, _ = rb.ExploreRead(skip[:8])
+		headerLength += 8
+	}
+	if length > d.MaxFrameSize {
+		return 0, 0, ErrFrameTooLarge
+	}
+
+	if f.Masked {
+		if rb.ExploreSize() < len(f.MaskKey) {
+			return 0, 0, codec.ErrNeedMoreData
+		}
+		_, _ = rb.ExploreRead(f.MaskKey[:])
+		headerLength += len(f.MaskKey)
+	}
+	return headerLength, length, nil
+}
+
+/*
+ReadMessage 从 rb 中取出下一个完整的消息。
+
+控制帧(可以穿插在分片之间)立即作为一个 Message 返回；数据帧的分片在 Decoder 中累积，
+收到最后一个分片时返回重组后的消息。因为分片已经被消费，返回 codec.ErrNeedMoreData 时
+rb 中的数据可能减少了，等待更多数据后再次调用即可。
+未分片的消息与 DecodeFrame 一样可能直接引用 rb 的内存。
+*/
+func (d *Decoder) ReadMessage(rb *ringbuffer.RingBuffer) (Message, error) {
+	for {
+		f, err := d.DecodeFrame(rb)
+		if err != nil {
+			return Message{}, err
+		}
+
+		switch {
+		case f.Opcode.IsControl():
+			if f.Opcode == OpClose {
+				if _, _, err = ParseCloseMessage(f.Payload); err != nil {
+					return Message{}, err
+				}
+			}
+			return Message{Opcode: f.Opcode, Payload: f.Payload}, nil
+
+		case f.Opcode == OpContinuation:
+			if !d.fragmenting {
+				return Message{}, ErrUnexpectedContinuation
+			}
+			if len(d.fragments)+len(f.Payload) > d.MaxMessageSize {
+				return Message{}, ErrMessageTooLarge
+			}
+			d.fragments = append(d.fragments, f.Payload...)
+			if !f.Fin {
+				continue
+			}
+			msg := Message{Opcode: d.fragOpcode, Payload: d.fragments}
+			d.fragmenting = false
+			d.fragments = nil
+			return msg, d.validate(msg)
+
+		default:
+			if d.fragmenting {
+				return Message{}, ErrExpectedContinuation
+			}
+			if len(f.Payload) > d.MaxMessageSize {
+				return Message{}, ErrMessageTooLarge
+			}
+			if f.Fin {
+				msg := Message{Opcode: f.Opcode, Payload: f.Payload}
+				return msg, d.validate(msg)
+			}
+			d.fragmenting = true
+			d.fragOpcode = f.Opcode
+			d.fragments = append([]byte(nil), f.Payload...)
+		}
+	}
+}
+
+// validate 检查文本消息是否是合法的 utf-8；启用了扩展(例如压缩)时由调用者在解压后检查。
+func (d *Decoder) validate(msg Message) error {
+	if msg.Opcode == OpText && d.AllowedRsv == 0 && !utf8.Valid(msg.Payload) {
+		return ErrInvalidUTF8
+	}
+	return nil
+}
+
+// CloseCode 返回解码错误对应的关闭帧状态码。
+func CloseCode(err error) uint16 {
+	switch err {
+	case nil:
+		return CloseNormalClosure
+	case ErrFrameTooLarge, ErrMessageTooLarge:
+		return CloseMessageTooBig
+	case ErrInvalidUTF8:
+		return CloseInvalidPayloadData
+	}
+	return CloseProtocolError
+}
@@ -0,0 +1,133 @@
+package websocket
+
+import (
+	"encoding/binary"
+
+	"github.com/zput/ringbuffer"
+)
+
+// maskChunkSize 是带掩码写入时每次拷贝的字节数；不修改调用者的 payload。
+const maskChunkSize = 512
+
+// WriteFrame 把 f 编码后写入 out；f.Masked 为 true 时用 f.MaskKey 给负载加上掩码。
+func WriteFrame(out *ringbuffer.RingBuffer, f Frame) error {
+	if !f.Opcode.isValid() {
+		return ErrInvalidOpcode
+	}
+	if f.Rsv&^(Rsv1|Rsv2|Rsv3) != 0 {
+		return ErrReservedBits
+	}
+	if f.Opcode.IsControl() {
+		if !f.Fin {
+			return ErrFragmentedControl
+		}
+		if len(f.Payload) > MaxControlPayloadLength {
+			return ErrControlTooLong
+		}
+	}
+
+	var (
+		header [14]byte
+		n      = 2
+	)
+	header[0] = f.Rsv | byte(f.Opcode)
+	if f.Fin {
+		header[0] |= 0x80
+	}
+	length := len(f.Payload)
+	switch {
+	case length < 126:
+		header[1] = byte(length)
+	case length <= 0xffff:
+		header[1] = 126
+		binary.BigEndian.PutUint16(header[2:], uint16(length))
+		n += 2
+	default:
+		header[1] = 127
+		binary.BigEndian.PutUint64(header[2:], uint64(length))
+		n += 8
+	}
+	if f.Masked {
+		header[1] |= 0x80
+		n += copy(header[n:], f.MaskKey[:])
+	}
+	if _, err := out.Write(header[:n]); err != nil {
+		return err
+	}
+
+	if !f.Masked {
+		_, err := out.Write(f.Payload)
+		return err
+	}
+	var (
+		chunk [maskChunkSize]byte
+		pos   int
+	)
+	for p := f.Payload; len(p) > 0; {
+		c := copy(chunk[:], p)
+		p = p[c:]
+		pos = maskBytes(f.MaskKey, pos, chunk[:c])
+		if _, err := out.Write(chunk[:c]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Encoder 把消息编码成服务端的帧(不带掩码)写入输出缓存。
+type Encoder struct {
+	// 消息按照 FragmentSize 切分成多个帧，0 表示不分片
+	FragmentSize int
+	// Encode 使用的 opcode，默认 OpBinary
+	Opcode Opcode
+}
+
+// NewEncoder 返回一个不分片、Encode 发送二进制消息的 Encoder。
+func NewEncoder() *Encoder {
+	return &Encoder{Opcode: OpBinary}
+}
+
+// WriteMessage 把一个数据消息写入 out。
+func (e *Encoder) WriteMessage(out *ringbuffer.RingBuffer, op Opcode, payload []byte) error {
+	if op.IsControl() || op == OpContinuation {
+		return ErrInvalidOpcode
+	}
+	f := Frame{Opcode: op}
+	for {
+		f.Payload = payload
+		if e.FragmentSize > 0 && len(payload) > e.FragmentSize {
+			f.Payload = payload[:e.FragmentSize]
+		}
+		payload = payload[len(f.Payload):]
+		f.Fin = len(payload) == 0
+		if err := WriteFrame(out, f); err != nil {
+			return err
+		}
+		if f.Fin {
+			return nil
+		}
+		f.Opcode = OpContinuation
+	}
+}
+
+// WriteControl 把一个控制帧(close/ping/pong)写入 out，负载不能超过 125 个字节。
+func (e *Encoder) WriteControl(out *ringbuffer.RingBuffer, op Opcode, payload []byte) error {
+	if !op.IsControl() {
+		return ErrInvalidOpcode
+	}
+	return WriteFrame(out, Frame{Fin: true, Opcode: op, Payload: payload})
+}
+
+// WriteClose 写入一个关闭帧。
+func (e *Encoder) WriteClose(out *ringbuffer.RingBuffer, code uint16, text string) error {
+	return e.WriteControl(out, OpClose, FormatCloseMessage(code, text))
+}
+
+// Encode 实现 codec.Encoder，把 frame 作为一个 e.Opcode 类型的消息写入 out。
+func (e *Encoder) Encode(out *ringbuffer.RingBuffer, frame []byte) error {
+	op := e.Opcode
+	if op == OpContinuation {
+		op = OpBinary
+	}
+	return e.WriteMessage(out, op, frame)
+}
@@ -0,0 +1,138 @@
+// Package websocket 在 RingBuffer 之上实现 WebSocket(RFC 6455)的分帧：
+// 从输入缓存中解码帧并重组分片的消息，把服务端的帧编码到输出缓存中。
+// 握手(HTTP Upgrade)不在这个包的范围内。
+package websocket
+
+import (
+	"encoding/binary"
+	"errors"
+	"unicode/utf8"
+)
+
+// Opcode 是帧的类型。
+type Opcode byte
+
+const (
+	OpContinuation Opcode = 0x0
+	OpText         Opcode = 0x1
+	OpBinary       Opcode = 0x2
+	OpClose        Opcode = 0x8
+	OpPing         Opcode = 0x9
+	OpPong         Opcode = 0xA
+)
+
+// IsControl 返回是否是控制帧(close/ping/pong)。
+func (op Opcode) IsControl() bool {
+	return op&0x8 != 0
+}
+
+func (op Opcode) isValid() bool {
+	switch op {
+	case OpContinuation, OpText, OpBinary, OpClose, OpPing, OpPong:
+		return true
+	}
+	return false
+}
+
+// 帧头第一个字节中的 RSV 位，由协商的扩展使用(例如 permessage-deflate 使用 Rsv1)。
+const (
+	Rsv1 byte = 0x40
+	Rsv2 byte = 0x20
+	Rsv3 byte = 0x10
+)
+
+// MaxControlPayloadLength 是控制帧负载的最大长度。
+const MaxControlPayloadLength = 125
+
+// 关闭帧中常用的状态码。
+const (
+	CloseNormalClosure      uint16 = 1000
+	CloseGoingAway          uint16 = 1001
+	CloseProtocolError      uint16 = 1002
+	CloseUnsupportedData    uint16 = 1003
+	CloseNoStatusReceived   uint16 = 1005 // 只用于表示关闭帧中没有状态码，不能出现在帧中
+	CloseInvalidPayloadData uint16 = 1007
+	ClosePolicyViolation    uint16 = 1008
+	CloseMessageTooBig      uint16 = 1009
+	CloseInternalServerErr  uint16 = 1011
+)
+
+// Frame 是一个 WebSocket 帧；解码出来的 Payload 已经去掉了掩码。
+type Frame struct {
+	Fin     bool
+	Rsv     byte // Rsv1|Rsv2|Rsv3 的组合
+	Opcode  Opcode
+	Masked  bool
+	MaskKey [4]byte
+	Payload []byte
+}
+
+// Message 是一个完整的消息：重组后的数据消息，或者一个控制帧。
+type Message struct {
+	Opcode  Opcode
+	Payload []byte
+}
+
+var ErrReservedBits = errors.New("reserved bits are set without a negotiated extension; websocket")
+var ErrInvalidOpcode = errors.New("opcode is reserved; websocket")
+var ErrFragmentedControl = errors.New("control frame is fragmented; websocket")
+var ErrControlTooLong = errors.New("control frame payload is longer than 125 bytes; websocket")
+var ErrInvalidLength = errors.New("payload length is not minimally encoded or too large; websocket")
+var ErrUnmaskedFrame = errors.New("frame from client is not masked; websocket")
+var ErrMaskedFrame = errors.New("frame from server is masked; websocket")
+var ErrFrameTooLarge = errors.New("frame payload exceeds the limit; websocket")
+var ErrMessageTooLarge = errors.New("message exceeds the limit; websocket")
+var ErrUnexpectedContinuation = errors.New("continuation frame without a fragmented message; websocket")
+var ErrExpectedContinuation = errors.New("new data frame before the fragmented message is finished; websocket")
+var ErrInvalidUTF8 = errors.New("text message is not valid utf-8; websocket")
+var ErrInvalidClosePayload = errors.New("close frame payload is invalid; websocket")
+
+// FormatCloseMessage 返回关闭帧的负载：2 个字节的状态码 + text。
+func FormatCloseMessage(code uint16, text string) []byte {
+	if code == CloseNoStatusReceived {
+		return []byte{}
+	}
+	buf := make([]byte, 2+len(text))
+	binary.BigEndian.PutUint16(buf, code)
+	copy(buf[2:], text)
+	return buf
+}
+
+// ParseCloseMessage 解析关闭帧的负载；负载为空时返回 CloseNoStatusReceived。
+func ParseCloseMessage(payload []byte) (code uint16, text string, err error) {
+	if len(payload) == 0 {
+		return CloseNoStatusReceived, "", nil
+	}
+	if len(payload) == 1 {
+		return 0, "", ErrInvalidClosePayload
+	}
+	code = binary.BigEndian.Uint16(payload)
+	if !validCloseCode(code) || !utf8.Valid(payload[2:]) {
+		return 0, "", ErrInvalidClosePayload
+	}
+	return code, string(payload[2:]), nil
+}
+
+// validCloseCode 返回 code 是否可以出现在关闭帧中，见 RFC 6455 7.4。
+func validCloseCode(code uint16) bool {
+	switch {
+	case code >= 3000 && code <= 4999:
+		return true
+	case code < 1000 || code > 1014:
+		return false
+	}
+	switch code {
+	case 1004, 1005, 1006:
+		return false
+	}
+	return true
+}
+
+// maskBytes 用 key 对 b 做异或，pos 是 b 的第一个字节在负载中的位置；返回下一个位置。
+func maskBytes(key [4]byte, pos int, b []byte) int {
+	for i := range b {
+		b[i] ^= key[pos&3]
+		pos++
+	}
+	return pos & 3
+}
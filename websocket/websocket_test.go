@@ -0,0 +1,224 @@
+package websocket
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/zput/ringbuffer"
+	"github.com/zput/ringbuffer/codec"
+)
+
+var testMaskKey = [4]byte{0x37, 0xfa, 0x21, 0x3d}
+
+// RFC 6455 5.7 中的例子
+func TestDecoder_RFCExamples(t *testing.T) {
+	cases := []struct {
+		isServer bool
+		input    []byte
+		opcode   Opcode
+		payload  []byte
+	}{
+		{false, []byte{0x81, 0x05, 0x48, 0x65, 0x6c, 0x6c, 0x6f}, OpText, []byte("Hello")},
+		{true, []byte{0x81, 0x85, 0x37, 0xfa, 0x21, 0x3d, 0x7f, 0x9f, 0x4d, 0x51, 0x58}, OpText, []byte("Hello")},
+		{false, []byte{0x01, 0x03, 0x48, 0x65, 0x6c, 0x80, 0x02, 0x6c, 0x6f}, OpText, []byte("Hello")},
+		{false, []byte{0x89, 0x05, 0x48, 0x65, 0x6c, 0x6c, 0x6f}, OpPing, []byte("Hello")},
+		{true, []byte{0x8a, 0x85, 0x37, 0xfa, 0x21, 0x3d, 0x7f, 0x9f, 0x4d, 0x51, 0x58}, OpPong, []byte("Hello")},
+		{false, append([]byte{0x82, 0x7e, 0x01, 0x00}, make([]byte, 256)...), OpBinary, make([]byte, 256)},
+		{false, append([]byte{0x82, 0x7f, 0, 0, 0, 0, 0, 0x01, 0x00, 0x00}, make([]byte, 65536)...), OpBinary, make([]byte, 65536)},
+	}
+	for i, c := range cases {
+		rb := ringbuffer.NewWithData(append([]byte(nil), c.input...))
+		msg, err := NewDecoder(c.isServer).ReadMessage(rb)
+		if err != nil {
+			t.Fatalf("case %d: %v", i, err)
+		}
+		if msg.Opcode != c.opcode || !bytes.Equal(msg.Payload, c.payload) {
+			t.Fatalf("case %d: unexpected message %v %q", i, msg.Opcode, msg.Payload)
+		}
+		if !rb.IsEmpty() {
+			t.Fatalf("case %d: expect all data consumed", i)
+		}
+	}
+}
+
+func TestDecoder_Incremental(t *testing.T) {
+	// 客户端发送的带掩码的帧：分成 3 片的文本消息，中间穿插一个 ping
+	client := ringbuffer.New(16)
+	text := bytes.Repeat([]byte("héllo, wörld "), 20)
+	frames := []Frame{
+		{Opcode: OpText, Payload: text[:100]},
+		{Opcode: OpContinuation, Payload: text[100:200]},
+		{Fin: true, Opcode: OpPing, Payload: []byte("ping")},
+		{Fin: true, Opcode: OpContinuation, Payload: text[200:]},
+	}
+	for i := range frames {
+		frames[i].Masked = true
+		frames[i].MaskKey = testMaskKey
+		if err := WriteFrame(client, frames[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	wire := client.ReadAll2NewByteSlice()
+
+	// 一个字节一个字节地送入一个容量很小、会回绕的缓存
+	d := NewDecoder(true)
+	rb := ringbuffer.New(8)
+	_, _ = rb.Write(make([]byte, 5))
+	rb.Retrieve(5)
+
+	var msgs []Message
+	for i := range wire {
+		_ = rb.WriteOneByte(wire[i])
+		msg, err := d.ReadMessage(rb)
+		if err == codec.ErrNeedMoreData {
+			continue
+		}
+		if err != nil {
+			t.Fatalf("at %d: %v", i, err)
+		}
+		msgs = append(msgs, Message{Opcode: msg.Opcode, Payload: append([]byte(nil), msg.Payload...)})
+	}
+	if len(msgs) != 2 {
+		t.Fatalf("expect 2 messages but got %d", len(msgs))
+	}
+	if msgs[0].Opcode != OpPing || string(msgs[0].Payload) != "ping" {
+		t.Fatalf("unexpected ping %v %q", msgs[0].Opcode, msgs[0].Payload)
+	}
+	if msgs[1].Opcode != OpText || !bytes.Equal(msgs[1].Payload, text) {
+		t.Fatalf("unexpected text %v %q", msgs[1].Opcode, msgs[1].Payload)
+	}
+	if !rb.IsEmpty() {
+		t.Fatal("expect all data consumed")
+	}
+}
+
+func TestDecoder_UnmaskInPlace(t *testing.T) {
+	rb := ringbuffer.New(64)
+	_ = WriteFrame(rb, Frame{Fin: true, Opcode: OpBinary, Masked: true, MaskKey: testMaskKey, Payload: []byte("in place")})
+	raw, _ := rb.PeekAll(false)
+
+	f, err := NewDecoder(true).DecodeFrame(rb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(f.Payload) != "in place" || f.MaskKey != testMaskKey {
+		t.Fatalf("unexpected frame %+v", f)
+	}
+	// 负载没有回绕时直接引用缓存的内存，掩码在缓存中原地去掉
+	if &f.Payload[0] != &raw[6] || string(raw[6:]) != "in place" {
+		t.Fatalf("expect payload unmasked in place but got %q", raw[6:])
+	}
+	if !rb.IsEmpty() {
+		t.Fatal("expect all data consumed")
+	}
+}
+
+func TestDecoder_Errors(t *testing.T) {
+	cases := []struct {
+		isServer bool
+		input    []byte
+		expect   error
+	}{
+		{false, []byte{0xc1, 0x00}, ErrReservedBits},
+		{false, []byte{0x83, 0x00}, ErrInvalidOpcode},
+		{false, []byte{0x8b, 0x00}, ErrInvalidOpcode},
+		{false, []byte{0x09, 0x00}, ErrFragmentedControl},
+		{false, []byte{0x89, 0x7e, 0x00, 0x7e}, ErrControlTooLong},
+		{false, []byte{0x82, 0x7e, 0x00, 0x7d}, ErrInvalidLength},
+		{false, []byte{0x82, 0x7f, 0, 0, 0, 0, 0, 0, 0xff, 0xff}, ErrInvalidLength},
+		{false, []byte{0x82, 0x7f, 0x80, 0, 0, 0, 0, 0, 0, 0}, ErrInvalidLength},
+		{false, []byte{0x82, 0x7f, 0, 0, 0, 0, 0x10, 0, 0, 0}, ErrFrameTooLarge},
+		{true, []byte{0x81, 0x00}, ErrUnmaskedFrame},
+		{false, []byte{0x81, 0x80, 0, 0, 0, 0}, ErrMaskedFrame},
+		{false, []byte{0x80, 0x00}, ErrUnexpectedContinuation},
+		{false, []byte{0x01, 0x00, 0x81, 0x00}, ErrExpectedContinuation},
+		{false, []byte{0x81, 0x02, 0xc3, 0x28}, ErrInvalidUTF8},
+		{false, []byte{0x88, 0x01, 0x03}, ErrInvalidClosePayload},
+		{false, []byte{0x88, 0x02, 0x03, 0xed}, ErrInvalidClosePayload},
+	}
+	for i, c := range cases {
+		rb := ringbuffer.NewWithData(c.input)
+		_, err := NewDecoder(c.isServer).ReadMessage(rb)
+		if err != c.expect {
+			t.Fatalf("case %d: expect %v but got %v", i, c.expect, err)
+		}
+	}
+
+	// 违反协议时不消费数据
+	rb := ringbuffer.NewWithData([]byte{0xc1, 0x00})
+	if _, err := NewDecoder(false).DecodeFrame(rb); err != ErrReservedBits || rb.Size() != 2 {
+		t.Fatalf("expect nothing consumed; err %v size %d", err, rb.Size())
+	}
+
+	d := NewDecoder(false)
+	d.MaxMessageSize = 4
+	rb = ringbuffer.NewWithData([]byte{0x02, 0x03, 1, 2, 3, 0x80, 0x02, 4, 5})
+	if _, err := d.ReadMessage(rb); err != ErrMessageTooLarge {
+		t.Fatalf("expect ErrMessageTooLarge but got %v", err)
+	}
+	if CloseCode(ErrMessageTooLarge) != CloseMessageTooBig || CloseCode(ErrMaskedFrame) != CloseProtocolError {
+		t.Fatal("unexpected close code")
+	}
+}
+
+func TestEncoder(t *testing.T) {
+	e := NewEncoder()
+	out := ringbuffer.New(16)
+	d := NewDecoder(false)
+
+	for _, n := range []int{0, 125, 126, 65535, 65536} {
+		payload := bytes.Repeat([]byte{'x'}, n)
+		if err := e.Encode(out, payload); err != nil {
+			t.Fatal(err)
+		}
+		headerLength := 2
+		if n >= 126 {
+			headerLength += 2
+		}
+		if n > 65535 {
+			headerLength += 6
+		}
+		if out.Size() != headerLength+n {
+			t.Fatalf("%d: expect %d bytes but got %d", n, headerLength+n, out.Size())
+		}
+		msg, err := d.ReadMessage(out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if msg.Opcode != OpBinary || !bytes.Equal(msg.Payload, payload) {
+			t.Fatalf("%d: unexpected message", n)
+		}
+	}
+
+	e.FragmentSize = 4
+	if err := e.WriteMessage(out, OpText, []byte("fragmented")); err != nil {
+		t.Fatal(err)
+	}
+	expect := []byte{0x01, 0x04, 'f', 'r', 'a', 'g', 0x00, 0x04, 'm', 'e', 'n', 't', 0x80, 0x02, 'e', 'd'}
+	if got, _ := out.Peek(out.Size(), false); !bytes.Equal(got, expect) {
+		t.Fatalf("expect %v but got %v", expect, got)
+	}
+	msg, err := d.ReadMessage(out)
+	if err != nil || string(msg.Payload) != "fragmented" {
+		t.Fatalf("unexpected message %q %v", msg.Payload, err)
+	}
+
+	if err = e.WriteClose(out, CloseGoingAway, "bye"); err != nil {
+		t.Fatal(err)
+	}
+	msg, _ = d.ReadMessage(out)
+	code, text, err := ParseCloseMessage(msg.Payload)
+	if msg.Opcode != OpClose || code != CloseGoingAway || text != "bye" || err != nil {
+		t.Fatalf("unexpected close %v %d %q %v", msg.Opcode, code, text, err)
+	}
+
+	if err = e.WriteControl(out, OpPing, make([]byte, 126)); err != ErrControlTooLong {
+		t.Fatalf("expect ErrControlTooLong but got %v", err)
+	}
+	if err = e.WriteMessage(out, OpPing, nil); err != ErrInvalidOpcode {
+		t.Fatalf("expect ErrInvalidOpcode but got %v", err)
+	}
+	if !out.IsEmpty() {
+		t.Fatal("nothing should be written on error")
+	}
+}
@@ -0,0 +1,71 @@
+package ringbuffer
+
+import "errors"
+
+var ErrIsNotInWrite = errors.New("not begin write transaction; ring buffer")
+
+// 写事务中不能执行这个操作。
+var ErrInWriteTx = errors.New("in write transaction; ring buffer")
+
+/*
+写事务是写入一端的 Explore：
+
+	WriteBegin
+	Write/WriteString/WriteOneByte/CopyFromHistory
+	...
+	WriteCommit/WriteRollback
+
+WriteBegin 之后写入的数据暂时不可见：Read、Peek、Size、Explore、Cursor、WriteOffset 都看不到它们，
+WriteCommit 一次性把它们变成可以读取的数据，WriteRollback 丢弃它们。
+打开锁的缓存中，WriteCommit 在一次加锁中发布全部数据，并发的读者要么看到整条消息，要么什么都看不到。
+
+写事务属于唯一的写者，同时只能有一个；事务中的 WriteBegin 什么都不做，事务继续。
+事务中 ReadBack/TruncateTail 返回 ErrInWriteTx；RetrieveAll/Reset 不影响未提交的数据。
+*/
+// READ/WRITE LOCK
+func (this *RingBuffer) WriteBegin() {
+	this.m.Lock()
+	defer this.m.Unlock()
+
+	this.inWrite = true
+}
+
+// WriteCommit 发布事务中写入的数据并结束事务；没有 WriteBegin 时返回 ErrIsNotInWrite。
+// READ/WRITE LOCK
+func (this *RingBuffer) WriteCommit() error {
+	this.m.Lock()
+	defer this.m.Unlock()
+
+	if !this.inWrite {
+		return ErrIsNotInWrite
+	}
+	if this.pend > 0 {
+		this.publish(this.pend)
+	}
+	this.pend = 0
+	this.inWrite = false
+	return nil
+}
+
+// WriteRollback 丢弃事务中写入的数据并结束事务，写指针回到 WriteBegin 时的位置；没有 WriteBegin 时返回 ErrIsNotInWrite。
+// READ/WRITE LOCK
+func (this *RingBuffer) WriteRollback() error {
+	this.m.Lock()
+	defer this.m.Unlock()
+
+	if !this.inWrite {
+		return ErrIsNotInWrite
+	}
+	this.pend = 0
+	this.inWrite = false
+	return nil
+}
+
+// PendingSize 返回写事务中还没有提交的字节数。
+// READ LOCK
+func (this *RingBuffer) PendingSize() int {
+	this.m.RLock()
+	defer this.m.RUnlock()
+
+	return this.pend
+}
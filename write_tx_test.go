@@ -0,0 +1,179 @@
+package ringbuffer
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+)
+
+func TestWriteTx(t *testing.T) {
+	rb := New(4)
+	_, _ = rb.WriteString("ab")
+	_, _ = rb.ReadByte()
+
+	rb.WriteBegin()
+	_, _ = rb.WriteString("cd")
+	_ = rb.WriteByte('e')
+	// 未提交的数据不可见
+	if rb.Size() != 1 || rb.PendingSize() != 3 || rb.WriteOffset() != 2 {
+		t.Fatalf("unexpected size %d, pending %d, write offset %d", rb.Size(), rb.PendingSize(), rb.WriteOffset())
+	}
+	if first, end := rb.PeekAll(false); string(first)+string(end) != "b" {
+		t.Fatalf("expect b but got %q %q", first, end)
+	}
+	// 扩容时未提交的数据一起搬移
+	_, _ = rb.WriteString("fgh")
+	if rb.Capacity() <= 4 {
+		t.Fatalf("expect growth but got capacity %d", rb.Capacity())
+	}
+	if _, err := rb.ReadBack(make([]byte, 1)); err != ErrInWriteTx {
+		t.Fatalf("expect ErrInWriteTx but got %v", err)
+	}
+	if err := rb.TruncateTail(1); err != ErrInWriteTx {
+		t.Fatalf("expect ErrInWriteTx but got %v", err)
+	}
+	// 读完已经提交的数据不影响未提交的数据
+	if b, _ := rb.ReadByte(); b != 'b' || !rb.IsEmpty() {
+		t.Fatalf("unexpected read %c %d", b, rb.Size())
+	}
+
+	if err := rb.WriteCommit(); err != nil {
+		t.Fatal(err)
+	}
+	if got := string(rb.ReadAll2NewByteSlice()); got != "cdefgh" || rb.WriteOffset() != 8 {
+		t.Fatalf("expect cdefgh but got %q at %d", got, rb.WriteOffset())
+	}
+	if err := rb.WriteCommit(); err != ErrIsNotInWrite {
+		t.Fatalf("expect ErrIsNotInWrite but got %v", err)
+	}
+
+	rb.WriteBegin()
+	_, _ = rb.WriteString("xyz")
+	rb.Reset()
+	if err := rb.WriteRollback(); err != nil {
+		t.Fatal(err)
+	}
+	if !rb.IsEmpty() || rb.PendingSize() != 0 {
+		t.Fatalf("expect empty but got %d %d", rb.Size(), rb.PendingSize())
+	}
+	if err := rb.WriteRollback(); err != ErrIsNotInWrite {
+		t.Fatalf("expect ErrIsNotInWrite but got %v", err)
+	}
+	_, _ = rb.WriteString("ok")
+	if got := string(rb.ReadAll2NewByteSlice()); got != "ok" {
+		t.Fatalf("expect ok but got %q", got)
+	}
+}
+
+func TestWriteTx_ExploreAndHistory(t *testing.T) {
+	rb := NewWithHistory(4, 4)
+	_, _ = rb.WriteString("ab")
+
+	rb.ExploreBegin()
+	_, _ = rb.ExploreDiscard(2)
+	rb.WriteBegin()
+	_, _ = rb.WriteString("c")
+	// 回溯引用可以引用未提交的数据
+	if err := rb.CopyFromHistory(3, 6); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rb.ExploreRead(make([]byte, 1)); err != ErrIsEmpty {
+		t.Fatalf("expect ErrIsEmpty but got %v", err)
+	}
+	_ = rb.WriteCommit()
+	first, end := rb.PeekAll(true)
+	if got := string(first) + string(end); got != "cabcabc" {
+		t.Fatalf("expect cabcabc but got %q", got)
+	}
+	_, _ = rb.ExploreDiscard(7)
+	rb.ExploreCommit()
+
+	// 回滚以后，之后的写入从事务开始的位置继续
+	rb.WriteBegin()
+	_, _ = rb.WriteString("zzzz")
+	_ = rb.WriteRollback()
+	_, _ = rb.WriteString("d")
+	if got := string(rb.ReadAll2NewByteSlice()); got != "d" || rb.HistorySize() != 4 {
+		t.Fatalf("expect d but got %q with history %d", got, rb.HistorySize())
+	}
+}
+
+// TestWriteTx_Atomic 写者分多次写入一条消息，读者只能看到完整的消息。
+func TestWriteTx_ConsumeAll(t *testing.T) {
+	consumers := map[string]func(rb *RingBuffer){
+		"Discard":     func(rb *RingBuffer) { _, _ = rb.Discard(rb.Size()) },
+		"RetrieveAll": func(rb *RingBuffer) { rb.RetrieveAll() },
+	}
+	for name, consume := range consumers {
+		rb := New(8)
+		_, _ = rb.WriteString("abcde")
+		_, _ = rb.Read(make([]byte, 2))
+		rb.WriteBegin()
+		_, _ = rb.WriteString("xyz")
+		consume(rb)
+
+		// 未提交的数据仍然不可见，探索指针也在读指针处
+		if rb.Size() != 0 || rb.ExploreSize() != 0 {
+			t.Fatalf("%s: expect size 0/0 but got %d/%d", name, rb.Size(), rb.ExploreSize())
+		}
+		if first, end := rb.Peek(1, true); len(first)+len(end) != 0 {
+			t.Fatalf("%s: expect nothing to peek but got %q %q", name, first, end)
+		}
+		_ = rb.WriteCommit()
+		if first, end := rb.Peek(3, true); string(first)+string(end) != "xyz" {
+			t.Fatalf("%s: expect xyz but got %q %q", name, first, end)
+		}
+		if got := string(rb.ReadAll2NewByteSlice()); got != "xyz" {
+			t.Fatalf("%s: expect xyz but got %q", name, got)
+		}
+	}
+}
+
+func TestWriteTx_Atomic(t *testing.T) {
+	const messages = 2000
+	rb := New(8, true)
+	message := []byte("header:body;")
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < messages; i++ {
+			rb.WriteBegin()
+			_, _ = rb.Write(message[:7])
+			_, _ = rb.Write(message[7:11])
+			_ = rb.WriteByte(message[11])
+			if i%3 == 0 {
+				_ = rb.WriteRollback()
+				continue
+			}
+			_ = rb.WriteCommit()
+		}
+	}()
+
+	var got []byte
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	for finished := false; !finished; {
+		select {
+		case <-done:
+			finished = true
+		default:
+		}
+		if size := rb.Size(); size%len(message) != 0 {
+			t.Fatalf("saw a partial message: size %d", size)
+		}
+		all := rb.ReadAll2NewByteSlice()
+		if len(all)%len(message) != 0 {
+			t.Fatalf("saw a partial message: %q", all)
+		}
+		got = append(got, all...)
+		rb.Retrieve(len(got) - int(rb.ReadOffset()))
+	}
+	if !bytes.Equal(got, bytes.Repeat(message, messages-(messages+2)/3)) {
+		t.Fatalf("unexpected data of %d bytes", len(got))
+	}
+}